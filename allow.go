@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+//a network authorized until it expires, for a contractor or a CI runner
+type temporaryEntry struct {
+	Name    string    `json:"name"`
+	CIDR    string    `json:"cidr"`
+	Added   time.Time `json:"added"`
+	Expires time.Time `json:"expires"`
+	//expired entries stay until an update removed them from every cluster, listed by resource name once they did
+	Expired     bool     `json:"expired,omitempty"`
+	RemovedFrom []string `json:"removedFrom,omitempty"`
+	//with --require-approval, entries aren't applied until someone approves them
+	Pending     bool   `json:"pending,omitempty"`
+	RequestedBy string `json:"requestedBy,omitempty"`
+	ApprovedBy  string `json:"approvedBy,omitempty"`
+}
+
+//authorize --cidr for --ttl, or list the temporary entries without --cidr.
+//The entry is recorded in the state, a running app or the next --once run applies it and removes it once expired.
+func (a *App) allow() {
+	if a.NoState {
+		log.Fatal("allow records the entries in the state, it can't be used with --no-state")
+	}
+	st := a.loadState()
+	if a.AllowCIDR == "" {
+		a.listTemporary(st)
+		return
+	}
+
+	cidr := a.AllowCIDR
+	if !strings.Contains(cidr, "/") {
+		if ip := net.ParseIP(cidr); ip != nil && ip.To4() == nil {
+			cidr += "/128"
+		} else {
+			cidr += "/32"
+		}
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if a.AllowTTL <= 0 {
+		log.Fatal("--ttl must be positive")
+	}
+
+	name := a.AllowName
+	if name == "" {
+		name = "temp-" + strings.NewReplacer("/", "-", ":", "-").Replace(network.String())
+	}
+	if _, ok := st.IPs[name]; ok {
+		log.Fatalf("%s is already the name of an entry", name)
+	}
+
+	now := time.Now()
+	t := temporaryEntry{Name: name, CIDR: network.String(), Added: now, Expires: now.Add(a.AllowTTL), Pending: a.RequireApproval, RequestedBy: currentUser()}
+	var temporary []temporaryEntry
+	for _, e := range st.Temporary {
+		if e.Name != name {
+			temporary = append(temporary, e)
+		}
+	}
+	st.Temporary = append(temporary, t)
+	a.saveState(st)
+
+	if t.Pending {
+		a.requestApproval(t)
+		fmt.Printf("%s is requested as %s until %s, it is applied once approved\n", t.CIDR, t.Name, a.displayWhen(t.Expires))
+		return
+	}
+	a.writeLog(fmt.Sprintf("Temporary entry %s (%s) allowed until %s \n", t.Name, t.CIDR, t.Expires.Format(time.RFC3339)))
+	fmt.Printf("%s is allowed as %s until %s, a running app picks this up on its next check\n", t.CIDR, t.Name, a.displayWhen(t.Expires))
+}
+
+func (a *App) listTemporary(st *state) {
+	a.validateOutput()
+	table := newTable("NAME", "CIDR", "EXPIRES", "REQUESTED BY", "STATUS")
+	table.timeColumn("expires", func(record interface{}) time.Time { return record.(temporaryEntry).Expires })
+	for _, t := range st.Temporary {
+		status := "approved by " + t.ApprovedBy
+		switch {
+		case t.Expired:
+			status = "expired, waiting for the next update"
+		case t.Pending:
+			status = "waiting for approval"
+		case t.ApprovedBy == "":
+			status = "allowed"
+		}
+		table.add(t, t.Name, t.CIDR, a.displayWhen(t.Expires), t.RequestedBy, status)
+	}
+	a.printTable(table, "No temporary entry")
+}
+
+//pick up the temporary entries `allow` recorded in the state file since the app started or last checked,
+//along with the approvals and rejections of pending ones and the imported networks. Reports whether an entry to apply came up.
+func (st *state) admit() bool {
+	if st.app.NoState {
+		return false
+	}
+
+	admitted := false
+	recorded := st.app.readState("state.json")
+	for _, t := range recorded.Temporary {
+		//the app enforces the approvals, whatever the allow command was run with
+		requested := st.app.RequireApproval && !t.Pending && t.ApprovedBy == ""
+		if requested {
+			t.Pending = true
+		}
+
+		i := st.temporary(t.Name)
+		switch {
+		case i < 0:
+			st.Temporary = append(st.Temporary, t)
+			if requested {
+				st.app.requestApproval(t)
+			}
+		case t.Added.After(st.Temporary[i].Added) || st.Temporary[i].Pending && !t.Pending:
+			st.Temporary[i] = t
+		default:
+			continue
+		}
+		if !t.Pending {
+			admitted = true
+			st.app.writeLog(fmt.Sprintf("Temporary entry %s (%s) added until %s \n", t.Name, t.CIDR, t.Expires.Format(time.RFC3339)))
+		}
+	}
+
+	if st.admitStatic(recorded) {
+		admitted = true
+	}
+
+	//rejected requests are gone from the state file
+	var temporary []temporaryEntry
+	for _, t := range st.Temporary {
+		if !t.Pending || recorded.temporary(t.Name) >= 0 {
+			temporary = append(temporary, t)
+		}
+	}
+	st.Temporary = temporary
+	return admitted
+}
+
+//mark the temporary entries past their TTL as expired, dropping the requests never approved.
+//Reports whether an applied entry expired.
+func (st *state) expire() bool {
+	expired := false
+	var temporary []temporaryEntry
+	for _, t := range st.Temporary {
+		if !t.Expired && time.Now().After(t.Expires) {
+			st.app.writeLog(fmt.Sprintf("Temporary entry %s (%s) expired \n", t.Name, t.CIDR))
+			if t.Pending {
+				continue
+			}
+			t.Expired = true
+			expired = true
+		}
+		temporary = append(temporary, t)
+	}
+	st.Temporary = temporary
+	return expired
+}
+
+//check whether the entry is to be in the cluster
+func (a *App) applicable(t temporaryEntry) bool {
+	return !t.Expired && !t.Pending && (!a.RequireApproval || t.ApprovedBy != "")
+}
+
+//index of the temporary entry of that name, -1 when there is none
+func (st *state) temporary(name string) int {
+	for i, t := range st.Temporary {
+		if t.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+//an error answered by a Google API
+type apiError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s : %s", e.Status, e.Body)
+}
+
+//call a Google JSON API with the credentials of the app, decoding the answer into out unless it's nil
+func (a *App) callAPI(ctx context.Context, method, url string, body []byte, out interface{}) error {
+	ts, err := a.sharedTokenSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", a.userAgent())
+
+	resp, err := oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, a.httpClient(googleAPIs)), ts).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &apiError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(msg)}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
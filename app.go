@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+//what the commands share: the config, the HTTP clients, the state directories, the log and what the daemon keeps
+//in memory. Built once by main and handed down, so nothing depends on package level variables.
+type App struct {
+	*Config
+
+	httpClients map[purpose]*http.Client
+	//directory holding the state and the log file
+	stateDir string
+	//directory holding data that can be recreated at any time
+	cacheDir string
+	//files of the state directory, kept here instead with --no-state
+	memoryFiles memoryStore
+	logFile     *os.File
+	//where the log file is, its size and the last message, guarded by logMu
+	logMu     sync.Mutex
+	logPath   string
+	logSize   int64
+	lastLog   logRepeat
+	status    *appStatus
+	startTime time.Time
+
+	digest     pendingDigest
+	templates  notifierTemplates
+	faults     injectedFaults
+	simulation simulatedCluster
+	iap        iapAvailability
+	//the time zone of the times shown to people, from --timezone. Log lines keep the RFC3339 timestamps of --log-time.
+	displayZone *time.Location
+	//guards credentials.json, where the endpoint and CA of the clusters are kept
+	credentialsMu sync.Mutex
+
+	//locations found by --geoip, so the guard and the recent IPs look an IP up once
+	locatedMu sync.Mutex
+	located   map[string]location
+
+	//the key signing the state files with --sign-state
+	stateKeyOnce  sync.Once
+	stateKeyValue []byte
+	stateKeyErr   error
+	//whether the app keeps running, the daemon or observe, so notifications can wait for --notify-digest.
+	//One-shot runs like --once or gate exit before the window ends and send them right away.
+	keepsRunning bool
+	//the state files found tampered with, alerted about once
+	tamperedMu sync.Mutex
+	tampered   map[string]bool
+	//the requests of the admin API on the temporary entries, taken by the coordinator
+	decisions chan decision
+
+	tokenSourceOnce sync.Once
+	tokenSource     oauth2.TokenSource
+	tokenSourceErr  error
+}
+
+func newApp(c *Config) *App {
+	a := &App{
+		Config:      c,
+		memoryFiles: memoryStore{files: map[string][]byte{}},
+		startTime:   time.Now(),
+		displayZone: time.Local,
+		located:     map[string]location{},
+		tampered:    map[string]bool{},
+		decisions:   make(chan decision),
+	}
+	a.status = &appStatus{app: a}
+	return a
+}
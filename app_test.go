@@ -0,0 +1,26 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+//an app parsed from args that keeps its state in memory and logs to a temporary file
+func newTestApp(t *testing.T, args ...string) *App {
+	t.Helper()
+	a := newApp(parseConfig(append([]string{"--no-state", "--connectivity-probe", ""}, args...)))
+	f, err := ioutil.TempFile("", "gke-ip-update-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		f.Close()
+		os.Remove(f.Name())
+	})
+	a.logFile = f
+	if err := a.initializeHTTPClients(); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/user"
+	"strings"
+)
+
+//the user running the command, recorded with the requests and approvals
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+//approve or reject the pending temporary entries given as arguments
+func (a *App) approve(names []string, approved bool) {
+	if a.NoState {
+		log.Fatal("approvals are recorded in the state, they can't be used with --no-state")
+	}
+	if len(names) == 0 {
+		log.Fatal("No entry given, `gke-ip-update allow` lists the pending ones")
+	}
+
+	for _, name := range names {
+		st := a.loadState()
+		message, err := st.decide(name, approved, currentUser())
+		if err != nil {
+			log.Fatal(err)
+		}
+		//a running app picks the decision up on its next check
+		a.saveState(st)
+		fmt.Println(message)
+	}
+}
+
+//a request of the admin API on the pending temporary entries, answered by the coordinator which owns the state
+type decision struct {
+	//the entry decided on, the pending entries are listed when empty
+	name     string
+	approved bool
+	by       string
+	reply    chan decisionReply
+}
+
+type decisionReply struct {
+	pending []temporaryEntry
+	message string
+	err     error
+}
+
+//approve or reject a pending temporary entry. Requesters can withdraw their requests but only the user running
+//the app, who owns the state directory, can approve their own: the others sharing it need someone else to.
+func (st *state) decide(name string, approved bool, by string) (string, error) {
+	i := st.temporary(name)
+	if i < 0 || !st.Temporary[i].Pending {
+		return "", fmt.Errorf("no temporary entry %s waits for approval", name)
+	}
+
+	t := st.Temporary[i]
+	if approved && t.RequestedBy == by && by != st.app.stateOwner() {
+		return "", fmt.Errorf("%s requested %s, someone else has to approve it", by, name)
+	}
+	var message string
+	switch {
+	case approved:
+		st.Temporary[i].Pending = false
+		st.Temporary[i].ApprovedBy = by
+		message = fmt.Sprintf("Temporary entry %s (%s) approved by %s", t.Name, t.CIDR, by)
+	case t.RequestedBy == by:
+		st.Temporary = append(st.Temporary[:i], st.Temporary[i+1:]...)
+		message = fmt.Sprintf("Temporary entry %s (%s) withdrawn by %s", t.Name, t.CIDR, by)
+	default:
+		st.Temporary = append(st.Temporary[:i], st.Temporary[i+1:]...)
+		message = fmt.Sprintf("Temporary entry %s (%s) rejected by %s", t.Name, t.CIDR, by)
+	}
+	st.app.writeLog(message + " \n")
+	return message, nil
+}
+
+//the pending temporary entries
+func (st *state) pendingEntries() []temporaryEntry {
+	var pending []temporaryEntry
+	for _, t := range st.Temporary {
+		if t.Pending {
+			pending = append(pending, t)
+		}
+	}
+	return pending
+}
+
+//the user owning the state directory, who runs the app. "" when it can't be read.
+func (a *App) stateOwner() string {
+	owner, err := fileOwner(a.statePath(""))
+	if err != nil {
+		return ""
+	}
+	return owner
+}
+
+//hand a request to the coordinator and wait for its answer, until the client goes away
+func (a *App) askCoordinator(r *http.Request, d decision) (decisionReply, bool) {
+	d.reply = make(chan decisionReply, 1)
+	select {
+	case a.decisions <- d:
+	case <-r.Context().Done():
+		return decisionReply{}, false
+	}
+	select {
+	case reply := <-d.reply:
+		return reply, true
+	case <-r.Context().Done():
+		return decisionReply{}, false
+	}
+}
+
+//check the --admin-token given as a bearer token, which a form posted by a web page can't carry, answering the
+//requests without it. Without --admin-token, the requests are refused when it's required and let through otherwise.
+func (a *App) authorized(w http.ResponseWriter, r *http.Request, required bool) bool {
+	if a.AdminToken == "" {
+		if required {
+			http.Error(w, "this needs --admin-token", http.StatusForbidden)
+		}
+		return !required
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.AdminToken)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+//list the pending temporary entries on GET, approve or reject one on POST with the name and action=approve|reject
+//parameters. Both need the --admin-token: the requests tell who asked for which network.
+//The coordinator answers, so the decisions aren't lost by its saves of the state. Until it runs, the requests wait.
+func (a *App) serveApprovals(w http.ResponseWriter, r *http.Request) {
+	if (r.Method == http.MethodGet || r.Method == http.MethodPost) && !a.authorized(w, r, true) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		reply, ok := a.askCoordinator(r, decision{})
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reply.pending)
+	case http.MethodPost:
+		action := r.FormValue("action")
+		if action != "approve" && action != "reject" {
+			http.Error(w, "action must be approve or reject", http.StatusBadRequest)
+			return
+		}
+		name := r.FormValue("name")
+		if name == "" {
+			http.Error(w, "name is missing", http.StatusBadRequest)
+			return
+		}
+		reply, ok := a.askCoordinator(r, decision{name: name, approved: action == "approve", by: "admin API (" + r.RemoteAddr + ")"})
+		if !ok {
+			return
+		}
+		if reply.err != nil {
+			http.Error(w, reply.err.Error(), http.StatusNotFound)
+			return
+		}
+		fmt.Fprintln(w, reply.message)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+//notify that a temporary entry waits for approval
+func (a *App) requestApproval(t temporaryEntry) {
+	message := func(expires string) string {
+		return fmt.Sprintf("%s requests access for %s (%s) until %s, run `gke-ip-update approve %s` or `gke-ip-update reject %s`",
+			t.RequestedBy, t.Name, t.CIDR, expires, t.Name, t.Name)
+	}
+	a.writeLog(message(logTime(t.Expires)) + " \n")
+	a.notify("warning", message(a.displayWhen(t.Expires)))
+}
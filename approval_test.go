@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecide(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-ip-update-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	owner := currentUser()
+
+	tests := []struct {
+		name        string
+		entry       string
+		approved    bool
+		requestedBy string
+		by          string
+		wantErr     bool
+		wantPending bool
+		wantKept    bool
+		approvedBy  string
+	}{
+		{name: "approved by someone else", entry: "contractor", approved: true, requestedBy: "alice", by: "bob", wantKept: true, approvedBy: "bob"},
+		{name: "approved by the admin API", entry: "contractor", approved: true, requestedBy: "alice", by: "admin API (127.0.0.1:50000)", wantKept: true, approvedBy: "admin API (127.0.0.1:50000)"},
+		{name: "self-approval refused", entry: "contractor", approved: true, requestedBy: "alice", by: "alice", wantErr: true, wantPending: true, wantKept: true},
+		{name: "self-approval by the user running the app", entry: "contractor", approved: true, requestedBy: owner, by: owner, wantKept: true, approvedBy: owner},
+		{name: "rejected", entry: "contractor", requestedBy: "alice", by: "bob"},
+		{name: "withdrawn", entry: "contractor", requestedBy: "alice", by: "alice"},
+		{name: "unknown entry", entry: "other", approved: true, requestedBy: "alice", by: "bob", wantErr: true, wantPending: true, wantKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t)
+			a.stateDir = dir
+			st := &state{IPs: map[string]string{}, app: a}
+			st.Temporary = []temporaryEntry{{Name: "contractor", CIDR: "198.51.100.0/24", Added: time.Now(), Expires: time.Now().Add(time.Hour), Pending: true, RequestedBy: tt.requestedBy}}
+
+			_, err := st.decide(tt.entry, tt.approved, tt.by)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decide() error = %v, want error %v", err, tt.wantErr)
+			}
+			i := st.temporary("contractor")
+			if (i >= 0) != tt.wantKept {
+				t.Fatalf("entry kept = %v, want %v", i >= 0, tt.wantKept)
+			}
+			if i < 0 {
+				return
+			}
+			if e := st.Temporary[i]; e.Pending != tt.wantPending || e.ApprovedBy != tt.approvedBy {
+				t.Errorf("entry pending %v approved by %q, want pending %v approved by %q", e.Pending, e.ApprovedBy, tt.wantPending, tt.approvedBy)
+			}
+		})
+	}
+}
+
+//the decisions of the admin API are taken by the coordinator, which rolls an approved entry out
+func TestPipelineDecide(t *testing.T) {
+	a := newTestApp(t, "--require-approval")
+	st := &state{IPs: map[string]string{"home": "203.0.113.1"}, app: a}
+	st.Temporary = []temporaryEntry{{Name: "contractor", CIDR: "198.51.100.0/24", Added: time.Now(), Expires: time.Now().Add(time.Hour), Pending: true, RequestedBy: "alice"}}
+	tgt := &target{app: a, name: "projects/p/locations/l/clusters/c", jobs: make(chan job, 1)}
+	p := &pipeline{app: a, st: st, targets: []*target{tgt}}
+
+	reply := make(chan decisionReply, 1)
+	t.Run("pending listed", func(t *testing.T) {
+		p.decide(decision{reply: reply})
+		if r := <-reply; len(r.pending) != 1 || r.pending[0].Name != "contractor" {
+			t.Errorf("pending = %+v, want the request of contractor", r.pending)
+		}
+	})
+	t.Run("approval rolled out", func(t *testing.T) {
+		p.decide(decision{name: "contractor", approved: true, by: "bob", reply: reply})
+		if r := <-reply; r.err != nil {
+			t.Fatal(r.err)
+		}
+		select {
+		case j := <-tgt.jobs:
+			var found bool
+			for _, e := range j.st.entries() {
+				found = found || e.DisplayName == "contractor"
+			}
+			if !found {
+				t.Errorf("the job of %q doesn't authorize the approved entry", j.reason)
+			}
+		default:
+			t.Error("no job submitted for the approved entry")
+		}
+	})
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		path   string
+		method string
+		header string
+		want   int
+	}{
+		{name: "status without --admin-token", path: "/status", method: http.MethodGet, want: http.StatusOK},
+		{name: "status without the token", token: "secret", path: "/status", method: http.MethodGet, want: http.StatusUnauthorized},
+		{name: "status with a wrong token", token: "secret", path: "/status", method: http.MethodGet, header: "Bearer guess", want: http.StatusUnauthorized},
+		{name: "status with the token", token: "secret", path: "/status", method: http.MethodGet, header: "Bearer secret", want: http.StatusOK},
+		{name: "approvals without --admin-token", path: "/approvals", method: http.MethodGet, want: http.StatusForbidden},
+		{name: "approvals without the token", token: "secret", path: "/approvals", method: http.MethodGet, want: http.StatusUnauthorized},
+		{name: "decision without the token", token: "secret", path: "/approvals?name=contractor&action=approve", method: http.MethodPost, want: http.StatusUnauthorized},
+		{name: "decision without --admin-token", path: "/approvals?name=contractor&action=approve", method: http.MethodPost, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t, "--admin-token", tt.token)
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			if strings.HasPrefix(tt.path, "/status") {
+				a.status.ServeHTTP(w, r)
+			} else {
+				a.serveApprovals(w, r)
+			}
+			if w.Code != tt.want {
+				t.Errorf("%s %s answered %d, want %d", tt.method, tt.path, w.Code, tt.want)
+			}
+		})
+	}
+}
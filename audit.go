@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"gke-ip-update/updater"
+
+	"google.golang.org/api/container/v1"
+)
+
+const loggingAPI = "https://logging.googleapis.com/v2/entries"
+
+//payload of the entries written to --audit-log, kept stable so dashboards can rely on it
+type auditPayload struct {
+	Event   string   `json:"event"`
+	Actor   string   `json:"actor"`
+	Owner   string   `json:"owner,omitempty"`
+	Cluster string   `json:"cluster"`
+	Reason  string   `json:"reason"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Version string   `json:"version"`
+	//the correlation ID of the reconcile, found in the logs of the app
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+//record a change of the authorized networks in Cloud Logging
+func (a *App) writeAuditEntry(ctx context.Context, cluster updater.Cluster, change *updater.Change, reason string) error {
+	host, _ := os.Hostname()
+	payload := auditPayload{
+		Event:         "authorized-networks-updated",
+		Actor:         host,
+		Owner:         a.Owner,
+		Cluster:       cluster.ResourceName(),
+		Reason:        reason,
+		Added:         describeBlocks(change.Added),
+		Removed:       describeBlocks(change.Removed),
+		Version:       version,
+		CorrelationID: updater.CorrelationID(ctx),
+	}
+
+	entry := map[string]interface{}{
+		"severity":    "NOTICE",
+		"jsonPayload": payload,
+	}
+	//a label is indexed, filtering the churn of a team stays cheap
+	if a.Owner != "" {
+		entry["labels"] = map[string]string{"owner": a.Owner}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"logName": fmt.Sprintf("projects/%s/logs/%s", cluster.Project, a.AuditLog),
+		"resource": map[string]interface{}{
+			"type": "k8s_cluster",
+			"labels": map[string]string{
+				"project_id":   cluster.Project,
+				"location":     cluster.Zone,
+				"cluster_name": cluster.Name,
+			},
+		},
+		"entries": []interface{}{entry},
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.callAPI(ctx, http.MethodPost, loggingAPI+":write", body, nil)
+}
+
+//"name=cidr" of every block
+func describeBlocks(blocks []*container.CidrBlock) []string {
+	var d []string
+	for _, b := range blocks {
+		d = append(d, b.DisplayName+"="+b.CidrBlock)
+	}
+	return d
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+//DNS-SD service type the status is published under
+const beaconService = "_gke-ip-update._tcp.local."
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+//publishes the status of the app on the LAN with mDNS, as the TXT record of a DNS-SD service
+//so machines and dashboards of the network find it without the admin endpoint
+type beacon struct {
+	app      *App
+	conn     *net.UDPConn
+	instance dnsmessage.Name
+	service  dnsmessage.Name
+	host     dnsmessage.Name
+	port     uint16
+}
+
+//answer mDNS queries for the status and announce it every minute
+func (a *App) startBeacon() error {
+	host, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	host = strings.Split(host, ".")[0]
+	name := a.MDNSName
+	if name == "" {
+		name = host
+	}
+
+	b := &beacon{app: a, service: dnsmessage.MustNewName(beaconService)}
+	if b.instance, err = dnsmessage.NewName(name + "." + beaconService); err != nil {
+		return err
+	}
+	if b.host, err = dnsmessage.NewName(host + ".local."); err != nil {
+		return err
+	}
+	if a.AdminAddr != "" {
+		if _, port, err := net.SplitHostPort(a.AdminAddr); err == nil {
+			fmt.Sscan(port, &b.port)
+		}
+	}
+
+	if b.conn, err = net.ListenMulticastUDP("udp4", nil, mdnsGroup); err != nil {
+		return err
+	}
+
+	go b.serve()
+	go func() {
+		for {
+			b.announce()
+			time.Sleep(time.Minute)
+		}
+	}()
+	return nil
+}
+
+//answer the queries for the service or the instance
+func (b *beacon) serve() {
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := b.conn.ReadFromUDP(buf)
+		if err != nil {
+			b.app.writeLog(fmt.Sprintf("mDNS beacon stopped : %s \n", err.Error()))
+			return
+		}
+
+		var p dnsmessage.Parser
+		h, err := p.Start(buf[:n])
+		if err != nil || h.Response {
+			continue
+		}
+		questions, err := p.AllQuestions()
+		if err != nil {
+			continue
+		}
+		for _, q := range questions {
+			if q.Name == b.service || q.Name == b.instance {
+				b.announce()
+				break
+			}
+		}
+	}
+}
+
+//send the records of the service to the group
+func (b *beacon) announce() {
+	msg, err := b.records()
+	if err != nil {
+		b.app.writeLog(fmt.Sprintf("Unable to build the mDNS records : %s \n", err.Error()))
+		return
+	}
+	b.conn.WriteToUDP(msg, mdnsGroup)
+}
+
+//PTR, SRV and TXT records of the service, the TXT one holding the status
+func (b *beacon) records() ([]byte, error) {
+	status := b.app.status
+	status.mu.Lock()
+	var txt []string
+	var names []string
+	for name := range status.IPs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		txt = append(txt, fmt.Sprintf("ip.%s=%s", name, status.IPs[name]))
+	}
+	if !status.LastCheck.IsZero() {
+		txt = append(txt, "checked="+status.LastCheck.UTC().Format(time.RFC3339))
+	}
+	if !status.LastUpdate.IsZero() {
+		txt = append(txt, "updated="+status.LastUpdate.UTC().Format(time.RFC3339))
+	}
+	if status.LastError != "" {
+		//a TXT string holds at most 255 bytes
+		e := "error=" + status.LastError
+		if len(e) > 255 {
+			e = e[:255]
+		}
+		txt = append(txt, e)
+	}
+	status.mu.Unlock()
+	txt = append(txt, "version="+version)
+
+	//SRV and TXT records only come from this host, so caches replace them instead of adding to them
+	const cacheFlush = 1 << 15
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	builder.EnableCompression()
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+	header := func(name dnsmessage.Name, class dnsmessage.Class) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Class: class, TTL: 120}
+	}
+	if err := builder.PTRResource(header(b.service, dnsmessage.ClassINET), dnsmessage.PTRResource{PTR: b.instance}); err != nil {
+		return nil, err
+	}
+	if err := builder.SRVResource(header(b.instance, dnsmessage.ClassINET|cacheFlush), dnsmessage.SRVResource{Target: b.host, Port: b.port}); err != nil {
+		return nil, err
+	}
+	if err := builder.TXTResource(header(b.instance, dnsmessage.ClassINET|cacheFlush), dnsmessage.TXTResource{TXT: txt}); err != nil {
+		return nil, err
+	}
+	return builder.Finish()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"gke-ip-update/updater"
+
+	"google.golang.org/api/container/v1"
+)
+
+//--static-cidr flags, given as name=cidr
+type cidrFlags []*container.CidrBlock
+
+func (c *cidrFlags) String() string {
+	var specs []string
+	for _, b := range *c {
+		specs = append(specs, b.DisplayName+"="+b.CidrBlock)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (c *cidrFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected name=cidr, got %q", value)
+	}
+
+	_, network, err := net.ParseCIDR(parts[1])
+	if err != nil {
+		return err
+	}
+
+	*c = append(*c, &container.CidrBlock{DisplayName: parts[0], CidrBlock: network.String()})
+	return nil
+}
+
+//enable master authorized networks on a new cluster, seeding the static networks and the current IP in one update
+func (a *App) bootstrap() {
+	ctx := context.Background()
+	a.setCreds(a.CredentialPath)
+	if err := a.resolveZone(); err != nil {
+		log.Fatal(err)
+	}
+
+	st := a.loadState()
+	ips, err := a.findIPs(st.IPs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.update(ips)
+
+	cluster := updater.Cluster{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}
+	containerService, err := a.newContainerService(ctx, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c, err := updater.GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	entries := append(append([]*container.CidrBlock{}, a.StaticCidrs...), st.entries()...)
+
+	if c.MasterAuthorizedNetworksConfig == nil || !c.MasterAuthorizedNetworksConfig.Enabled {
+		fmt.Printf("Master authorized networks are disabled on %s. Enabling them blocks access to the API server from every network except:\n", a.ClusterID)
+		for _, e := range entries {
+			fmt.Printf("  %-20s %s\n", e.DisplayName, e.CidrBlock)
+		}
+		if !a.confirm("Enable master authorized networks?") {
+			fmt.Println("Aborted")
+			return
+		}
+	}
+
+	static := map[string]bool{}
+	for _, b := range a.StaticCidrs {
+		static[b.DisplayName] = true
+	}
+
+	change, err := updater.SetEntries(ctx, containerService, cluster, entries, func(name string) bool {
+		return static[name] || st.managed(name)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	op := change.Operation
+	if op != nil {
+		fmt.Printf("Waiting for operation %s\n", op.Name)
+		report := func(message string) {
+			fmt.Println(message)
+		}
+		if err := a.waitOperation(ctx, containerService, cluster, op, st, report); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	a.saveState(st)
+	a.saveIP(a.primaryIP(ips))
+
+	if op != nil {
+		a.writeLog(fmt.Sprintf("Bootstrapped master authorized networks of %s \n", a.ClusterID))
+		fmt.Println("Master authorized networks updated, start the app to keep them current")
+	} else {
+		fmt.Println("Master authorized networks already up to date")
+	}
+}
+
+//ask the user a yes/no question, unless --yes was given
+func (a *App) confirm(question string) bool {
+	if a.AssumeYes {
+		return true
+	}
+
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
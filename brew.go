@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//prefix of the Homebrew installation running the app, or "" when it wasn't installed with brew
+func homebrewPrefix() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	i := strings.Index(exe, string(filepath.Separator)+filepath.Join("Cellar", "gke-ip-update")+string(filepath.Separator))
+	if i < 0 {
+		return ""
+	}
+	if prefix := os.Getenv("HOMEBREW_PREFIX"); prefix != "" {
+		return prefix
+	}
+	return exe[:i]
+}
+
+//config file read when installed with brew and --config isn't given
+func homebrewConfig(prefix string) string {
+	return filepath.Join(prefix, "etc", "gke-ip-update.conf")
+}
+
+//log file of brew services
+func homebrewLog(prefix string) string {
+	return filepath.Join(prefix, "var", "log", "gke-ip-update.log")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"gke-ip-update/updater"
+
+	"google.golang.org/api/container/v1"
+)
+
+//how long the master of the canary has to become reachable after its update
+const canaryReachTimeout = time.Minute
+
+//check that the master of the cluster answers from here, which it only does once the IP is authorized.
+//Authorized networks take a little while to apply after the operation, so it's tried for a minute.
+func (a *App) masterReachable(ctx context.Context, cluster updater.Cluster) error {
+	c, roots, err := a.masterCA(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{RootCAs: roots, ServerName: c.Endpoint}
+
+	deadline := time.Now().Add(canaryReachTimeout)
+	for {
+		dialer := &net.Dialer{Timeout: a.DialTimeout}
+		conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(c.Endpoint, "443"), config)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("master of %s unreachable : %s", cluster.Name, err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+//the cluster and the CA its master certificates are checked with
+func (a *App) masterCA(ctx context.Context, cluster updater.Cluster) (*container.Cluster, *x509.CertPool, error) {
+	containerService, err := a.newContainerService(ctx, cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := updater.GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Endpoint == "" || c.MasterAuth == nil {
+		return nil, nil, fmt.Errorf("cluster %s has no endpoint", cluster.Name)
+	}
+
+	ca, err := base64.StdEncoding.DecodeString(c.MasterAuth.ClusterCaCertificate)
+	if err != nil {
+		return nil, nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, nil, errors.New("unable to read the CA certificate of the cluster")
+	}
+	return c, roots, nil
+}
+
+//check whether the cluster is the one of --canary
+func (a *App) isCanary(context string, c updater.Cluster) bool {
+	return a.Canary != "" && matchesCluster(a.Canary, context, c)
+}
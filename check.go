@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+
+	"gke-ip-update/updater"
+
+	"google.golang.org/api/container/v1"
+)
+
+//tell whether the current IP is covered by the authorized networks of the cluster, without changing anything.
+//Exits with 0 when it is, 1 when it isn't and 2 when it couldn't be checked, for shell prompts and kubectl wrappers.
+func (a *App) check() {
+	ips, err := a.findOwnIPs(nil)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	a.setCreds(a.CredentialPath)
+	if err := a.resolveZone(); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	ctx := context.Background()
+	cluster := updater.Cluster{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}
+	containerService, err := a.newContainerService(ctx, cluster)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	c, err := updater.GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	if c.MasterAuthorizedNetworksConfig == nil || !c.MasterAuthorizedNetworksConfig.Enabled {
+		fmt.Printf("Master authorized networks are disabled on %s, every IP is authorized\n", a.ClusterID)
+		a.status.record(ips, nil)
+		return
+	}
+
+	var names []string
+	for name := range ips {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	authorized := true
+	for _, name := range names {
+		ip := ips[name]
+		label := ip
+		if len(a.Links) > 0 {
+			label = fmt.Sprintf("%s (%s)", ip, name)
+		}
+
+		if b := coveringBlock(ip, c.MasterAuthorizedNetworksConfig.CidrBlocks); b != nil {
+			fmt.Printf("%s is authorized in %s by %s (%s)\n", label, a.ClusterID, b.DisplayName, b.CidrBlock)
+		} else {
+			fmt.Printf("%s is not authorized in %s\n", label, a.ClusterID)
+			authorized = false
+		}
+	}
+
+	if !authorized {
+		a.status.record(ips, fmt.Errorf("not authorized in %s", a.ClusterID))
+		os.Exit(1)
+	}
+	a.status.record(ips, nil)
+}
+
+//the first network containing the IP, nil when none does
+func coveringBlock(ip string, blocks []*container.CidrBlock) *container.CidrBlock {
+	addr := net.ParseIP(ip)
+	for _, b := range blocks {
+		if _, network, err := net.ParseCIDR(b.CidrBlock); err == nil && network.Contains(addr) {
+			return b
+		}
+	}
+	return nil
+}
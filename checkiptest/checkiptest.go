@@ -0,0 +1,90 @@
+//Package checkiptest provides a stand-in for checkip.amazonaws.com serving scripted answers,
+//for trying the updater against IP changes, slow answers and failures without touching the network.
+//
+//	s := checkiptest.NewServer(checkiptest.Response{IP: "203.0.113.1"}, checkiptest.Response{Status: 503})
+//	defer s.Close()
+//	// run gke-ip-update with --checkip-url s.URL
+package checkiptest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+//Response is one scripted answer
+type Response struct {
+	//IP returned in the body, followed by a newline like the real service
+	IP string
+	//Latency before answering
+	Latency time.Duration
+	//Status code, 200 when zero. Any other status answers with an error body instead of the IP.
+	Status int
+}
+
+//Server answers with its responses in turn, starting over after the last one
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []Response
+	requests  int
+}
+
+//NewServer starts a server answering with responses
+func NewServer(responses ...Response) *Server {
+	s := &Server{responses: responses}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+//Handler returns the handler of a server that isn't started, to mount it on a server of your own
+func Handler(responses ...Response) *Server {
+	return &Server{responses: responses}
+}
+
+//SetResponses replaces the scripted answers and starts over from the first one
+func (s *Server) SetResponses(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses = responses
+	s.requests = 0
+}
+
+//Requests returns how many requests were answered since the responses were set
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if len(s.responses) == 0 {
+		s.mu.Unlock()
+		http.Error(w, "no responses configured", http.StatusInternalServerError)
+		return
+	}
+	resp := s.responses[s.requests%len(s.responses)]
+	s.requests++
+	s.mu.Unlock()
+
+	if resp.Latency > 0 {
+		select {
+		case <-time.After(resp.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if resp.Status != 0 && resp.Status != http.StatusOK {
+		http.Error(w, http.StatusText(resp.Status), resp.Status)
+		return
+	}
+
+	fmt.Fprintf(w, "%s\n", resp.IP)
+}
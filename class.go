@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//how much a cluster matters, given with --class. A failed update of a critical cluster pages right away and is retried
+//forever, one of a best-effort cluster is only logged and soon given up on.
+type class struct {
+	name string
+	//clusters of lower ranks are reconciled first
+	rank int
+	//consecutive failures after which updates are disabled, 0 never
+	maxFailures func(c *Config) int
+	//longest wait between retries
+	maxBackoff time.Duration
+	//level of the notifications of failed updates, none when empty
+	failureLevel string
+}
+
+var classes = map[string]class{
+	"critical": {
+		name:         "critical",
+		rank:         0,
+		maxFailures:  func(*Config) int { return 0 },
+		maxBackoff:   5 * time.Minute,
+		failureLevel: "critical",
+	},
+	"normal": {
+		name:         "normal",
+		rank:         1,
+		maxFailures:  func(c *Config) int { return c.MaxFailures },
+		maxBackoff:   maxBackoff,
+		failureLevel: "error",
+	},
+	"best-effort": {
+		name:         "best-effort",
+		rank:         2,
+		maxFailures:  func(*Config) int { return 3 },
+		maxBackoff:   2 * time.Hour,
+		failureLevel: "",
+	},
+}
+
+//--class flags, given as cluster=class
+type classFlags map[string]string
+
+func (c classFlags) String() string {
+	var specs []string
+	for cluster, name := range c {
+		specs = append(specs, cluster+"="+name)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (c classFlags) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected cluster=class, got %q", value)
+	}
+	if _, ok := classes[value[i+1:]]; !ok {
+		return fmt.Errorf("unknown class %q, expected critical, normal or best-effort", value[i+1:])
+	}
+	c[value[:i]] = value[i+1:]
+	return nil
+}
+
+//class of a cluster, given by its name, its full name or the name of its context. Clusters that aren't listed are normal.
+func (a *App) classOf(context string, c updater.Cluster) class {
+	for spec, name := range a.ClusterClasses {
+		if matchesCluster(spec, context, c) {
+			return classes[name]
+		}
+	}
+	return classes["normal"]
+}
+
+//check whether a cluster is the one given by name, full name or context name.
+//Full names of older versions have zones/ instead of locations/.
+func matchesCluster(spec, context string, c updater.Cluster) bool {
+	zonal := fmt.Sprintf("projects/%s/zones/%s/clusters/%s", c.Project, c.Zone, c.Name)
+	return spec == c.Name || spec == c.ResourceName() || spec == zonal || context != "" && spec == context
+}
@@ -0,0 +1,43 @@
+//Command checkip-server serves scripted answers in place of checkip.amazonaws.com,
+//to try a configuration against IP changes, slow answers and failures.
+//
+//	checkip-server --addr 127.0.0.1:8900 --ip 203.0.113.1,203.0.113.2 --latency 2s --fail-every 3
+//	gke-ip-update ... --checkip-url http://127.0.0.1:8900/
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"gke-ip-update/checkiptest"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8900", "address to listen on")
+	ips := flag.String("ip", "203.0.113.1", "comma separated IPs to answer with in turn")
+	latency := flag.Duration("latency", 0, "delay before every answer")
+	failEvery := flag.Int("fail-every", 0, "answer every Nth request with a 503, never when 0")
+	flag.Parse()
+
+	list := strings.Split(*ips, ",")
+	n := len(list)
+	if *failEvery > 0 {
+		n = len(list) * *failEvery
+	}
+
+	var responses []checkiptest.Response
+	next := 0
+	for k := 0; k < n; k++ {
+		if *failEvery > 0 && (k+1)%*failEvery == 0 {
+			responses = append(responses, checkiptest.Response{Latency: *latency, Status: http.StatusServiceUnavailable})
+			continue
+		}
+		responses = append(responses, checkiptest.Response{IP: strings.TrimSpace(list[next%len(list)]), Latency: *latency})
+		next++
+	}
+
+	log.Printf("serving %d responses on %s", len(responses), *addr)
+	log.Fatal(http.ListenAndServe(*addr, checkiptest.Handler(responses...)))
+}
@@ -0,0 +1,37 @@
+//Command server runs the reconcile handler as a standalone HTTP server, e.g. on Cloud Run.
+//
+//"/" serves function.Reconcile and "/pubsub" function.PubSub for push subscriptions. When PUBSUB_SUBSCRIPTION
+//is set, the server also pulls messages from that subscription.
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	"gke-ip-update/function"
+)
+
+func main() {
+	if os.Getenv("RECONCILE_TOKEN") == "" {
+		log.Fatal("RECONCILE_TOKEN is not set, anyone reaching the service could authorize their IP")
+	}
+
+	function.SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	if subscription := os.Getenv("PUBSUB_SUBSCRIPTION"); subscription != "" {
+		go func() {
+			log.Fatal(function.Pull(context.Background(), subscription))
+		}()
+	}
+
+	http.HandleFunc("/", function.Reconcile)
+	http.HandleFunc("/pubsub", function.PubSub)
+	log.Fatal(http.ListenAndServe(":"+port, nil))
+}
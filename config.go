@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+//the settings of a cluster listed as a table under cluster in a YAML or TOML config file, and the flags they set
+var clusterSettings = map[string]string{
+	"class":    "class",
+	"group":    "cluster-group",
+	"interval": "cluster-interval",
+}
+
+//set the flags listed in a config file. Files ending in .yaml, .yml or .toml are read as such, others have one flag
+//per line as name=value or name value. Lines starting with # are ignored. Flags given on the command line win over the file.
+func (fs *flagSet) loadConfig(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".toml":
+		return fs.loadStructuredConfig(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	given := fs.given()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value := line, "true"
+		if i := strings.IndexAny(line, "= \t"); i >= 0 {
+			name, value = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		if err := fs.setConfigFlag(given, name, strings.Trim(value, `"`)); err != nil {
+			return fmt.Errorf("%s:%d : %s", path, n, err.Error())
+		}
+	}
+
+	return scanner.Err()
+}
+
+//the flags given on the command line, by the name they are registered under whichever of their names was used
+func (fs *flagSet) given() map[string]bool {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		name := f.Name
+		if target, ok := fs.aliases[name]; ok {
+			name = target
+		}
+		given[name] = true
+	})
+	return given
+}
+
+//set a flag of the config file by any of its names, unless it was given on the command line
+func (fs *flagSet) setConfigFlag(given map[string]bool, name, value string) error {
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "-"), "-")
+	if target, ok := fs.aliases[name]; ok {
+		name = target
+	}
+	if given[name] {
+		return nil
+	}
+	return fs.Set(name, value)
+}
+
+//set the flags of a YAML or TOML config file. The keys are the names of the flags: a list sets a repeated flag once
+//per item and a map sets a cluster=value flag like class once per key. cluster (or clusters) can also list tables
+//with the name of the cluster and its class, group and interval.
+func (fs *flagSet) loadStructuredConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	settings := map[string]interface{}{}
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		_, err = toml.Decode(string(data), &settings)
+	} else {
+		err = yaml.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		return fmt.Errorf("%s : %s", path, err.Error())
+	}
+
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	given := fs.given()
+	for _, name := range names {
+		var err error
+		if name == "cluster" || name == "clusters" {
+			err = fs.setClusters(given, settings[name])
+		} else {
+			err = fs.setStructuredFlag(given, name, settings[name])
+		}
+		if err != nil {
+			return fmt.Errorf("%s : %s : %s", path, name, err.Error())
+		}
+	}
+	return nil
+}
+
+//set a flag from a value of a YAML or TOML config file
+func (fs *flagSet) setStructuredFlag(given map[string]bool, name string, value interface{}) error {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if err := fs.setStructuredFlag(given, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}, map[interface{}]interface{}:
+		entries, err := configMap(v)
+		if err != nil {
+			return err
+		}
+		var keys []string
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s, err := configScalar(entries[key])
+			if err != nil {
+				return err
+			}
+			if err := fs.setConfigFlag(given, name, key+"="+s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s, err := configScalar(value)
+	if err != nil {
+		return err
+	}
+	return fs.setConfigFlag(given, name, s)
+}
+
+//set --cluster from a list of names or tables, with the settings of the tables
+func (fs *flagSet) setClusters(given map[string]bool, value interface{}) error {
+	var clusters []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		clusters = v
+	case []map[string]interface{}:
+		//TOML arrays of tables
+		for _, table := range v {
+			clusters = append(clusters, table)
+		}
+	default:
+		clusters = []interface{}{value}
+	}
+	for _, c := range clusters {
+		switch c.(type) {
+		case map[string]interface{}, map[interface{}]interface{}:
+		default:
+			if err := fs.setStructuredFlag(given, "cluster", c); err != nil {
+				return err
+			}
+			continue
+		}
+
+		table, err := configMap(c)
+		if err != nil {
+			return err
+		}
+		name, err := configScalar(table["name"])
+		if err != nil || name == "" {
+			return fmt.Errorf("a cluster table needs a name")
+		}
+		if err := fs.setConfigFlag(given, "cluster", name); err != nil {
+			return err
+		}
+		for key, v := range table {
+			if key == "name" {
+				continue
+			}
+			target, ok := clusterSettings[key]
+			if !ok {
+				return fmt.Errorf("unknown setting %q of cluster %s, expected class, group or interval", key, name)
+			}
+			s, err := configScalar(v)
+			if err != nil {
+				return err
+			}
+			if err := fs.setConfigFlag(given, target, name+"="+s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//a table of the config file with string keys : YAML decodes nested maps with interface{} keys, TOML with strings
+func configMap(value interface{}) (map[string]interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[fmt.Sprint(key)] = item
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("expected a table, got %v", value)
+}
+
+//a single value of the config file as the flags take it
+func configScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("expected a single value, got %v", value)
+}
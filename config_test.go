@@ -0,0 +1,194 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//the settings the config files of the tests set
+type configured struct {
+	network   string
+	interval  time.Duration
+	keepIPs   int
+	watch     bool
+	zone      string
+	clusters  []string
+	classes   map[string]string
+	intervals map[string]time.Duration
+}
+
+func configuredBy(c *Config) configured {
+	return configured{
+		network:   c.NetworkDisplayName,
+		interval:  c.Interval,
+		keepIPs:   c.KeepIPs,
+		watch:     c.WatchNetwork,
+		zone:      c.ClusterZone,
+		clusters:  c.Clusters,
+		classes:   c.ClusterClasses,
+		intervals: c.ClusterIntervals,
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gke-ip-update-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	full := configured{
+		network:   "home",
+		interval:  5 * time.Minute,
+		keepIPs:   2,
+		watch:     true,
+		zone:      "europe-west1",
+		clusters:  []string{"prod", "hobby"},
+		classes:   map[string]string{"prod": "critical"},
+		intervals: map[string]time.Duration{"hobby": time.Hour},
+	}
+	flagsWin := full
+	flagsWin.network, flagsWin.zone = "office", "us-central1"
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		args    []string
+		want    configured
+		wantErr bool
+	}{
+		{
+			name: "flags",
+			file: "gke-ip-update.conf",
+			content: `# one flag per line
+network-name=home
+interval 5m
+--keep-ips=2
+watch-network
+zone="europe-west1"
+cluster=prod
+cluster=hobby
+class=prod=critical
+cluster-interval=hobby=1h
+`,
+			want: full,
+		},
+		{
+			name: "yaml",
+			file: "gke-ip-update.yaml",
+			content: `network-name: home
+interval: 5m
+keep-ips: 2
+watch-network: true
+zone: europe-west1
+cluster:
+  - name: prod
+    class: critical
+  - name: hobby
+    interval: 1h
+`,
+			want: full,
+		},
+		{
+			name: "yaml maps and lists",
+			file: "gke-ip-update.yml",
+			content: `network_name: home
+interval: 5m
+keep-ips: 2
+watch-network: true
+location: europe-west1
+clusters: [prod, hobby]
+class:
+  prod: critical
+cluster-interval:
+  hobby: 1h
+`,
+			want: full,
+		},
+		{
+			name: "toml",
+			file: "gke-ip-update.toml",
+			content: `network-name = "home"
+interval = "5m"
+keep-ips = 2
+watch-network = true
+zone = "europe-west1"
+
+[[cluster]]
+name = "prod"
+class = "critical"
+
+[[cluster]]
+name = "hobby"
+interval = "1h"
+`,
+			want: full,
+		},
+		{
+			name: "command line wins",
+			file: "gke-ip-update.conf",
+			content: `network-name=home
+interval=5m
+keep-ips=2
+watch-network=true
+location=europe-west1
+cluster=prod
+cluster=hobby
+class=prod=critical
+cluster-interval=hobby=1h
+`,
+			args: []string{"--network-name", "office", "--zone", "us-central1"},
+			want: flagsWin,
+		},
+		{
+			name:    "unknown flag",
+			file:    "gke-ip-update.conf",
+			content: "no-such-flag=1\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown cluster setting",
+			file:    "gke-ip-update.yaml",
+			content: "cluster:\n  - name: prod\n    colour: blue\n",
+			wantErr: true,
+		},
+		{
+			name:    "cluster table without a name",
+			file:    "gke-ip-update.toml",
+			content: "[[cluster]]\nclass = \"critical\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid yaml",
+			file:    "gke-ip-update.yaml",
+			content: "network-name: [home\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			c := parseConfig(tt.args)
+			err := c.flags.loadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := configuredBy(c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadConfig() set %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+//why the IPs couldn't be found or the cluster couldn't be updated
+type failureClass string
+
+const (
+	noInternet      failureClass = "no internet"
+	noDNS           failureClass = "DNS failing"
+	servicesFailing failureClass = "services failing"
+)
+
+const (
+	//how long the probes of the connectivity may take
+	probeTimeout = 5 * time.Second
+	//how often the connectivity is probed during an outage
+	outageProbeInterval = 15 * time.Second
+)
+
+var (
+	//names resolved to check DNS
+	probeHosts = []string{"www.google.com", "one.one.one.one"}
+	//well-known endpoints dialed to check the connection, by IP so DNS doesn't matter
+	probeAddrs = []string{"8.8.8.8:53", "1.1.1.1:443", "[2001:4860:4860::8888]:53"}
+)
+
+//probe DNS and TCP connections to well-known endpoints to tell an outage of the machine's connection from services failing.
+//--connectivity-probe is also fetched through the transports of the IP check and the Google APIs, so a machine only
+//reaching out through --detect-proxy or --api-proxy isn't taken for offline.
+func (a *App) classifyFailure() failureClass {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	var lookups, dials []func(context.Context) error
+	for _, host := range probeHosts {
+		host := host
+		lookups = append(lookups, func(ctx context.Context) error {
+			_, err := net.DefaultResolver.LookupHost(ctx, host)
+			return err
+		})
+	}
+	for _, addr := range probeAddrs {
+		addr := addr
+		dials = append(dials, func(ctx context.Context) error {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		})
+	}
+	if a.ConnectivityProbe != "" {
+		for _, p := range []purpose{detection, googleAPIs} {
+			client := a.httpClient(p)
+			dials = append(dials, func(ctx context.Context) error {
+				req, err := http.NewRequest(http.MethodGet, a.ConnectivityProbe, nil)
+				if err != nil {
+					return err
+				}
+				resp, err := client.Do(req.WithContext(ctx))
+				if err == nil {
+					resp.Body.Close()
+				}
+				return err
+			})
+		}
+	}
+
+	dns := make(chan bool, 1)
+	go func() {
+		dns <- anyProbe(ctx, lookups)
+	}()
+	tcp := anyProbe(ctx, dials)
+	switch {
+	case !tcp:
+		return noInternet
+	case !<-dns:
+		return noDNS
+	}
+	return servicesFailing
+}
+
+//run the probes together, reporting whether one of them succeeded
+func anyProbe(ctx context.Context, probes []func(context.Context) error) bool {
+	ok := make(chan bool, len(probes))
+	for _, probe := range probes {
+		go func(probe func(context.Context) error) {
+			ok <- probe(ctx) == nil
+		}(probe)
+	}
+	for range probes {
+		if <-ok {
+			return true
+		}
+	}
+	return false
+}
+
+//record how a failed check or update was classified by the detector or the worker, notifying once when the
+//connectivity is lost. Reports whether it is, in which case the failure itself isn't alerted about.
+func (p *pipeline) connectivityLost(class failureClass) bool {
+	if class == servicesFailing {
+		p.connectivityRestored()
+		return false
+	}
+
+	if p.outage == "" {
+		p.outage, p.outageSince = class, time.Now()
+		message := fmt.Sprintf("Connectivity lost (%s), failed checks and updates aren't alerted about until it is restored", class)
+		p.app.writeLog(message + " \n")
+		p.app.notify("critical", message)
+		go p.awaitConnectivity()
+	}
+	return true
+}
+
+//probe the connectivity during an outage and check the IPs as soon as it is back, rather than waiting for the
+//detector which backed off
+func (p *pipeline) awaitConnectivity() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-time.After(outageProbeInterval):
+		}
+
+		if p.app.classifyFailure() == servicesFailing {
+			select {
+			case p.trigger <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
+}
+
+//notify the end of an outage and retry the updates which failed during it right away
+func (p *pipeline) connectivityRestored() {
+	if p.outage == "" {
+		return
+	}
+
+	outage := time.Since(p.outageSince)
+	p.app.writeLog(fmt.Sprintf("Connectivity restored after %s (%s) \n", logDuration(outage), p.outage))
+	p.app.notify("info", fmt.Sprintf("Connectivity restored after %s (%s)", humanDuration(outage), p.outage))
+	p.outage = ""
+
+	for _, t := range p.targets {
+		if t.failing && (p.held == nil || t.canary) {
+			t.submit(job{st: p.st.snapshot(), reason: "connectivity restored"})
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"gke-ip-update/updater"
+)
+
+//a short random ID tying together the logs, notifications and audit entries of a reconcile
+func newCorrelationID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+//a context for a new reconcile, carrying its correlation ID
+func reconcileContext(ctx context.Context) context.Context {
+	return updater.WithCorrelationID(ctx, newCorrelationID())
+}
+
+//write a log line of a reconcile, prefixed by its correlation ID
+func (a *App) writeRunLog(id, message string) {
+	if id == "" {
+		a.writeLog(message)
+		return
+	}
+	//the same error in consecutive reconciles is folded despite their IDs
+	a.appendLog(message, fmt.Sprintf("[%s] %s", id, message))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+//what is posted to --crash-webhook when part of the daemon panics
+type crashReport struct {
+	Host      string    `json:"host"`
+	Version   string    `json:"version"`
+	Time      time.Time `json:"time"`
+	Component string    `json:"component"`
+	Panic     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+}
+
+//run fn, restarting it after a panic until ctx is done, so a bug in one part of the daemon doesn't stop the updates
+//for good. The wait before a restart doubles while it keeps panicking.
+func (a *App) supervise(ctx context.Context, component string, fn func()) {
+	delay := 5 * time.Second
+	for a.recovered(component, fn) {
+		a.writeLog(fmt.Sprintf("Restarting the %s in %s \n", component, delay))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay < maxBackoff {
+			delay *= 2
+		}
+	}
+}
+
+//run fn, reporting whether it panicked
+func (a *App) recovered(component string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			a.reportCrash(component, r, debug.Stack())
+		}
+	}()
+
+	fn()
+	return false
+}
+
+//log the panic with its stack, notify it and post it to --crash-webhook
+func (a *App) reportCrash(component string, r interface{}, stack []byte) {
+	message := fmt.Sprintf("The %s crashed : %v", component, r)
+	a.writeLog(fmt.Sprintf("%s \n%s\n", message, stack))
+	a.notify("critical", message)
+
+	if a.CrashWebhook == "" {
+		return
+	}
+	host, _ := os.Hostname()
+	body, err := json.Marshal(crashReport{Host: host, Version: version, Time: time.Now(), Component: component, Panic: fmt.Sprint(r), Stack: string(stack)})
+	if err != nil {
+		return
+	}
+	resp, err := a.httpClient(outbound).Post(a.CrashWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		a.writeLog(fmt.Sprintf("Unable to send the crash report : %s \n", err.Error()))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		a.writeLog(fmt.Sprintf("Unable to send the crash report : %s \n", resp.Status))
+	}
+}
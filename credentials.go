@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/container/v1"
+)
+
+const iamCredentialsAPI = "https://iamcredentials.googleapis.com/v1"
+
+//a source of credentials of --credentials : key:<file>, impersonate:<service account> or adc
+type credentialSource struct {
+	kind  string
+	value string
+}
+
+func (s credentialSource) String() string {
+	if s.value == "" {
+		return s.kind
+	}
+	return s.kind + ":" + s.value
+}
+
+//--credentials flags, tried in order
+type credentialFlags []credentialSource
+
+func (c *credentialFlags) String() string {
+	var specs []string
+	for _, s := range *c {
+		specs = append(specs, s.String())
+	}
+	return strings.Join(specs, ",")
+}
+
+func (c *credentialFlags) Set(value string) error {
+	for _, spec := range strings.Split(value, ",") {
+		kind, v := strings.TrimSpace(spec), ""
+		if i := strings.Index(kind, ":"); i >= 0 {
+			kind, v = kind[:i], kind[i+1:]
+		}
+		switch {
+		case kind == "adc" && v == "":
+		case (kind == "key" || kind == "impersonate") && v != "":
+		default:
+			return fmt.Errorf("expected key:<file>, impersonate:<service account> or adc, got %q", spec)
+		}
+		*c = append(*c, credentialSource{kind: kind, value: v})
+	}
+	return nil
+}
+
+//the token source of a credential source. A source that can't be set up fails when a token is asked for,
+//so the next one is tried.
+func (a *App) credentialTokenSource(ctx context.Context, s credentialSource) oauth2.TokenSource {
+	var ts oauth2.TokenSource
+	var err error
+	switch s.kind {
+	case "key":
+		var data []byte
+		if data, err = ioutil.ReadFile(s.value); err == nil {
+			var creds *google.Credentials
+			if creds, err = google.CredentialsFromJSON(a.tokenContext(ctx), data, container.CloudPlatformScope); err == nil {
+				ts = creds.TokenSource
+			}
+		}
+	case "impersonate":
+		var base oauth2.TokenSource
+		if base, err = google.DefaultTokenSource(a.tokenContext(ctx), container.CloudPlatformScope); err == nil {
+			ts = &impersonatedTokenSource{app: a, ctx: ctx, base: base, account: s.value}
+		}
+	default:
+		ts, err = google.DefaultTokenSource(a.tokenContext(ctx), container.CloudPlatformScope)
+	}
+	if err != nil {
+		return failingTokenSource{err}
+	}
+	return ts
+}
+
+type failingTokenSource struct {
+	err error
+}
+
+func (f failingTokenSource) Token() (*oauth2.Token, error) {
+	return nil, f.err
+}
+
+//access tokens of a service account, issued by the IAM Credentials API to the application default credentials
+//which need roles/iam.serviceAccountTokenCreator on it
+type impersonatedTokenSource struct {
+	app     *App
+	ctx     context.Context
+	base    oauth2.TokenSource
+	account string
+}
+
+func (s *impersonatedTokenSource) Token() (*oauth2.Token, error) {
+	body, err := json.Marshal(map[string]interface{}{"scope": []string{container.CloudPlatformScope}, "lifetime": "3600s"})
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/projects/-/serviceAccounts/%s:generateAccessToken", iamCredentialsAPI, s.account)
+	client := oauth2.NewClient(context.WithValue(s.ctx, oauth2.HTTPClient, s.app.httpClient(googleAPIs)), s.base)
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, &apiError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(msg)}
+	}
+	var t struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: t.AccessToken, TokenType: "Bearer", Expiry: t.ExpireTime}, nil
+}
+
+//tries the sources of --credentials in order, so an expired key on one path doesn't stop the app.
+//The source that worked is logged when it changes and published in the status.
+type chainTokenSource struct {
+	app     *App
+	names   []string
+	sources []oauth2.TokenSource
+	mu      sync.Mutex
+	used    int
+}
+
+func (a *App) newChainTokenSource(ctx context.Context) *chainTokenSource {
+	c := &chainTokenSource{app: a, used: -1}
+	for _, s := range a.Credentials {
+		c.names = append(c.names, s.String())
+		c.sources = append(c.sources, a.credentialTokenSource(ctx, s))
+	}
+	return c
+}
+
+func (c *chainTokenSource) Token() (*oauth2.Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []string
+	for i, s := range c.sources {
+		t, err := s.Token()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s : %s", c.names[i], err.Error()))
+			continue
+		}
+
+		if i != c.used {
+			c.used = i
+			c.app.status.set(func(s *appStatus) {
+				s.Credentials = c.names[i]
+			})
+			if len(errs) == 0 {
+				c.app.writeLog(fmt.Sprintf("Authenticated with %s \n", c.names[i]))
+			} else {
+				message := fmt.Sprintf("Authenticated with %s after the credentials before it failed : %s", c.names[i], strings.Join(errs, ", "))
+				c.app.writeLog(message + " \n")
+				c.app.notify("warning", message)
+			}
+		}
+		return t, nil
+	}
+	return nil, errors.New("none of the credentials worked : " + strings.Join(errs, ", "))
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+
+	"gke-ip-update/updater"
+
+	"google.golang.org/api/container/v1"
+)
+
+//a network imported from a CSV file, kept in the cluster along with the entries of the app
+type staticEntry struct {
+	Name  string `json:"name"`
+	CIDR  string `json:"cidr"`
+	Owner string `json:"owner,omitempty"`
+}
+
+//read the networks of the cluster
+func (a *App) clusterNetworks(ctx context.Context) ([]*container.CidrBlock, error) {
+	a.setCreds(a.CredentialPath)
+	if err := a.resolveZone(); err != nil {
+		return nil, err
+	}
+	cluster := updater.Cluster{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}
+	containerService, err := a.newContainerService(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	c, err := updater.GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if c.MasterAuthorizedNetworksConfig == nil {
+		return nil, nil
+	}
+	return c.MasterAuthorizedNetworksConfig.CidrBlocks, nil
+}
+
+//write the networks of the cluster to --file as name,cidr,owner, stdout when it is -
+func (a *App) exportNetworks() {
+	blocks, err := a.clusterNetworks(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	st := a.loadState()
+
+	out := io.Writer(os.Stdout)
+	if a.CSVFile != "-" {
+		f, err := os.Create(a.CSVFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := csv.NewWriter(out)
+	w.Write([]string{"name", "cidr", "owner"})
+	for _, b := range blocks {
+		name, meta := parseDisplayName(b.DisplayName)
+		owner := meta.Owner
+		for _, s := range st.Static {
+			if s.Name == name && owner == "" {
+				owner = s.Owner
+			}
+		}
+		w.Write([]string{name, b.CidrBlock, owner})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatal(err)
+	}
+	if a.CSVFile != "-" {
+		fmt.Fprintf(os.Stderr, "Exported %d networks to %s\n", len(blocks), a.CSVFile)
+	}
+}
+
+//make --file the networks of the cluster along with the entries of the app. Prints the changes it leads to,
+//records it with --apply for a running app or the next --once run to reconcile the cluster.
+//Networks the app maintains itself, like the current IP, are skipped.
+func (a *App) importNetworks() {
+	if a.NoState {
+		log.Fatal("import records the networks in the state, it can't be used with --no-state")
+	}
+
+	st := a.loadState()
+	if a.Release {
+		st.Static, st.Imported = nil, false
+		if a.Apply {
+			a.saveState(st)
+			fmt.Println("The imported networks are no longer managed, they stay in the cluster as they are")
+		} else {
+			fmt.Println("Run again with --apply to stop managing the imported networks.")
+		}
+		return
+	}
+
+	static, err := a.readNetworks(a.CSVFile, st)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.Static, st.Imported = static, true
+
+	existing, err := a.clusterNetworks(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, change := updater.Plan(existing, st.entries(), st.managed)
+	for _, b := range change.Added {
+		fmt.Printf("+ %s\n", b.DisplayName+"="+b.CidrBlock)
+	}
+	for _, b := range change.Removed {
+		fmt.Printf("- %s\n", b.DisplayName+"="+b.CidrBlock)
+	}
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		fmt.Println("The cluster already matches the file")
+	}
+
+	if !a.Apply {
+		fmt.Println("\nRun again with --apply to import the networks.")
+		return
+	}
+	a.saveState(st)
+	a.writeLog(fmt.Sprintf("Imported %d networks from %s \n", len(static), a.CSVFile))
+	fmt.Printf("Imported %d networks, a running app reconciles the cluster on its next check\n", len(static))
+}
+
+//read the rows name,cidr[,owner] of a CSV file, the header being optional
+func (a *App) readNetworks(path string, st *state) ([]staticEntry, error) {
+	in := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var static []staticEntry
+	names := map[string]bool{}
+	for i, record := range records {
+		if len(record) < 2 || i == 0 && strings.EqualFold(record[0], "name") {
+			continue
+		}
+		s := staticEntry{Name: strings.TrimSpace(record[0]), CIDR: strings.TrimSpace(record[1])}
+		if len(record) > 2 {
+			s.Owner = strings.TrimSpace(record[2])
+		}
+
+		if st.dynamic(s.Name) {
+			fmt.Printf("Skipping %s, the app maintains it\n", s.Name)
+			continue
+		}
+		if s.Name == "" || len(s.Name) > maxDisplayName {
+			return nil, fmt.Errorf("line %d : the name must have 1 to %d characters", i+1, maxDisplayName)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("line %d : %s is listed twice", i+1, s.Name)
+		}
+		names[s.Name] = true
+
+		if !strings.Contains(s.CIDR, "/") {
+			s.CIDR += "/32"
+		}
+		ip, network, err := net.ParseCIDR(s.CIDR)
+		if err != nil || ip.To4() == nil {
+			return nil, fmt.Errorf("line %d : %q isn't an IPv4 network", i+1, record[1])
+		}
+		s.CIDR = network.String()
+		static = append(static, s)
+	}
+
+	if len(static) > maxClusterNetworks {
+		return nil, fmt.Errorf("%s lists %d networks, more than the %d a cluster takes", path, len(static), maxClusterNetworks)
+	}
+	return static, nil
+}
+
+//pick up the networks imported since the app started or last checked. Reports whether they changed.
+func (st *state) admitStatic(recorded *state) bool {
+	if recorded.Imported == st.Imported && reflect.DeepEqual(recorded.Static, st.Static) {
+		return false
+	}
+
+	st.Static, st.Imported = recorded.Static, recorded.Imported
+	st.app.writeLog(fmt.Sprintf("Imported networks changed, %d networks \n", len(st.Static)))
+	return true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadNetworks(t *testing.T) {
+	var tooMany []string
+	for i := 0; i <= maxClusterNetworks; i++ {
+		tooMany = append(tooMany, fmt.Sprintf("office-%d,10.0.%d.0/24", i, i))
+	}
+
+	tests := []struct {
+		name   string
+		csv    string
+		static []staticEntry
+		err    string
+	}{
+		{
+			name: "header, owners and networks normalized",
+			csv:  "name,cidr,owner\noffice, 198.51.100.7/24 ,alice\nvpn,203.0.113.9\n",
+			static: []staticEntry{
+				{Name: "office", CIDR: "198.51.100.0/24", Owner: "alice"},
+				{Name: "vpn", CIDR: "203.0.113.9/32"},
+			},
+		},
+		{
+			name:   "networks of the app skipped",
+			csv:    "home,192.0.2.1\noffice,198.51.100.0/24\n",
+			static: []staticEntry{{Name: "office", CIDR: "198.51.100.0/24"}},
+		},
+		{
+			name:   "short rows skipped",
+			csv:    "comment\noffice,198.51.100.0/24\n",
+			static: []staticEntry{{Name: "office", CIDR: "198.51.100.0/24"}},
+		},
+		{name: "empty name", csv: ",198.51.100.0/24\n", err: "line 1 : the name must have"},
+		{name: "name too long", csv: strings.Repeat("n", maxDisplayName+1) + ",198.51.100.0/24\n", err: "line 1 : the name must have"},
+		{name: "name listed twice", csv: "office,198.51.100.0/24\noffice,203.0.113.0/24\n", err: "line 2 : office is listed twice"},
+		{name: "IPv6", csv: "office,2001:db8::/32\n", err: `line 1 : "2001:db8::/32" isn't an IPv4 network`},
+		{name: "invalid network", csv: "office,198.51.100.0/33\n", err: "isn't an IPv4 network"},
+		{name: "malformed csv", csv: "office,\"198.51.100.0/24\n", err: "extraneous"},
+		{name: "more networks than a cluster takes", csv: strings.Join(tooMany, "\n"), err: "more than the"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "networks-*.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			f.WriteString(tt.csv)
+			f.Close()
+
+			a := newTestApp(t, "--network-name", "home")
+			st := &state{IPs: map[string]string{"home": "192.0.2.1"}, app: a}
+			static, err := a.readNetworks(f.Name(), st)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(static, tt.static) {
+				t.Errorf("got %+v, want %+v", static, tt.static)
+			}
+		})
+	}
+}
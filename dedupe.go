@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"gke-ip-update/updater"
+)
+
+//list the networks of the cluster authorizing the same CIDR more than once, after manual edits for instance,
+//and remove the duplicates with --apply. The network maintained by the app is kept when there is one.
+func (a *App) dedupe() {
+	ctx := context.Background()
+	a.setCreds(a.CredentialPath)
+	if err := a.resolveZone(); err != nil {
+		log.Fatal(err)
+	}
+
+	cluster := updater.Cluster{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}
+	containerService, err := a.newContainerService(ctx, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := updater.GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.MasterAuthorizedNetworksConfig == nil || !c.MasterAuthorizedNetworksConfig.Enabled {
+		//updating the networks would enable them
+		fmt.Printf("Master authorized networks are disabled on %s\n", cluster.Name)
+		return
+	}
+
+	st := a.loadState()
+	kept, duplicates := updater.Consolidate(c.MasterAuthorizedNetworksConfig.CidrBlocks, st.managed)
+	if len(duplicates) == 0 {
+		fmt.Println("No duplicate networks")
+		return
+	}
+
+	for _, k := range kept {
+		var names []string
+		for _, d := range duplicates {
+			if d.CidrBlock == k.CidrBlock {
+				names = append(names, fmt.Sprintf("%q", d.DisplayName))
+			}
+		}
+		if len(names) > 0 {
+			fmt.Printf("%-18s keep %q, remove %v\n", k.CidrBlock, k.DisplayName, names)
+		}
+	}
+
+	if !a.Apply {
+		fmt.Println("\nRun again with --apply to remove the duplicates.")
+		return
+	}
+	if c.Status != "RUNNING" {
+		log.Fatal(&updater.NotRunningError{Cluster: cluster.Name, Status: c.Status, Message: c.StatusMessage})
+	}
+
+	op, err := updater.SetCidrBlocks(ctx, containerService, cluster, kept)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Waiting for operation %s\n", op.Name)
+	report := func(message string) {
+		fmt.Println(message)
+	}
+	if err := a.waitOperation(ctx, containerService, cluster, op, st, report); err != nil {
+		log.Fatal(err)
+	}
+	a.saveState(st)
+
+	a.writeLog(fmt.Sprintf("Removed %d duplicate networks from %s : %v \n", len(duplicates), cluster.Name, describeBlocks(duplicates)))
+	fmt.Printf("Removed %d duplicate networks\n", len(duplicates))
+}
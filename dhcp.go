@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+//how often the lease file is read
+const leasePollInterval = 5 * time.Second
+
+//trigger a check when the DHCP lease file given with --dhcp-lease changes, for servers getting their public IP
+//straight from DHCP. The file is polled rather than watched, the clients replacing it in different ways.
+func (a *App) watchLease(ctx context.Context, trigger chan<- struct{}) {
+	last, err := readLease(a.DHCPLease)
+	if err != nil {
+		a.writeLog(fmt.Sprintf("Unable to read the DHCP lease %s : %s \n", a.DHCPLease, err.Error()))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(leasePollInterval):
+		}
+
+		lease, err := readLease(a.DHCPLease)
+		if err != nil || bytes.Equal(lease, last) {
+			continue
+		}
+		last = lease
+		a.writeLog(fmt.Sprintf("DHCP lease %s changed, checking the IPs \n", a.DHCPLease))
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+//the content of the lease file, empty while there is none
+func readLease(path string) ([]byte, error) {
+	lease, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []byte{}, nil
+	}
+	return lease, err
+}
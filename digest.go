@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+//order of the levels, the level of a digest is the highest of its events
+var levels = map[string]int{"info": 0, "warning": 1, "error": 2, "critical": 3}
+
+//events held back by --notify-digest, sent as a single notification at the end of the window
+type pendingDigest struct {
+	mu     sync.Mutex
+	events []event
+	timer  *time.Timer
+}
+
+//hold back an event for the digest, starting a window if none is open.
+//Critical events and the ones of commands exiting before the window ends aren't held back.
+func (a *App) addToDigest(e event) bool {
+	if a.DigestWindow <= 0 || e.Level == "critical" || !a.keepsRunning {
+		return false
+	}
+
+	a.digest.mu.Lock()
+	defer a.digest.mu.Unlock()
+	a.digest.events = append(a.digest.events, e)
+	if a.digest.timer == nil {
+		a.digest.timer = time.AfterFunc(a.DigestWindow, a.flushDigest)
+	}
+	return true
+}
+
+//send the events held back, as they are when there is only one
+func (a *App) flushDigest() {
+	a.digest.mu.Lock()
+	events := a.digest.events
+	a.digest.events = nil
+	if a.digest.timer != nil {
+		a.digest.timer.Stop()
+		a.digest.timer = nil
+	}
+	a.digest.mu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+	e := events[0]
+	if len(events) > 1 {
+		e = event{Level: e.Level, Host: e.Host, Owner: e.Owner}
+		lines := []string{fmt.Sprintf("%d events since %s :", len(events), events[0].Time.In(a.displayZone).Format("15:04"))}
+		for _, d := range events {
+			if levels[d.Level] > levels[e.Level] {
+				e.Level = d.Level
+			}
+			lines = append(lines, fmt.Sprintf("%s [%s] %s", d.Time.In(a.displayZone).Format("15:04"), d.Level, d.Message))
+		}
+		e.Message = strings.Join(lines, "\n")
+		e.Time = time.Now()
+	}
+
+	a.send(e)
+}
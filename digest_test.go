@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDigest(t *testing.T) {
+	type notification struct {
+		level string
+		text  string
+	}
+	tests := []struct {
+		name         string
+		args         []string
+		oneShot      bool
+		notify       []notification
+		sent         []string
+		digestLevel  string
+		digestEvents int
+	}{
+		{
+			name:   "no digest",
+			notify: []notification{{"info", "ip changed"}, {"warning", "update failed"}},
+			sent:   []string{"ip changed", "update failed"},
+		},
+		{
+			name:         "batched, the highest level kept",
+			args:         []string{"--notify-digest", "1h"},
+			notify:       []notification{{"info", "ip changed"}, {"error", "update failed"}, {"warning", "ranges kept"}},
+			digestLevel:  "error",
+			digestEvents: 3,
+		},
+		{
+			name:         "critical sent right away",
+			args:         []string{"--notify-digest", "1h"},
+			notify:       []notification{{"info", "ip changed"}, {"critical", "state tampered"}},
+			sent:         []string{"state tampered"},
+			digestLevel:  "info",
+			digestEvents: 1,
+		},
+		{
+			name:    "one-shot runs not held back",
+			args:    []string{"--notify-digest", "1h"},
+			oneShot: true,
+			notify:  []notification{{"info", "ip changed"}},
+			sent:    []string{"ip changed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var received []event
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var e event
+				if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+					t.Error(err)
+				}
+				mu.Lock()
+				received = append(received, e)
+				mu.Unlock()
+			}))
+			defer srv.Close()
+
+			a := newTestApp(t, append([]string{"--notify-webhook", srv.URL}, tt.args...)...)
+			a.keepsRunning = !tt.oneShot
+			for _, n := range tt.notify {
+				a.notify(n.level, n.text)
+			}
+			mu.Lock()
+			var sent []string
+			for _, e := range received {
+				sent = append(sent, e.Message)
+			}
+			received = nil
+			mu.Unlock()
+			if strings.Join(sent, "|") != strings.Join(tt.sent, "|") {
+				t.Errorf("sent %q right away, want %q", sent, tt.sent)
+			}
+
+			a.flushDigest()
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.digestEvents == 0 {
+				if len(received) > 0 {
+					t.Errorf("got digest %+v, want none", received)
+				}
+				return
+			}
+			if len(received) != 1 {
+				t.Fatalf("got %d digests, want 1", len(received))
+			}
+			d := received[0]
+			if d.Level != tt.digestLevel {
+				t.Errorf("got digest level %q, want %q", d.Level, tt.digestLevel)
+			}
+			if tt.digestEvents > 1 && !strings.HasPrefix(d.Message, fmt.Sprintf("%d events since", tt.digestEvents)) {
+				t.Errorf("got digest %q, want %d events", d.Message, tt.digestEvents)
+			}
+			if tt.digestEvents == 1 && d.Message != tt.notify[0].text {
+				t.Errorf("got digest %q, want the single event as it is", d.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//--declare flags, name=cidr for a fixed network or only a name for an entry with any CIDR,
+//like the ones maintained by the app along with their -prevN entries
+type declaredFlags []string
+
+func (d *declaredFlags) String() string {
+	return strings.Join(*d, ",")
+}
+
+func (d *declaredFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if parts[0] == "" {
+		return fmt.Errorf("expected name or name=cidr, got %q", value)
+	}
+	if len(parts) == 2 {
+		if _, _, err := net.ParseCIDR(parts[1]); err != nil {
+			return err
+		}
+	}
+
+	*d = append(*d, value)
+	return nil
+}
+
+//check whether a name=cidr network is declared
+func (d declaredFlags) declared(network string) bool {
+	parts := strings.SplitN(network, "=", 2)
+	name, _ := parseDisplayName(parts[0])
+	network = name + "=" + parts[len(parts)-1]
+	for _, decl := range d {
+		if decl == network || !strings.Contains(decl, "=") && isEntry(name, decl) {
+			return true
+		}
+	}
+	return false
+}
+
+//the added networks that weren't declared, nil when nothing is declared
+func (a *App) undeclared(added []string) []string {
+	if len(a.Declared) == 0 {
+		return nil
+	}
+
+	var u []string
+	for _, n := range added {
+		if !a.Declared.declared(n) {
+			u = append(u, n)
+		}
+	}
+	return u
+}
+
+//report networks that appeared without being declared, with who updated the cluster since the last check
+//when the audit logs can be read. since is zero for networks found on the first check.
+func (a *App) reportDrift(ctx context.Context, cluster updater.Cluster, networks []string, since time.Time) {
+	message := fmt.Sprintf("Undeclared networks appeared on %s : %v", cluster.Name, networks)
+	if since.IsZero() {
+		a.writeLog(message + " \n")
+		a.notify("critical", message)
+		return
+	}
+
+	who, err := a.whoUpdated(ctx, cluster, since)
+	if err != nil {
+		a.writeLog(fmt.Sprintf("Unable to read who updated the cluster from the audit logs : %s \n", err.Error()))
+	} else if len(who) > 0 {
+		message += fmt.Sprintf(", the cluster was updated by %s", strings.Join(who, ", "))
+	}
+
+	a.writeLog(message + " \n")
+	a.notify("critical", message)
+}
+
+//principals that updated the cluster since the given time, from the Admin Activity audit logs.
+//Needs logging.logEntries.list on the project.
+func (a *App) whoUpdated(ctx context.Context, cluster updater.Cluster, since time.Time) ([]string, error) {
+	filter := fmt.Sprintf(`resource.type="gke_cluster" AND resource.labels.cluster_name=%q AND protoPayload.methodName:"ClusterManager.UpdateCluster" AND timestamp>=%q`,
+		cluster.Name, since.UTC().Format(time.RFC3339))
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceNames": []string{"projects/" + cluster.Project},
+		"filter":        filter,
+		"orderBy":       "timestamp desc",
+		"pageSize":      20,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Entries []struct {
+			ProtoPayload struct {
+				AuthenticationInfo struct {
+					PrincipalEmail string `json:"principalEmail"`
+				} `json:"authenticationInfo"`
+			} `json:"protoPayload"`
+		} `json:"entries"`
+	}
+	if err := a.callAPI(ctx, http.MethodPost, loggingAPI+":list", body, &resp); err != nil {
+		return nil, err
+	}
+
+	var who []string
+	seen := map[string]bool{}
+	for _, e := range resp.Entries {
+		email := e.ProtoPayload.AuthenticationInfo.PrincipalEmail
+		if email != "" && !seen[email] {
+			seen[email] = true
+			who = append(who, email)
+		}
+	}
+	return who, nil
+}
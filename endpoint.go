@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gke-ip-update/updater"
+)
+
+//--api-endpoint flags, region or cluster=region to pin the GKE API calls of every cluster or of one to a regional
+//endpoint. The region may be auto for the one of the cluster, or a full URL.
+type endpointFlags map[string]string
+
+func (e endpointFlags) String() string {
+	var specs []string
+	for cluster, region := range e {
+		if cluster == "" {
+			specs = append(specs, region)
+		} else {
+			specs = append(specs, cluster+"="+region)
+		}
+	}
+	return strings.Join(specs, ",")
+}
+
+func (e endpointFlags) Set(value string) error {
+	cluster, region := "", value
+	if i := strings.LastIndex(value, "="); i >= 0 {
+		cluster, region = value[:i], value[i+1:]
+	}
+	if region == "" || strings.ContainsAny(region, " /") && !strings.HasPrefix(region, "https://") {
+		return fmt.Errorf("expected region, auto or an https:// URL, got %q", region)
+	}
+	e[cluster] = region
+	return nil
+}
+
+//the GKE API endpoint for a cluster, empty for the global one
+func (a *App) containerEndpoint(context string, c updater.Cluster) string {
+	region, ok := "", false
+	for spec, r := range a.APIEndpoints {
+		if spec != "" && matchesCluster(spec, context, c) {
+			region, ok = r, true
+			break
+		}
+	}
+	if !ok {
+		region = a.APIEndpoints[""]
+	}
+
+	switch {
+	case region == "auto":
+		//the zone isn't known yet while looking the cluster up
+		if region = regionOf(c.Zone); region == "" {
+			return ""
+		}
+	case region == "":
+		return ""
+	case strings.HasPrefix(region, "https://"):
+		return strings.TrimSuffix(region, "/") + "/"
+	}
+	return "https://" + region + "-container.googleapis.com/"
+}
+
+//the region of a zone like us-central1-a, or the location itself when it is a region
+func regionOf(location string) string {
+	if strings.Count(location, "-") == 2 {
+		return location[:strings.LastIndex(location, "-")]
+	}
+	return location
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//subsystems shipped dark, enabled one by one with --experimental by early adopters. Their flags and behaviour may
+//change or go away between releases. Keyed by name, with what they do.
+var experiments = map[string]string{
+	"fleet": "find the cluster from its fleet membership with --fleet-membership",
+}
+
+//--experimental flags, given as name or name=false, comma separated or repeated
+type experimentFlags map[string]bool
+
+func (e experimentFlags) String() string {
+	return strings.Join(e.enabled(), ",")
+}
+
+func (e experimentFlags) Set(value string) error {
+	for _, spec := range strings.Split(value, ",") {
+		name, enabled := strings.TrimSpace(spec), true
+		if i := strings.Index(name, "="); i >= 0 {
+			b, err := strconv.ParseBool(name[i+1:])
+			if err != nil {
+				return fmt.Errorf("expected name or name=true|false, got %q", spec)
+			}
+			name, enabled = name[:i], b
+		}
+		if _, ok := experiments[name]; !ok {
+			return fmt.Errorf("unknown experiment %q, available : %s", name, availableExperiments())
+		}
+		e[name] = enabled
+	}
+	return nil
+}
+
+//the names of the enabled experiments, sorted
+func (e experimentFlags) enabled() []string {
+	var names []string
+	for name, on := range e {
+		if on {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func availableExperiments() string {
+	if len(experiments) == 0 {
+		return "none"
+	}
+	var names []string
+	for name, description := range experiments {
+		names = append(names, name+" ("+description+")")
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+//whether the experiment was enabled with --experimental
+func (c *Config) experimental(name string) bool {
+	return c.Experimental[name]
+}
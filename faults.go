@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//faults injected into updates to try the retries, notifications and --max-failures before trusting them.
+//Enabled with the hidden --fail-update-every and --inject-latency flags.
+type injectedFaults struct {
+	mu      sync.Mutex
+	updates int
+}
+
+//wait --inject-latency, then fail every --fail-update-every update
+func (a *App) injectFault(ctx context.Context) error {
+	if a.InjectLatency > 0 {
+		select {
+		case <-time.After(a.InjectLatency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if a.FailUpdateEvery <= 0 {
+		return nil
+	}
+
+	a.faults.mu.Lock()
+	defer a.faults.mu.Unlock()
+	a.faults.updates++
+	if a.faults.updates%a.FailUpdateEvery == 0 {
+		return fmt.Errorf("injected failure of update %d", a.faults.updates)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"gke-ip-update/updater"
+)
+
+//the flags of a Config, parsed from its own set so several configs can be parsed in the same process
+type flagSet struct {
+	*flag.FlagSet
+	//flag names that are only other spellings of a flag, keyed by alias
+	aliases map[string]string
+	//flags left out of the usage, for testing and development
+	hidden map[string]bool
+}
+
+func newFlagSet() *flagSet {
+	fs := &flagSet{FlagSet: flag.NewFlagSet("gke-ip-update", flag.ExitOnError), aliases: map[string]string{}, hidden: map[string]bool{}}
+	fs.Usage = fs.usage
+	return fs
+}
+
+//leave flags out of the usage
+func (fs *flagSet) hide(names ...string) {
+	for _, name := range names {
+		fs.hidden[name] = true
+	}
+}
+
+//a spelling of another flag that sets the same value
+type aliasValue struct {
+	flag.Value
+	name       string
+	target     string
+	deprecated bool
+}
+
+func (a *aliasValue) Set(value string) error {
+	if a.deprecated {
+		log.Printf("--%s is deprecated, use --%s instead", a.name, a.target)
+	}
+	return a.Value.Set(value)
+}
+
+func (a *aliasValue) IsBoolFlag() bool {
+	b, ok := a.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+//register name as another spelling of the target flag, warning when it's used if it's deprecated
+func (fs *flagSet) alias(name, target string, deprecated bool) {
+	f := fs.Lookup(target)
+	if f == nil {
+		panic("alias for unknown flag " + target)
+	}
+
+	fs.Var(&aliasValue{Value: f.Value, name: name, target: target, deprecated: deprecated}, name, "")
+	fs.aliases[name] = target
+}
+
+//accept the snake_case spelling of every kebab-case flag as a deprecated alias
+func (fs *flagSet) normalize() {
+	var snake []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := fs.aliases[f.Name]; !ok && strings.Contains(f.Name, "-") {
+			snake = append(snake, f.Name)
+		}
+	})
+
+	for _, name := range snake {
+		alias := strings.Replace(name, "-", "_", -1)
+		if fs.Lookup(alias) == nil {
+			fs.alias(alias, name, true)
+		}
+	}
+}
+
+//print the flags without their aliases
+func (fs *flagSet) usage() {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage: gke-ip-update [bootstrap|pause|resume|status|observe|gate|iam-setup|iap-setup|dedupe|lint-config|check|prompt|history|allow|approve|reject|note|import|export|manage|observability export|echo-server|install-service|uninstall-service|version] [flags]\n\nFlags:\n")
+
+	aliases := map[string][]string{}
+	for alias, target := range fs.aliases {
+		aliases[target] = append(aliases[target], alias)
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := fs.aliases[f.Name]; ok || fs.hidden[f.Name] {
+			return
+		}
+
+		name, help := flag.UnquoteUsage(f)
+		fmt.Fprintf(out, "  --%s", f.Name)
+		if name != "" {
+			fmt.Fprintf(out, " %s", name)
+		}
+		fmt.Fprintf(out, "\n    \t%s", help)
+		if name == "string" && f.DefValue != "" {
+			fmt.Fprintf(out, " (default %q)", f.DefValue)
+		} else if name != "string" && f.DefValue != "" && f.DefValue != "0" && f.DefValue != "0s" && f.DefValue != "false" {
+			fmt.Fprintf(out, " (default %s)", f.DefValue)
+		}
+		for _, alias := range aliases[f.Name] {
+			if !strings.Contains(alias, "_") {
+				fmt.Fprintf(out, " (also --%s)", alias)
+			}
+		}
+		fmt.Fprintln(out)
+	})
+}
+
+//--priority flags, clusters reconciled first in the order given
+type priorityFlags []string
+
+func (p *priorityFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *priorityFlags) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*p = append(*p, v)
+		}
+	}
+	return nil
+}
+
+//position of a cluster in --priority, given by its name, its full name or the name of its context.
+//Clusters that aren't listed come last, with len(priorities).
+func (a *App) priorityRank(context string, c updater.Cluster) int {
+	for i, p := range a.Priorities {
+		if matchesCluster(p, context, c) {
+			return i
+		}
+	}
+	return len(a.Priorities)
+}
+
+//order in which clusters are reconciled: by class, then by --priority
+func (a *App) clusterRank(context string, c updater.Cluster) int {
+	return a.classOf(context, c).rank*(len(a.Priorities)+2) + a.priorityRank(context, c)
+}
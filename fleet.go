@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const gkeHubAPI = "https://gkehub.googleapis.com/v1"
+
+//a fleet membership as answered by the GKE Hub API, with the kind of cluster it stands for
+type membership struct {
+	Name     string `json:"name"`
+	Endpoint struct {
+		GKECluster *struct {
+			ResourceLink   string `json:"resourceLink"`
+			ClusterMissing bool   `json:"clusterMissing"`
+		} `json:"gkeCluster"`
+		OnPremCluster *struct {
+			ResourceLink string `json:"resourceLink"`
+			ClusterType  string `json:"clusterType"`
+		} `json:"onPremCluster"`
+		MultiCloudCluster *struct {
+			ResourceLink string `json:"resourceLink"`
+		} `json:"multiCloudCluster"`
+		EdgeCluster        *struct{} `json:"edgeCluster"`
+		ApplianceCluster   *struct{} `json:"applianceCluster"`
+		KubernetesMetadata *struct{} `json:"kubernetesMetadata"`
+	} `json:"endpoint"`
+}
+
+//the kind of cluster the membership stands for, when it isn't a GKE one
+func (m membership) kind() string {
+	e := m.Endpoint
+	switch {
+	case e.OnPremCluster != nil:
+		return "on-prem (" + strings.ToLower(e.OnPremCluster.ClusterType) + ")"
+	case e.MultiCloudCluster != nil:
+		return "multi-cloud"
+	case e.EdgeCluster != nil:
+		return "edge"
+	case e.ApplianceCluster != nil:
+		return "appliance"
+	}
+	return "attached"
+}
+
+//point --cluster at the GKE cluster of --fleet-membership. Only GKE members have master authorized networks,
+//the access to the API server of attached, on-prem and multi-cloud clusters is configured outside GKE.
+func (a *App) resolveMembership(ctx context.Context) error {
+	if !a.experimental("fleet") {
+		return errors.New("--fleet-membership needs --experimental fleet")
+	}
+	if a.ClusterID != "" {
+		return errors.New("give either --cluster or --fleet-membership")
+	}
+
+	name := a.FleetMembership
+	if !strings.HasPrefix(name, "projects/") {
+		if a.ProjectID == "" {
+			return errors.New("--fleet-membership needs --project unless given as projects/p/locations/l/memberships/m")
+		}
+		name = fmt.Sprintf("projects/%s/locations/global/memberships/%s", a.ProjectID, name)
+	}
+
+	a.setCreds(a.CredentialPath)
+	var m membership
+	if err := a.callAPI(ctx, http.MethodGet, gkeHubAPI+"/"+name, nil, &m); err != nil {
+		if e, ok := err.(*apiError); ok && e.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("no fleet membership %s", name)
+		}
+		return err
+	}
+
+	gke := m.Endpoint.GKECluster
+	if gke == nil {
+		return fmt.Errorf("fleet membership %s isn't a GKE cluster (%s), it has no master authorized networks in GKE : restrict the access to its API server where it runs", name, m.kind())
+	}
+	if gke.ClusterMissing {
+		return fmt.Errorf("the GKE cluster of fleet membership %s no longer exists", name)
+	}
+
+	a.ClusterID = strings.TrimPrefix(gke.ResourceLink, "//container.googleapis.com/")
+	a.writeLog(fmt.Sprintf("Fleet membership %s is the cluster %s \n", name, a.ClusterID))
+	return nil
+}
@@ -0,0 +1,30 @@
+//Package forwarded reads the client IP of a request from the X-Forwarded-For header Google Cloud appends to.
+//The Google front end of Cloud Run and Cloud Functions appends the client, a GCP HTTP(S) Load Balancer appends
+//"<client>, <load balancer>". What comes before is whatever the client sent, so the IP is read from the end.
+package forwarded
+
+import (
+	"errors"
+	"strings"
+)
+
+//Client returns the client IP of an X-Forwarded-For header, the last entry or, when loadBalancer tells the request
+//came through a GCP load balancer, the one before it. A single entry is the client either way: a load balancer
+//in between always adds two.
+func Client(header string, loadBalancer bool) (string, error) {
+	var hops []string
+	for _, h := range strings.Split(header, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hops = append(hops, h)
+		}
+	}
+
+	switch {
+	case len(hops) == 0:
+		return "", errors.New("empty X-Forwarded-For")
+	case len(hops) == 1 || !loadBalancer:
+		return hops[len(hops)-1], nil
+	default:
+		return hops[len(hops)-2], nil
+	}
+}
@@ -0,0 +1,32 @@
+package forwarded
+
+import "testing"
+
+func TestClient(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       string
+		loadBalancer bool
+		ip           string
+		err          bool
+	}{
+		{name: "front end only", header: "203.0.113.1", ip: "203.0.113.1"},
+		{name: "front end, spoofed entry ignored", header: "198.51.100.7, 203.0.113.1", ip: "203.0.113.1"},
+		{name: "load balancer", header: "203.0.113.1, 34.120.0.1", loadBalancer: true, ip: "203.0.113.1"},
+		{name: "load balancer, spoofed entry ignored", header: "198.51.100.7,203.0.113.1, 34.120.0.1", loadBalancer: true, ip: "203.0.113.1"},
+		{name: "load balancer not in between", header: "203.0.113.1", loadBalancer: true, ip: "203.0.113.1"},
+		{name: "empty entries skipped", header: " , 203.0.113.1,", ip: "203.0.113.1"},
+		{name: "empty", header: " ", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := Client(tt.header, tt.loadBalancer)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if ip != tt.ip {
+				t.Errorf("got %q, want %q", ip, tt.ip)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+//Package function exposes the updater as an HTTP handler so it can run on Cloud Run or Cloud Functions.
+//
+//The handler is configured with environment variables:
+//
+//	GKE_PROJECT, GKE_LOCATION, GKE_CLUSTER, GKE_NETWORK_NAME  the cluster and the display name to manage. GKE_CLUSTER
+//	                                                     may also be a full resource name carrying the project and location.
+//	                                                     GKE_LOCATION, the zone or region of the cluster (GKE_ZONE also
+//	                                                     works), is looked up when omitted
+//	STATE_BUCKET, STATE_OBJECT                             where the last authorized IP is kept (object defaults to ip.txt)
+//	RECONCILE_TOKEN                                        shared secret callers must send in the X-Reconcile-Token header,
+//	                                                     requests are refused while it isn't set
+//	PUBSUB_AUDIENCE, PUBSUB_SERVICE_ACCOUNT                audience and service account of the OIDC token of push
+//	                                                     subscriptions, see verifyPushToken
+//	PUBSUB_TRUST_IP                                        true to take the IP from the messages, see message.ip
+//	IP_HINT                                                where to read the IP when none is given, see hintIP
+//	BEHIND_LOAD_BALANCER                                   true when a GCP HTTP(S) Load Balancer is in front, see callerIP
+//	PUBSUB_SUBSCRIPTION                                    subscription cmd/server pulls ticks from, see Pull
+package function
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"gke-ip-update/forwarded"
+	"gke-ip-update/updater"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/container/v1"
+)
+
+//sent with API calls so audit logs show the change came from the handler
+const userAgent = "gke-ip-update-function"
+
+//Result tells what ReconcileIP did, it's also the JSON answer of the handlers.
+//The update isn't waited for, Duration is always 0.
+type Result struct {
+	IP      string `json:"ip"`
+	Updated bool   `json:"updated"`
+	*updater.Result
+}
+
+//Reconcile authorizes an IP in the configured cluster.
+//
+//The IP comes from the "ip" parameter. "ip=auto" uses the address of the caller, which is what a home
+//router webhook wants. Without the parameter the IP comes from IP_HINT, or the last saved IP is applied
+//again, which is what a Cloud Scheduler job wants to heal manual edits to the cluster.
+func Reconcile(w http.ResponseWriter, r *http.Request) {
+	useLogger()
+	if os.Getenv("RECONCILE_TOKEN") == "" {
+		logf("refusing a request, RECONCILE_TOKEN is not set")
+		http.Error(w, "handler is not configured", http.StatusInternalServerError)
+		return
+	}
+	if !authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	ip, err := requestIP(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := ReconcileIP(r.Context(), ip)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+//check the RECONCILE_TOKEN of the request, sent in the X-Reconcile-Token header. It isn't taken from the URL,
+//where it would end up in the request logs. Nothing is authorized without a token.
+func authorized(r *http.Request) bool {
+	token := os.Getenv("RECONCILE_TOKEN")
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Reconcile-Token")), []byte(token)) == 1
+}
+
+//an error with the HTTP status to answer it with
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func withStatus(status int, err error) error {
+	return &statusError{status: status, err: err}
+}
+
+//the HTTP status of an error returned by ReconcileIP
+func errorStatus(err error) int {
+	if e, ok := err.(*statusError); ok {
+		return e.status
+	}
+	return http.StatusInternalServerError
+}
+
+//ReconcileIP authorizes ip in the cluster configured by the environment, as the handlers do. Without an ip, the IP comes
+//from IP_HINT or the saved one is applied again. Every call made honors the cancellation and the deadline of ctx,
+//so applications embedding the package can bound it.
+func ReconcileIP(ctx context.Context, ip string) (*Result, error) {
+	useLogger()
+	cluster, err := updater.ParseCluster(os.Getenv("GKE_CLUSTER"))
+	if err != nil {
+		return nil, err
+	}
+	if project := os.Getenv("GKE_PROJECT"); project != "" {
+		cluster.Project = updater.ParseProject(project)
+	}
+	for _, name := range []string{"GKE_LOCATION", "GKE_ZONE"} {
+		if location := os.Getenv(name); location != "" {
+			cluster.Zone = location
+			break
+		}
+	}
+	displayName := os.Getenv("GKE_NETWORK_NAME")
+	bucket := os.Getenv("STATE_BUCKET")
+	if cluster.Project == "" || cluster.Name == "" || displayName == "" || bucket == "" {
+		return nil, errors.New("handler is not configured")
+	}
+
+	c, err := google.DefaultClient(ctx, container.CloudPlatformScope)
+	if err != nil {
+		return nil, err
+	}
+
+	object := os.Getenv("STATE_OBJECT")
+	if object == "" {
+		object = "ip.txt"
+	}
+	store := &updater.GCSStore{Client: c, Bucket: bucket, Object: object, UserAgent: userAgent}
+
+	savedIP, err := store.GetIP(ctx)
+	if err != nil {
+		return nil, withStatus(http.StatusBadGateway, err)
+	}
+
+	if ip == "" && os.Getenv("IP_HINT") != "" {
+		if ip, err = hintIP(ctx, c, os.Getenv("IP_HINT"), cluster.Project); err != nil {
+			return nil, withStatus(http.StatusBadGateway, fmt.Errorf("unable to read the IP hint : %s", err))
+		}
+	}
+	if ip == "" {
+		ip = savedIP
+	}
+	if ip == "" {
+		return nil, withStatus(http.StatusBadRequest, errors.New("no ip given and none saved yet"))
+	}
+
+	containerService, err := container.New(c)
+	if err != nil {
+		return nil, err
+	}
+	containerService.UserAgent = userAgent
+
+	if cluster.Zone == "" {
+		if cluster, err = updater.FindCluster(ctx, containerService, cluster.Project, cluster.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	change, err := updater.SetIP(ctx, containerService, cluster, ip, displayName)
+	if _, ok := err.(*updater.NotRunningError); ok {
+		return nil, withStatus(http.StatusServiceUnavailable, err)
+	}
+	if err != nil {
+		return nil, withStatus(http.StatusBadGateway, fmt.Errorf("Unable to update ip in the GKE cluster : %s", err))
+	}
+
+	if ip != savedIP {
+		if err := store.SaveIP(ctx, ip); err != nil {
+			return nil, withStatus(http.StatusBadGateway, err)
+		}
+	}
+
+	return &Result{IP: ip, Updated: change.Operation != nil, Result: updater.Summarize(change, displayName, ip)}, nil
+}
+
+//find the ip the caller asked for, if any
+func requestIP(r *http.Request) (string, error) {
+	ip := r.FormValue("ip")
+	if ip == "auto" {
+		ip = callerIP(r)
+	}
+	if ip == "" {
+		return "", nil
+	}
+
+	return parseIP(ip)
+}
+
+//check that an IP is an IPv4 address
+func parseIP(ip string) (string, error) {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil || parsed.To4() == nil {
+		return "", fmt.Errorf("%q is not an IPv4 address", ip)
+	}
+
+	return parsed.String(), nil
+}
+
+//address of the client as seen by the Google front end, or by the load balancer the handler is behind
+//with BEHIND_LOAD_BALANCER=true
+func callerIP(r *http.Request) string {
+	if ip, err := forwarded.Client(r.Header.Get("X-Forwarded-For"), os.Getenv("BEHIND_LOAD_BALANCER") == "true"); err == nil {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
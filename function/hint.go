@@ -0,0 +1,96 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"gke-ip-update/updater"
+)
+
+//hintIP reads the IP published by something that knows it, like the home router, from IP_HINT:
+//
+//	firestore:<collection>/<document>[#field]  a string field (ip by default) of a Firestore document in the project of the cluster
+//	gcs:<bucket>/<object>                      a Cloud Storage object holding the IP
+//	https://...                                a URL answering with the IP, called without credentials
+func hintIP(ctx context.Context, c *http.Client, hint, project string) (string, error) {
+	switch {
+	case strings.HasPrefix(hint, "firestore:"):
+		path, field := strings.TrimPrefix(hint, "firestore:"), "ip"
+		if i := strings.Index(path, "#"); i >= 0 {
+			path, field = path[:i], path[i+1:]
+		}
+		return firestoreIP(ctx, c, project, path, field)
+	case strings.HasPrefix(hint, "gcs:"):
+		parts := strings.SplitN(strings.TrimPrefix(hint, "gcs:"), "/", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("expected gcs:<bucket>/<object>, got %q", hint)
+		}
+		store := &updater.GCSStore{Client: c, Bucket: parts[0], Object: parts[1], UserAgent: userAgent}
+		ip, err := store.GetIP(ctx)
+		if err != nil || ip == "" {
+			return "", err
+		}
+		return parseIP(ip)
+	case strings.HasPrefix(hint, "http://") || strings.HasPrefix(hint, "https://"):
+		return urlIP(ctx, hint)
+	default:
+		return "", fmt.Errorf("unknown IP hint %q", hint)
+	}
+}
+
+func firestoreIP(ctx context.Context, c *http.Client, project, path, field string) (string, error) {
+	url := fmt.Sprintf("https://firestore.googleapis.com/v1/projects/%s/databases/(default)/documents/%s", project, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("firestore answered %s", resp.Status)
+	}
+
+	var doc struct {
+		Fields map[string]struct {
+			StringValue string `json:"stringValue"`
+		} `json:"fields"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", err
+	}
+	value, ok := doc.Fields[field]
+	if !ok {
+		return "", fmt.Errorf("no %s field in %s", field, path)
+	}
+	return parseIP(value.StringValue)
+}
+
+func urlIP(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := plainClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return parseIP(strings.TrimSpace(string(body)))
+}
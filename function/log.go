@@ -0,0 +1,55 @@
+package function
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+
+	"gke-ip-update/updater"
+)
+
+//Logger receives the messages of the handlers and of the updater package. *log.Logger satisfies it.
+type Logger = updater.Logger
+
+//messages go to stderr, where Cloud Run and Cloud Functions collect them, until SetLogger is called.
+//Handlers running in other goroutines read it while it's set.
+var (
+	loggerMu sync.RWMutex
+	logger   Logger = log.New(os.Stderr, "", log.LstdFlags)
+)
+
+//done by the first call of SetLogger or of a handler, whichever comes first
+var loggerOnce sync.Once
+
+//send the messages of the updater package to stderr along with the ones of the handlers, unless SetLogger was called.
+//Importing the package doesn't touch the logger of the updater package, an application using both keeps its own.
+func useLogger() {
+	loggerOnce.Do(func() {
+		updater.SetLogger(currentLogger())
+	})
+}
+
+//SetLogger sends the messages of the handlers and of the updater package to l. A nil l discards them.
+func SetLogger(l Logger) {
+	loggerOnce.Do(func() {})
+	updater.SetLogger(l)
+	if l == nil {
+		l = log.New(ioutil.Discard, "", 0)
+	}
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+//the logger set by SetLogger
+func currentLogger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+//log a message of the handlers
+func logf(format string, v ...interface{}) {
+	currentLogger().Printf(format, v...)
+}
@@ -0,0 +1,69 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//where Google checks ID tokens
+const tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+//client of the calls the handlers make without credentials, bounded so a slow server doesn't hold the request
+var plainClient = &http.Client{Timeout: 10 * time.Second}
+
+//check the OIDC token Pub/Sub push subscriptions send in the Authorization header when created with
+//--push-auth-service-account. It must be issued by Google for PUBSUB_AUDIENCE to PUBSUB_SERVICE_ACCOUNT.
+func verifyPushToken(ctx context.Context, r *http.Request) error {
+	audience, account := os.Getenv("PUBSUB_AUDIENCE"), os.Getenv("PUBSUB_SERVICE_ACCOUNT")
+	if audience == "" || account == "" {
+		return errors.New("PUBSUB_AUDIENCE and PUBSUB_SERVICE_ACCOUNT are not set")
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return errors.New("no token")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenInfoURL+"?id_token="+url.QueryEscape(token), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := plainClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token rejected : %s", resp.Status)
+	}
+
+	var claims struct {
+		Issuer        string `json:"iss"`
+		Audience      string `json:"aud"`
+		Email         string `json:"email"`
+		EmailVerified string `json:"email_verified"`
+		Expires       string `json:"exp"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return err
+	}
+	expires, err := strconv.ParseInt(claims.Expires, 10, 64)
+	switch {
+	case claims.Issuer != "https://accounts.google.com" && claims.Issuer != "accounts.google.com":
+		return fmt.Errorf("token issued by %s", claims.Issuer)
+	case claims.Audience != audience:
+		return fmt.Errorf("token for %s", claims.Audience)
+	case claims.Email != account || claims.EmailVerified != "true":
+		return fmt.Errorf("token of %s", claims.Email)
+	case err != nil || time.Now().After(time.Unix(expires, 0)):
+		return errors.New("token expired")
+	}
+	return nil
+}
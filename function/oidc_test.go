@@ -0,0 +1,118 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//sends the requests to the test server whatever their URL
+type redirect string
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, _ := url.Parse(string(r))
+	req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func setenv(t *testing.T, name, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(name)
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestVerifyPushToken(t *testing.T) {
+	valid := map[string]string{
+		"iss":            "https://accounts.google.com",
+		"aud":            "https://handler.example.com/pubsub",
+		"email":          "pusher@project.iam.gserviceaccount.com",
+		"email_verified": "true",
+		"exp":            strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10),
+	}
+	with := func(name, value string) map[string]string {
+		claims := map[string]string{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		claims[name] = value
+		return claims
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		claims        map[string]string
+		err           string
+	}{
+		{name: "valid", authorization: "Bearer id-token", claims: valid},
+		{name: "no token", err: "no token"},
+		{name: "rejected by google", authorization: "Bearer id-token", status: http.StatusBadRequest, err: "token rejected"},
+		{name: "other issuer", authorization: "Bearer id-token", claims: with("iss", "https://evil.example.com"), err: "token issued by"},
+		{name: "other audience", authorization: "Bearer id-token", claims: with("aud", "https://other.example.com"), err: "token for"},
+		{name: "other account", authorization: "Bearer id-token", claims: with("email", "someone@example.com"), err: "token of"},
+		{name: "unverified email", authorization: "Bearer id-token", claims: with("email_verified", "false"), err: "token of"},
+		{name: "expired", authorization: "Bearer id-token", claims: with("exp", strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)), err: "token expired"},
+		{name: "no expiry", authorization: "Bearer id-token", claims: with("exp", ""), err: "token expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setenv(t, "PUBSUB_AUDIENCE", valid["aud"])
+			setenv(t, "PUBSUB_SERVICE_ACCOUNT", valid["email"])
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("id_token") != "id-token" {
+					t.Errorf("got id_token %q", r.URL.Query().Get("id_token"))
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				json.NewEncoder(w).Encode(tt.claims)
+			}))
+			defer srv.Close()
+			client := plainClient
+			plainClient = &http.Client{Transport: redirect(srv.URL)}
+			defer func() {
+				plainClient = client
+			}()
+
+			r := httptest.NewRequest(http.MethodPost, "/pubsub", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			err := verifyPushToken(context.Background(), r)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		setenv(t, "PUBSUB_AUDIENCE", "")
+		r := httptest.NewRequest(http.MethodPost, "/pubsub", nil)
+		r.Header.Set("Authorization", "Bearer id-token")
+		if err := verifyPushToken(context.Background(), r); err == nil {
+			t.Error("token accepted without PUBSUB_AUDIENCE")
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+const pubsubScope = "https://www.googleapis.com/auth/pubsub"
+
+//a Pub/Sub message, e.g. the tick of a Cloud Scheduler job. With PUBSUB_TRUST_IP=true the IP can be given in the ip
+//attribute or as {"ip": "..."} in the data, otherwise it comes from IP_HINT or the saved IP is applied again.
+type message struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes"`
+	MessageID  string            `json:"messageId"`
+}
+
+//the IP carried by the message, if any. Anyone allowed to publish to the topic could pick it, so it's ignored
+//unless PUBSUB_TRUST_IP=true.
+func (m message) ip() (string, error) {
+	if os.Getenv("PUBSUB_TRUST_IP") != "true" {
+		return "", nil
+	}
+	ip := m.Attributes["ip"]
+	if ip == "" && len(m.Data) > 0 {
+		var data struct {
+			IP string `json:"ip"`
+		}
+		if json.Unmarshal(m.Data, &data) == nil {
+			ip = data.IP
+		}
+	}
+	if ip == "" {
+		return "", nil
+	}
+	return parseIP(ip)
+}
+
+//PubSub reconciles on every message of a Pub/Sub push subscription. Failures answer an error status
+//so Pub/Sub delivers the message again, except for messages that can't ever succeed.
+//Requests must carry the OIDC token of an authenticated push subscription, see verifyPushToken.
+func PubSub(w http.ResponseWriter, r *http.Request) {
+	useLogger()
+	if err := verifyPushToken(r.Context(), r); err != nil {
+		logf("refusing a push request : %s", err)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var push struct {
+		Message      message `json:"message"`
+		Subscription string  `json:"subscription"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := handleMessage(r.Context(), push.Message)
+	if err != nil {
+		logf("message %s : %s", push.Message.MessageID, err)
+		status := errorStatus(err)
+		if status == http.StatusBadRequest {
+			//acknowledge it, delivering it again wouldn't help
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func handleMessage(ctx context.Context, m message) (*Result, error) {
+	ip, err := m.ip()
+	if err != nil {
+		return nil, withStatus(http.StatusBadRequest, err)
+	}
+	return ReconcileIP(ctx, ip)
+}
+
+//Pull reconciles on the messages of a Pub/Sub pull subscription (projects/p/subscriptions/s) until the context is done.
+//Messages that failed aren't acknowledged, so they are delivered again once their ack deadline passes.
+func Pull(ctx context.Context, subscription string) error {
+	useLogger()
+	c, err := google.DefaultClient(ctx, pubsubScope)
+	if err != nil {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		var pulled struct {
+			ReceivedMessages []struct {
+				AckID   string  `json:"ackId"`
+				Message message `json:"message"`
+			} `json:"receivedMessages"`
+		}
+		if err := callPubSub(ctx, c, subscription+":pull", map[string]interface{}{"maxMessages": 10}, &pulled); err != nil {
+			logf("unable to pull from %s : %s", subscription, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(10 * time.Second):
+			}
+			continue
+		}
+
+		var ackIDs []string
+		for _, m := range pulled.ReceivedMessages {
+			res, err := handleMessage(ctx, m.Message)
+			if err != nil {
+				logf("message %s : %s", m.Message.MessageID, err)
+				if errorStatus(err) != http.StatusBadRequest {
+					continue
+				}
+			} else {
+				logf("message %s : ip %s updated %t", m.Message.MessageID, res.IP, res.Updated)
+			}
+			ackIDs = append(ackIDs, m.AckID)
+		}
+
+		if len(ackIDs) > 0 {
+			if err := callPubSub(ctx, c, subscription+":acknowledge", map[string]interface{}{"ackIds": ackIDs}, nil); err != nil {
+				logf("unable to acknowledge messages : %s", err)
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+func callPubSub(ctx context.Context, c *http.Client, method string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://pubsub.googleapis.com/v1/"+method, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s : %s", resp.Status, msg)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+//make sure the current IP is authorized, then run the command, as a wrapper of ssh / kubectl.
+//The cluster is only touched when it's about to be accessed.
+//Nothing is written to stdout, which is the connection when used as an SSH ProxyCommand.
+func (a *App) gate(command []string) {
+	if len(command) == 0 {
+		log.Fatal("Usage: gke-ip-update gate [flags] -- command [args]")
+	}
+
+	res := a.checkOnce()
+	if res.Error != "" {
+		fmt.Fprintf(os.Stderr, "gke-ip-update: unable to authorize the IP, running the command anyway : %s\n", res.Error)
+	}
+	for _, c := range res.Clusters {
+		if c.Error != "" {
+			fmt.Fprintf(os.Stderr, "gke-ip-update: unable to authorize the IP in %s, running the command anyway : %s\n", c.Cluster, c.Error)
+		}
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	//the command gets the interrupts of the terminal itself
+	signal.Ignore(os.Interrupt)
+	err := cmd.Run()
+	a.logFile.Close()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
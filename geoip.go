@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//where an IP is, as told by --geoip
+type location struct {
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+	//the network the IP belongs to, as AS<number>
+	ASN string `json:"asn,omitempty"`
+}
+
+func (l location) String() string {
+	var parts []string
+	for _, p := range []string{l.Country, l.City, l.ASN} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+//locate an IP with the comma separated sources of --geoip, the first one knowing a field giving it.
+//A source is an API URL where {ip} is replaced by the IP, answering JSON like ipinfo.io or ip-api.com,
+//or an offline CSV database of ranges like the DB-IP or IP2Location lite ones (first IP, last IP, country code or ASN, ...).
+func (a *App) geolocate(ip string) (location, error) {
+	var l location
+	for _, source := range strings.Split(a.GeoIP, ",") {
+		var found location
+		var err error
+		switch source = strings.TrimSpace(source); {
+		case source == "":
+			continue
+		case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+			found, err = a.geolocateAPI(strings.Replace(source, "{ip}", ip, -1))
+		default:
+			found, err = geolocateCSV(source, ip)
+		}
+		if err != nil {
+			return l, err
+		}
+
+		if l.Country == "" {
+			l.Country = found.Country
+		}
+		if l.City == "" {
+			l.City = found.City
+		}
+		if l.ASN == "" {
+			l.ASN = found.ASN
+		}
+	}
+	return l, nil
+}
+
+func (a *App) geolocateAPI(url string) (location, error) {
+	resp, err := a.httpClient(outbound).Get(url)
+	if err != nil {
+		return location{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return location{}, fmt.Errorf("geo-IP lookup failed with status %s", resp.Status)
+	}
+
+	//the APIs don't agree on the field names
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return location{}, err
+	}
+	field := func(names ...string) string {
+		for _, name := range names {
+			if s, ok := body[name].(string); ok && s != "" {
+				return s
+			}
+		}
+		return ""
+	}
+	//the network comes first in the organization, like "AS3215 Orange S.A."
+	asn := strings.Fields(field("asn", "as", "org"))
+	l := location{Country: field("country_code", "countryCode", "country"), City: field("city")}
+	if len(asn) > 0 && strings.HasPrefix(asn[0], "AS") {
+		l.ASN = asn[0]
+	}
+	return l, nil
+}
+
+//scan the ranges of the database for the one holding the IP
+func geolocateCSV(path, ip string) (location, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return location{}, fmt.Errorf("invalid IP %q", ip)
+	}
+	addr = addr.To16()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return location{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		for i := range fields {
+			fields[i] = strings.Trim(strings.TrimSpace(fields[i]), `"`)
+		}
+		if len(fields) < 3 {
+			continue
+		}
+		first, last := rangeIP(fields[0]), rangeIP(fields[1])
+		if first == nil || last == nil || bytes.Compare(addr, first) < 0 || bytes.Compare(addr, last) > 0 {
+			continue
+		}
+		//ASN databases hold the number of the network where country ones hold the country code
+		if _, err := strconv.ParseUint(fields[2], 10, 32); err == nil {
+			return location{ASN: "AS" + fields[2]}, nil
+		}
+		return location{Country: fields[2]}, nil
+	}
+	return location{}, scanner.Err()
+}
+
+//an IP of a database range, given as an address or, by IP2Location, as the number of an IPv4 address
+func rangeIP(s string) net.IP {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.To16()
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return nil
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, uint32(n))
+	return ip.To16()
+}
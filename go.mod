@@ -3,6 +3,7 @@ module gke-ip-update
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/docker/docker v1.13.1
 	github.com/docker/go-connections v0.4.0 // indirect
 	github.com/docker/go-units v0.4.0 // indirect
@@ -10,4 +11,5 @@ require (
 	golang.org/x/net v0.0.0-20200501053045-e0ff5e5a1de5
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	google.golang.org/api v0.22.0
+	gopkg.in/yaml.v2 v2.4.0
 )
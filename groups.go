@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//--cluster-group flags, given as cluster=group with the cluster named as in --class
+type groupFlags map[string]string
+
+func (g groupFlags) String() string {
+	var specs []string
+	for cluster, name := range g {
+		specs = append(specs, cluster+"="+name)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (g groupFlags) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return fmt.Errorf("expected cluster=group, got %q", value)
+	}
+	g[value[:i]] = value[i+1:]
+	return nil
+}
+
+//group of a cluster, "" when it's in none
+func (a *App) groupOf(context string, c updater.Cluster) string {
+	for spec, name := range a.ClusterGroups {
+		if matchesCluster(spec, context, c) {
+			return name
+		}
+	}
+	return ""
+}
+
+//whether a cluster is one the command acts on : any without --group, the ones of the group with it
+func (a *App) inGroup(context string, c updater.Cluster) bool {
+	return a.Group == "" || a.groupOf(context, c) == a.Group
+}
+
+//a pause of the updates of a cluster or of a group, made with the pause command
+type pause struct {
+	By    string    `json:"by,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+//the pauses, kept in paused.json in the state directory by cluster resource name, or by group:<name> for the groups
+func (a *App) loadPauses() (map[string]pause, error) {
+	pauses := map[string]pause{}
+	data, err := a.readStateFile("paused.json")
+	if os.IsNotExist(err) {
+		return pauses, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &pauses)
+	}
+	return pauses, err
+}
+
+func (a *App) savePauses(pauses map[string]pause) error {
+	data, err := json.MarshalIndent(pauses, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.writeStateFile("paused.json", data)
+}
+
+//whether the updates of the cluster, or of its group, are paused
+func (a *App) isPaused(context string, c updater.Cluster) bool {
+	pauses, err := a.loadPauses()
+	if err != nil {
+		a.writeLog(fmt.Sprintf("Unable to read the pauses : %s \n", err.Error()))
+		return false
+	}
+	if _, ok := pauses[c.ResourceName()]; ok {
+		return true
+	}
+	group := a.groupOf(context, c)
+	_, ok := pauses["group:"+group]
+	return group != "" && ok
+}
+
+//what pause and resume act on : --group when given, --cluster otherwise
+func (a *App) pauseKey() string {
+	if a.Group != "" {
+		return "group:" + a.Group
+	}
+	return a.clusterKey("No cluster provided, give the cluster to pause with --cluster or a group with --group")
+}
+
+//the resource name of --cluster, which the pauses, notes and status are kept by so clusters of the same name in other
+//projects or locations stay apart. The location is looked up when --cluster doesn't give it.
+func (a *App) clusterKey(missing string) string {
+	if err := a.normalizeCluster(); err != nil {
+		log.Fatal(err)
+	}
+	if a.ClusterID == "" {
+		log.Fatal(missing)
+	}
+	if a.SimulateIPs == "" {
+		a.setCreds(a.CredentialPath)
+		if err := a.resolveZone(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return updater.Cluster{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}.ResourceName()
+}
+
+//pause the updates of --cluster, or of every cluster of --group, until resume is run. A running app picks this up
+//on its next update, the IPs keep being checked.
+func (a *App) pause() {
+	key := a.pauseKey()
+	pauses, err := a.loadPauses()
+	if err != nil {
+		log.Fatal(err)
+	}
+	pauses[key] = pause{By: currentUser(), Since: time.Now()}
+	if err := a.savePauses(pauses); err != nil {
+		log.Fatal(err)
+	}
+	a.writeLog(fmt.Sprintf("Updates of %s paused by %s \n", key, pauses[key].By))
+	fmt.Printf("Updates of %s paused, run `gke-ip-update resume` to resume them\n", key)
+}
+
+//lift the pause of --cluster or --group. Reports whether there was one.
+func (a *App) unpause() bool {
+	if a.Group == "" && a.ClusterID == "" {
+		return false
+	}
+	key := a.pauseKey()
+	pauses, err := a.loadPauses()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, ok := pauses[key]; !ok {
+		return false
+	}
+	delete(pauses, key)
+	if err := a.savePauses(pauses); err != nil {
+		log.Fatal(err)
+	}
+	a.writeLog(fmt.Sprintf("Updates of %s resumed \n", key))
+	fmt.Printf("Updates of %s resumed, a running app picks this up on its next check\n", key)
+	return true
+}
+
+//print what the running app last reported about the clusters of --group, or of all of them
+func (a *App) printStatus() {
+	a.validateOutput()
+	var s appStatus
+	data, err := ioutil.ReadFile(a.cachePath("status.json"))
+	if err == nil {
+		err = json.Unmarshal(data, &s)
+	}
+	if err != nil {
+		log.Fatalf("No status recorded yet, is the app running ? %s", err.Error())
+	}
+	notes, _ := a.loadNotes()
+	pauses, _ := a.loadPauses()
+
+	if a.OutputFormat == "table" || a.OutputFormat == "text" {
+		fmt.Printf("Last check : %s\n", a.displayWhen(s.LastCheck))
+		if !s.LastUpdate.IsZero() {
+			fmt.Printf("Last update : %s\n", a.displayWhen(s.LastUpdate))
+		}
+		if s.LastError != "" {
+			fmt.Printf("Last error : %s\n", s.LastError)
+		}
+		fmt.Println()
+	}
+
+	var names []string
+	for name := range s.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t := newTable("CLUSTER", "GROUP", "NETWORKS", "MANAGED", "PAUSED", "NOTE")
+	for _, name := range names {
+		//the status is kept by resource name, so groups given by full name or with another project match
+		c, err := updater.ParseCluster(name)
+		if err != nil {
+			continue
+		}
+		if !a.inGroup("", c) {
+			continue
+		}
+		group := a.groupOf("", c)
+		_, paused := pauses[name]
+		if _, ok := pauses["group:"+group]; ok && group != "" {
+			paused = true
+		}
+		n := s.Networks[name]
+		t.add(clusterStatus{Cluster: name, Group: group, Networks: n, Paused: paused, Note: notes[name].Text},
+			name, group, strconv.Itoa(n.Total), strconv.Itoa(n.Managed), strconv.FormatBool(paused), notes[name].Text)
+	}
+	a.printTable(t, "No cluster reconciled yet")
+}
+
+//a row of the status command
+type clusterStatus struct {
+	Cluster  string             `json:"cluster"`
+	Group    string             `json:"group,omitempty"`
+	Networks networkComposition `json:"networks"`
+	Paused   bool               `json:"paused,omitempty"`
+	Note     string             `json:"note,omitempty"`
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//locate an IP, remembering the answer
+func (a *App) locate(ip string) (location, error) {
+	a.locatedMu.Lock()
+	l, ok := a.located[ip]
+	a.locatedMu.Unlock()
+	if ok {
+		return l, nil
+	}
+
+	l, err := a.geolocate(ip)
+	if err != nil {
+		return l, err
+	}
+	a.locatedMu.Lock()
+	if len(a.located) > 100 {
+		a.located = map[string]location{}
+	}
+	a.located[ip] = l
+	a.locatedMu.Unlock()
+	return l, nil
+}
+
+//check whether --allow-countries or --allow-asns are given
+func (a *App) guarding() bool {
+	return a.AllowCountries != "" || a.AllowASNs != ""
+}
+
+//tell why a new IP isn't expected, nil when it is in the allowed countries and networks.
+//An IP that can't be located isn't authorized either.
+func (a *App) unexpected(ip string) error {
+	l, err := a.locate(ip)
+	if err != nil {
+		return fmt.Errorf("unable to locate it : %s", err.Error())
+	}
+
+	if a.AllowCountries != "" && !listed(a.AllowCountries, l.Country) {
+		return fmt.Errorf("it is in %q, outside of --allow-countries %s", l.Country, a.AllowCountries)
+	}
+	if a.AllowASNs != "" && !listed(a.AllowASNs, l.ASN) {
+		return fmt.Errorf("it belongs to %q, outside of --allow-asns %s", l.ASN, a.AllowASNs)
+	}
+	return nil
+}
+
+//check whether a value is in a comma separated list, ignoring case and the AS prefix of network numbers
+func listed(list, value string) bool {
+	if value = listKey(value); value == "" {
+		return false
+	}
+	for _, v := range strings.Split(list, ",") {
+		if listKey(v) == value {
+			return true
+		}
+	}
+	return false
+}
+
+//uppercase a country or network, dropping the AS of AS<number> so AS15169 and 15169 are the same network.
+//The AS of American Samoa stays.
+func listKey(v string) string {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	number := strings.TrimPrefix(v, "AS")
+	if number == "" || number == v {
+		return v
+	}
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return v
+		}
+	}
+	return number
+}
+
+//keep the current IP of the entries whose new IP comes from an unexpected country or network, a sign of a
+//compromised detection or a VPN left on. The update is blocked and alerted about once per IP.
+func (st *state) guard(ips map[string]string) map[string]string {
+	if !st.app.guarding() {
+		return ips
+	}
+
+	guarded := copyIPs(ips)
+	for name, ip := range ips {
+		old, ok := st.IPs[name]
+		if ok && old == ip {
+			continue
+		}
+
+		err := st.app.unexpected(ip)
+		if err == nil {
+			delete(st.rejected, name)
+			continue
+		}
+		if ok {
+			guarded[name] = old
+		} else {
+			delete(guarded, name)
+		}
+
+		if st.rejected[name] != ip {
+			if st.rejected == nil {
+				st.rejected = map[string]string{}
+			}
+			st.rejected[name] = ip
+			message := fmt.Sprintf("Refusing to authorize %s for %s, %s", ip, name, err.Error())
+			st.app.writeLog(message + " \n")
+			st.app.notify("critical", message)
+		}
+	}
+	return guarded
+}
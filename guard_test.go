@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestListed(t *testing.T) {
+	tests := []struct {
+		name  string
+		list  string
+		value string
+		want  bool
+	}{
+		{name: "country", list: "FR, de", value: "DE", want: true},
+		{name: "country not listed", list: "FR,DE", value: "US"},
+		{name: "American Samoa", list: "FR,AS", value: "AS", want: true},
+		{name: "American Samoa isn't any network", list: "AS", value: "15169"},
+		{name: "network with prefix", list: "AS15169", value: "15169", want: true},
+		{name: "network without prefix", list: "15169", value: "AS15169", want: true},
+		{name: "network lowercase", list: "as3215", value: "AS3215", want: true},
+		{name: "network not listed", list: "AS15169", value: "AS3215"},
+		{name: "prefix only stripped before digits", list: "ASIA", value: "IA"},
+		{name: "unknown value", list: "FR", value: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listed(tt.list, tt.value); got != tt.want {
+				t.Errorf("listed(%q, %q) = %v, want %v", tt.list, tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+//record that a cycle ran: the time goes to the heartbeat file of the cache directory for local monitoring,
+//and --heartbeat-url is pinged for a dead man's switch like Healthchecks.io or Cronitor, which alerts when the pings stop.
+//A failed cycle pings --heartbeat-fail-url instead when it is given.
+func (a *App) heartbeat(err error) {
+	if err == nil && !a.NoState {
+		ioutil.WriteFile(a.cachePath("heartbeat"), []byte(time.Now().Format(time.RFC3339)+"\n"), 0600)
+	}
+
+	url := a.HeartbeatURL
+	if err != nil {
+		url = a.HeartbeatFailURL
+	}
+	if url == "" {
+		return
+	}
+	resp, err := a.httpClient(outbound).Get(url)
+	if err != nil {
+		a.writeLog(fmt.Sprintf("Unable to ping the heartbeat URL : %s \n", err.Error()))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		a.writeLog(fmt.Sprintf("Unable to ping the heartbeat URL : %s \n", resp.Status))
+	}
+}
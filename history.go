@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+//an IP an entry had, kept after it is no longer authorized so unexpected changes can be looked into
+type recentIP struct {
+	Name     string    `json:"name"`
+	IP       string    `json:"ip"`
+	Seen     time.Time `json:"seen"`
+	Owner    string    `json:"owner,omitempty"`
+	Location *location `json:"location,omitempty"`
+	//the reconcile that applied it, as in the logs, notifications and audit entries
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+//add the new IP of an entry to the front of the --recent-ips, locating it with --geoip.
+//An IP from another country than the previous one of the entry is worth a warning, ISPs rarely do that.
+func (st *state) seen(name, ip string) {
+	if st.app.RecentIPs <= 0 {
+		return
+	}
+
+	r := recentIP{Name: name, IP: ip, Seen: time.Now(), Owner: st.app.Owner, CorrelationID: st.correlationID}
+	if st.app.GeoIP != "" {
+		l, err := st.app.locate(ip)
+		if err != nil {
+			st.app.writeLog(fmt.Sprintf("Unable to locate %s : %s \n", ip, err.Error()))
+		} else {
+			r.Location = &l
+		}
+	}
+
+	for _, p := range st.Recent {
+		if p.Name != name {
+			continue
+		}
+		if r.Location != nil && p.Location != nil && r.Location.Country != "" && p.Location.Country != "" && r.Location.Country != p.Location.Country {
+			message := fmt.Sprintf("IP of %s moved from %s (%s) to %s (%s)", name, p.IP, p.Location, ip, r.Location)
+			st.app.writeLog(message + " \n")
+			st.app.notify("warning", message)
+		}
+		break
+	}
+
+	st.Recent = append([]recentIP{r}, st.Recent...)
+	if len(st.Recent) > st.app.RecentIPs {
+		st.Recent = st.Recent[:st.app.RecentIPs]
+	}
+}
+
+//print the recent IPs of the entries, newest first
+func (a *App) history() {
+	a.validateOutput()
+	st := a.loadState()
+	t := newTable("SEEN", "ENTRY", "IP", "LOCATION", "OWNER", "CORRELATION ID")
+	t.timeColumn("seen", func(record interface{}) time.Time { return record.(recentIP).Seen })
+	for _, r := range st.Recent {
+		where := ""
+		if r.Location != nil {
+			where = r.Location.String()
+		}
+		t.add(r, a.displayWhen(r.Seen), r.Name, r.IP, where, r.Owner, r.CorrelationID)
+	}
+	a.printTable(t, "No IP recorded yet")
+}
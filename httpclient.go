@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+//what a request is made for. Each purpose gets its own transport, so the proxy, timeout and CAs of one don't leak
+//into the others: the IPs usually have to be looked up without the proxy the Google APIs are reached through.
+type purpose string
+
+const (
+	//finding the public IPs
+	detection purpose = "detection"
+	//GKE, IAM and Cloud Logging
+	googleAPIs purpose = "google-apis"
+	//notifications, heartbeats, crash reports, published ranges and geolocation
+	outbound purpose = "outbound"
+)
+
+//the proxy, timeout and extra CAs of the client of a purpose, zero values falling back to the --http-* flags and
+//the environment
+type transportConfig struct {
+	proxy   string
+	timeout time.Duration
+	ca      string
+}
+
+//build the client of every purpose from the flags
+func (a *App) initializeHTTPClients() error {
+	configs := map[purpose]transportConfig{
+		detection:  {proxy: a.DetectProxy, timeout: a.DetectTimeout, ca: a.DetectCA},
+		googleAPIs: {proxy: a.APIProxy, ca: a.APICA},
+		outbound:   {},
+	}
+
+	clients := map[purpose]*http.Client{}
+	for p, config := range configs {
+		c, err := a.newHTTPClient(config)
+		if err != nil {
+			return fmt.Errorf("HTTP client for %s : %s", p, err.Error())
+		}
+		clients[p] = c
+	}
+	a.httpClients = clients
+	return nil
+}
+
+//a context making the OAuth2 token exchanges go through the client of the Google APIs, so they use --api-proxy and --api-ca
+func (a *App) tokenContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, a.httpClient(googleAPIs))
+}
+
+//the client to use for a purpose
+func (a *App) httpClient(p purpose) *http.Client {
+	return a.httpClients[p]
+}
+
+//HTTP client built from the config and the --http-* and --dns-cache-ttl flags
+func (a *App) newHTTPClient(config transportConfig) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	switch config.proxy {
+	case "":
+	case "direct":
+		proxy = nil
+	default:
+		u, err := url.Parse(config.proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	var tlsConfig *tls.Config
+	if config.ca != "" {
+		pem, err := ioutil.ReadFile(config.ca)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", config.ca)
+		}
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+
+	timeout := a.HTTPTimeout
+	if config.timeout > 0 {
+		timeout = config.timeout
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   a.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	dial := dialer.DialContext
+	if a.DNSCacheTTL > 0 {
+		dial = (&dnsCache{ttl: a.DNSCacheTTL, dialer: dialer, entries: map[string]dnsCacheEntry{}}).dialContext
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               proxy,
+			DialContext:         dial,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: a.TLSHandshakeTimeout,
+			MaxIdleConns:        a.IdleConns,
+			MaxIdleConnsPerHost: a.IdleConns,
+			IdleConnTimeout:     a.IdleConnTimeout,
+		},
+	}, nil
+}
+
+//remembers DNS answers for a while so flaky resolvers don't fail every request
+type dnsCache struct {
+	ttl     time.Duration
+	dialer  *net.Dialer
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+//dial the first reachable address of the host, resolving it only when the cached answer expired
+func (c *dnsCache) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return c.dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	for _, ip := range addrs {
+		conn, err = c.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		//a stale answer beats no answer while the resolver is down
+		if ok {
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[host] = dnsCacheEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
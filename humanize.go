@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+//load --timezone, an IANA name like Europe/Paris, UTC or Local
+func (a *App) initializeTimezone() {
+	if a.Timezone == "" {
+		return
+	}
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		log.Fatalf("Unknown --timezone %q : %s", a.Timezone, err.Error())
+	}
+	a.displayZone = loc
+}
+
+//a time for people, to the minute in --timezone
+func (a *App) displayTime(t time.Time) string {
+	return t.In(a.displayZone).Format("2006-01-02 15:04 MST")
+}
+
+//a time for people followed by how far it is from now, "2024-05-03 14:00 CEST (in 2h)"
+func (a *App) displayWhen(t time.Time) string {
+	return fmt.Sprintf("%s (%s)", a.displayTime(t), relativeTime(t))
+}
+
+//a time for the log lines, which stay machine readable
+func logTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+//a duration for the log lines, as Go prints it to the second : "2h5m0s"
+func logDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+//how long ago or in how long a time is, "3m ago" or "in 2h 5m"
+func relativeTime(t time.Time) string {
+	d := time.Until(t)
+	switch {
+	case d > -time.Second && d < time.Second:
+		return "now"
+	case d < 0:
+		return humanDuration(-d) + " ago"
+	default:
+		return "in " + humanDuration(d)
+	}
+}
+
+//a duration for people, in its two largest units : "45s", "3m 20s", "2h 5m", "4d 3h"
+func humanDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	units := []struct {
+		size time.Duration
+		name string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}}
+
+	d = d.Round(time.Second)
+	for i, u := range units {
+		if d < u.size && i < len(units)-1 {
+			continue
+		}
+		s := fmt.Sprintf("%d%s", d/u.size, u.name)
+		if i < len(units)-1 {
+			if rest := (d % u.size) / units[i+1].size; rest > 0 {
+				s += fmt.Sprintf(" %d%s", rest, units[i+1].name)
+			}
+		}
+		return s
+	}
+	return ""
+}
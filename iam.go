@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	iamAPI                  = "https://iam.googleapis.com/v1"
+	cloudResourceManagerAPI = "https://cloudresourcemanager.googleapis.com/v1"
+)
+
+//the permissions the app needs, instead of a broad role like Editor
+func (a *App) rolePermissions() []string {
+	perms := []string{
+		"container.clusters.get",
+		"container.clusters.list",
+		"container.clusters.update",
+		"container.operations.get",
+	}
+	if a.AuditLog != "" {
+		perms = append(perms, "logging.logEntries.create")
+	}
+	if a.KeyMaxAge > 0 {
+		perms = append(perms, "iam.serviceAccountKeys.get")
+	}
+	if a.PreferIAP {
+		perms = append(perms, "compute.instances.get")
+	}
+	if a.FleetMembership != "" {
+		perms = append(perms, "gkehub.memberships.get")
+	}
+	return perms
+}
+
+//print the gcloud commands creating a least privilege role for the app and granting it to --grant-to,
+//or run them with --apply
+func (a *App) iamSetup() {
+	if err := a.normalizeCluster(); err != nil {
+		log.Fatal(err)
+	}
+	if a.ProjectID == "" {
+		log.Fatal("No project provided")
+	}
+	if a.GrantTo == "" {
+		log.Fatal("No service account provided with --grant-to")
+	}
+
+	perms := a.rolePermissions()
+	member := "serviceAccount:" + a.GrantTo
+	role := fmt.Sprintf("projects/%s/roles/%s", a.ProjectID, a.RoleID)
+
+	if !a.Apply {
+		fmt.Printf("gcloud iam roles create %s --project %s --title gke-ip-update --stage GA --permissions %s\n", a.RoleID, a.ProjectID, strings.Join(perms, ","))
+		fmt.Printf("gcloud projects add-iam-policy-binding %s --member %s --role %s\n", a.ProjectID, member, role)
+		fmt.Println("\nGKE doesn't grant permissions on single clusters, the role applies to every cluster of the project. Run again with --apply to make these changes.")
+		return
+	}
+
+	//the service account of the app usually can't change IAM, the default credentials of an admin are used without --service-account
+	a.setCreds(a.CredentialPath)
+	ctx := context.Background()
+	if err := a.ensureRole(ctx, perms); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Role %s has the permissions %s\n", role, strings.Join(perms, ", "))
+
+	added, err := a.ensureBinding(ctx, role, member)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if added {
+		a.writeLog(fmt.Sprintf("Granted %s to %s on project %s \n", role, member, a.ProjectID))
+		fmt.Printf("Granted %s to %s on project %s\n", role, member, a.ProjectID)
+	} else {
+		fmt.Printf("%s already has %s on project %s\n", member, role, a.ProjectID)
+	}
+}
+
+//create the custom role, or update its permissions if it exists
+func (a *App) ensureRole(ctx context.Context, perms []string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"roleId": a.RoleID,
+		"role": map[string]interface{}{
+			"title":               "gke-ip-update",
+			"description":         "Keeps the master authorized networks of GKE clusters up to date",
+			"includedPermissions": perms,
+			"stage":               "GA",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = a.callAPI(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%s/roles", iamAPI, a.ProjectID), body, nil)
+	if e, ok := err.(*apiError); !ok || e.StatusCode != http.StatusConflict {
+		return err
+	}
+
+	body, err = json.Marshal(map[string]interface{}{"includedPermissions": perms})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/projects/%s/roles/%s?updateMask=includedPermissions", iamAPI, a.ProjectID, a.RoleID)
+	return a.callAPI(ctx, http.MethodPatch, url, body, nil)
+}
+
+//add the member to the unconditional binding of the role in the IAM policy of the project.
+//Reports whether the policy had to be changed.
+func (a *App) ensureBinding(ctx context.Context, role, member string) (bool, error) {
+	//fields of the policy the app doesn't know about are sent back untouched
+	var policy map[string]interface{}
+	body := []byte(`{"options": {"requestedPolicyVersion": 3}}`)
+	if err := a.callAPI(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%s:getIamPolicy", cloudResourceManagerAPI, a.ProjectID), body, &policy); err != nil {
+		return false, err
+	}
+
+	bindings, _ := policy["bindings"].([]interface{})
+	var binding map[string]interface{}
+	for _, b := range bindings {
+		b, ok := b.(map[string]interface{})
+		if _, conditional := b["condition"]; ok && b["role"] == role && !conditional {
+			binding = b
+			break
+		}
+	}
+	if binding == nil {
+		binding = map[string]interface{}{"role": role, "members": []interface{}{}}
+		bindings = append(bindings, binding)
+	}
+
+	members, _ := binding["members"].([]interface{})
+	for _, m := range members {
+		if m == member {
+			return false, nil
+		}
+	}
+	binding["members"] = append(members, member)
+	policy["bindings"] = bindings
+
+	body, err := json.Marshal(map[string]interface{}{"policy": policy})
+	if err != nil {
+		return false, err
+	}
+	return true, a.callAPI(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%s:setIamPolicy", cloudResourceManagerAPI, a.ProjectID), body, nil)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+const (
+	computeAPI = "https://compute.googleapis.com/compute/v1"
+	//where IAP TCP forwarding connects from
+	iapRange = "35.235.240.0/20"
+	//the network tag of the bastion the firewall rule applies to
+	bastionTag = "gke-ip-update-bastion"
+	//how long the cluster has to answer through the tunnel to the bastion
+	tunnelProbeTimeout = 10 * time.Second
+)
+
+//whether the bastion was found running, for --prefer-iap
+//longest the daemon waits for the bastion and the tunnel to answer
+const iapProbeTimeout = 30 * time.Second
+
+type iapAvailability struct {
+	mu        sync.Mutex
+	checked   bool
+	available bool
+}
+
+//print the gcloud commands giving access to the cluster through IAP TCP forwarding instead of authorized networks :
+//a bastion without external IP running tinyproxy in the network of the cluster, the Cloud NAT it installs tinyproxy
+//through, a firewall rule letting IAP reach it and the role allowing --iap-member to open tunnels. Run them with --apply.
+func (a *App) iapSetup() {
+	if err := a.normalizeCluster(); err != nil {
+		log.Fatal(err)
+	}
+	if a.ProjectID == "" {
+		log.Fatal("No project provided")
+	}
+	a.setCreds(a.CredentialPath)
+	if err := a.resolveZone(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	cluster := updater.Cluster{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}
+	containerService, err := a.newContainerService(ctx, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := updater.GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+	zone := a.bastionZone()
+	if zone == "" {
+		log.Fatalf("%s is a regional cluster, give the zone of the bastion with --bastion-zone", a.ClusterID)
+	}
+
+	if !a.Apply {
+		fmt.Printf("gcloud compute firewall-rules create %s-iap --project %s --network %s --direction INGRESS --allow tcp:22 --source-ranges %s --target-tags %s\n",
+			a.Bastion, a.ProjectID, c.Network, iapRange, bastionTag)
+		fmt.Printf("gcloud compute routers create %s-router --project %s --network %s --region %s\n", a.Bastion, a.ProjectID, c.Network, regionOf(zone))
+		fmt.Printf("gcloud compute routers nats create %s-nat --project %s --router %s-router --region %s --auto-allocate-nat-external-ips --nat-custom-subnet-ip-ranges %s\n",
+			a.Bastion, a.ProjectID, a.Bastion, regionOf(zone), c.Subnetwork)
+		fmt.Printf("gcloud compute instances create %s --project %s --zone %s --subnet %s --no-address --machine-type e2-micro --tags %s --image-family debian-12 --image-project debian-cloud --metadata startup-script='apt-get update && apt-get install -y tinyproxy'\n",
+			a.Bastion, a.ProjectID, zone, c.Subnetwork, bastionTag)
+		if a.IAPMember != "" {
+			fmt.Printf("gcloud projects add-iam-policy-binding %s --member %s --role roles/iap.tunnelResourceAccessor\n", a.ProjectID, a.IAPMember)
+		}
+		fmt.Println("\nRun again with --apply to make these changes.")
+		a.printTunnelUsage(zone)
+		return
+	}
+
+	if err := a.ensureFirewall(ctx, c.Network); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Firewall rule %s-iap lets IAP reach %s on port 22\n", a.Bastion, a.Bastion)
+	if err := a.ensureNAT(ctx, regionOf(zone), c.Network, c.Subnetwork); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Cloud NAT %s-nat lets %s install tinyproxy without external IP\n", a.Bastion, a.Bastion)
+	if err := a.ensureBastion(ctx, zone, c.Subnetwork); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Bastion %s runs in %s\n", a.Bastion, zone)
+	if a.IAPMember != "" {
+		added, err := a.ensureBinding(ctx, "roles/iap.tunnelResourceAccessor", a.IAPMember)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if added {
+			a.writeLog(fmt.Sprintf("Granted roles/iap.tunnelResourceAccessor to %s on project %s \n", a.IAPMember, a.ProjectID))
+		}
+		fmt.Printf("%s can open IAP tunnels in project %s\n", a.IAPMember, a.ProjectID)
+	}
+	a.printTunnelUsage(zone)
+}
+
+//the zone of the bastion : --bastion-zone, or the one of a zonal cluster
+func (a *App) bastionZone() string {
+	if a.BastionZone != "" {
+		return a.BastionZone
+	}
+	if regionOf(a.ClusterZone) == a.ClusterZone {
+		return ""
+	}
+	return a.ClusterZone
+}
+
+func (a *App) printTunnelUsage(zone string) {
+	fmt.Println("\nOnce the bastion is up, reach the cluster through the tunnel :")
+	fmt.Printf("gcloud compute ssh %s --project %s --zone %s --tunnel-through-iap -- -L 8888:localhost:8888 -N -q -f\n", a.Bastion, a.ProjectID, zone)
+	fmt.Println("HTTPS_PROXY=localhost:8888 kubectl get nodes")
+}
+
+//create the firewall rule letting IAP connect to the bastion, if it doesn't exist
+func (a *App) ensureFirewall(ctx context.Context, network string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"name":         a.Bastion + "-iap",
+		"network":      fmt.Sprintf("projects/%s/global/networks/%s", a.ProjectID, network),
+		"direction":    "INGRESS",
+		"sourceRanges": []string{iapRange},
+		"targetTags":   []string{bastionTag},
+		"allowed":      []interface{}{map[string]interface{}{"IPProtocol": "tcp", "ports": []string{"22"}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = a.callAPI(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%s/global/firewalls", computeAPI, a.ProjectID), body, nil)
+	if e, ok := err.(*apiError); ok && e.StatusCode == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+//create a Cloud Router with a Cloud NAT for the subnet of the bastion, if it doesn't exist. Without it the bastion,
+//having no external IP, can't download tinyproxy.
+func (a *App) ensureNAT(ctx context.Context, region, network, subnetwork string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"name":    a.Bastion + "-router",
+		"network": fmt.Sprintf("projects/%s/global/networks/%s", a.ProjectID, network),
+		"nats": []interface{}{map[string]interface{}{
+			"name":                          a.Bastion + "-nat",
+			"natIpAllocateOption":           "AUTO_ONLY",
+			"sourceSubnetworkIpRangesToNat": "LIST_OF_SUBNETWORKS",
+			"subnetworks": []interface{}{map[string]interface{}{
+				"name":                fmt.Sprintf("projects/%s/regions/%s/subnetworks/%s", a.ProjectID, region, subnetwork),
+				"sourceIpRangesToNat": []string{"ALL_IP_RANGES"},
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = a.callAPI(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%s/regions/%s/routers", computeAPI, a.ProjectID, region), body, nil)
+	if e, ok := err.(*apiError); ok && e.StatusCode == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+//create the bastion, without external IP and running tinyproxy, if it doesn't exist
+func (a *App) ensureBastion(ctx context.Context, zone, subnetwork string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"name":        a.Bastion,
+		"machineType": fmt.Sprintf("zones/%s/machineTypes/e2-micro", zone),
+		"tags":        map[string]interface{}{"items": []string{bastionTag}},
+		"disks": []interface{}{map[string]interface{}{
+			"boot":             true,
+			"autoDelete":       true,
+			"initializeParams": map[string]string{"sourceImage": "projects/debian-cloud/global/images/family/debian-12"},
+		}},
+		//no access config, the bastion has no external IP
+		"networkInterfaces": []interface{}{map[string]string{
+			"subnetwork": fmt.Sprintf("projects/%s/regions/%s/subnetworks/%s", a.ProjectID, regionOf(zone), subnetwork),
+		}},
+		"metadata": map[string]interface{}{"items": []interface{}{map[string]string{
+			"key":   "startup-script",
+			"value": "apt-get update && apt-get install -y tinyproxy",
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = a.callAPI(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%s/zones/%s/instances", computeAPI, a.ProjectID, zone), body, nil)
+	if e, ok := err.(*apiError); ok && e.StatusCode == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+//check whether the bastion is running and the cluster answers through the tunnel to it, refreshing what --prefer-iap
+//knows about it. A running bastion alone doesn't tell that tinyproxy is up or that the tunnel is open.
+//Reports whether that changed since the last check.
+func (a *App) refreshIAP(ctx context.Context) bool {
+	var instance struct {
+		Status string `json:"status"`
+	}
+	err := errors.New("no --bastion-zone for a regional cluster")
+	if zone := a.bastionZone(); zone != "" {
+		err = a.callAPI(ctx, http.MethodGet, fmt.Sprintf("%s/projects/%s/zones/%s/instances/%s", computeAPI, a.ProjectID, zone, a.Bastion), nil, &instance)
+	}
+	if e, ok := err.(*apiError); err != nil && !(ok && e.StatusCode == http.StatusNotFound) {
+		a.writeLog(fmt.Sprintf("Unable to check the bastion %s : %s \n", a.Bastion, err.Error()))
+	}
+	available := err == nil && instance.Status == "RUNNING"
+	if available {
+		if err := a.tunnelWorks(ctx, a.bastionCluster()); err != nil {
+			a.writeLog(fmt.Sprintf("Bastion %s is running but the cluster doesn't answer through %s : %s \n", a.Bastion, a.IAPProxy, err.Error()))
+			available = false
+		}
+	}
+
+	a.iap.mu.Lock()
+	defer a.iap.mu.Unlock()
+	changed := a.iap.checked && a.iap.available != available
+	a.iap.checked, a.iap.available = true, available
+	if changed && available {
+		a.writeLog(fmt.Sprintf("Bastion %s is running, the cluster is reached through IAP \n", a.Bastion))
+	} else if changed {
+		a.writeLog(fmt.Sprintf("Bastion %s can't be used, falling back to authorized networks \n", a.Bastion))
+	}
+	return changed
+}
+
+//the cluster the bastion serves, the first --cluster
+func (a *App) bastionCluster() updater.Cluster {
+	return updater.Cluster{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}
+}
+
+//check that the master of the cluster answers a TLS handshake through the tunnel listening on --iap-proxy,
+//on its private endpoint when it has one
+func (a *App) tunnelWorks(ctx context.Context, cluster updater.Cluster) error {
+	c, roots, err := a.masterCA(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	host := c.Endpoint
+	if c.PrivateClusterConfig != nil && c.PrivateClusterConfig.PrivateEndpoint != "" {
+		host = c.PrivateClusterConfig.PrivateEndpoint
+	}
+	target := net.JoinHostPort(host, "443")
+
+	dialer := &net.Dialer{Timeout: a.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", a.IAPProxy)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(tunnelProbeTimeout))
+
+	req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: target}, Host: target, Header: http.Header{}}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the proxy answered %s", resp.Status)
+	}
+	return tls.Client(conn, &tls.Config{RootCAs: roots, ServerName: host}).Handshake()
+}
+
+//check whether the IPs of the entries are left out of the cluster, the bastion being there to reach it.
+//Only the cluster the bastion serves is reached through it, the others keep the IPs.
+func (a *App) viaIAP(ctx context.Context, cluster updater.Cluster) bool {
+	if !a.PreferIAP || cluster != a.bastionCluster() {
+		return false
+	}
+	a.iap.mu.Lock()
+	checked := a.iap.checked
+	a.iap.mu.Unlock()
+	if !checked {
+		a.refreshIAP(ctx)
+	}
+
+	a.iap.mu.Lock()
+	defer a.iap.mu.Unlock()
+	return a.iap.available
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//--cluster-interval flags, given as cluster=duration with the cluster named as in --class
+type intervalFlags map[string]time.Duration
+
+func (f intervalFlags) String() string {
+	var specs []string
+	for cluster, d := range f {
+		specs = append(specs, cluster+"="+d.String())
+	}
+	return strings.Join(specs, ",")
+}
+
+func (f intervalFlags) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected cluster=duration, got %q", value)
+	}
+	d, err := time.ParseDuration(value[i+1:])
+	if err != nil || d <= 0 {
+		return fmt.Errorf("expected a positive duration like 1m or 1h, got %q", value[i+1:])
+	}
+	f[value[:i]] = d
+	return nil
+}
+
+//shortest time between two updates of a cluster, 0 when it has no --cluster-interval
+func (a *App) intervalOf(context string, c updater.Cluster) time.Duration {
+	for spec, d := range a.ClusterIntervals {
+		if matchesCluster(spec, context, c) {
+			return d
+		}
+	}
+	return 0
+}
+
+//how often the IPs are checked : the check interval, or the shortest --cluster-interval when it is shorter,
+//so the clusters that want changes sooner get them
+func (a *App) detectInterval() time.Duration {
+	wait := a.checkInterval()
+	for _, d := range a.ClusterIntervals {
+		if d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/container/v1"
+)
+
+//how often the service account keys are checked
+const keyCheckInterval = 24 * time.Hour
+
+//the fields of a service account key file the reminders need
+type keyFile struct {
+	Type         string `json:"type"`
+	PrivateKeyID string `json:"private_key_id"`
+	ClientEmail  string `json:"client_email"`
+}
+
+//the service account key files the app authenticates with
+func (a *App) keyFiles() []string {
+	var paths []string
+	if a.CredentialPath != "" {
+		paths = append(paths, a.CredentialPath)
+	}
+	for _, s := range a.Credentials {
+		if s.kind == "key" {
+			paths = append(paths, s.value)
+		}
+	}
+	return paths
+}
+
+//check the keys every day until the context is done
+func (a *App) remindKeys(ctx context.Context) {
+	for {
+		for _, path := range a.keyFiles() {
+			if err := a.checkKey(ctx, path); err != nil && ctx.Err() == nil {
+				a.writeLog(fmt.Sprintf("Unable to check the service account key %s : %s \n", path, err.Error()))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(keyCheckInterval):
+		}
+	}
+}
+
+//warn when the key is rejected, older than --key-max-age, or close to its rotation or expiry, before it breaks the updates
+func (a *App) checkKey(ctx context.Context, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var k keyFile
+	if err := json.Unmarshal(data, &k); err != nil {
+		return err
+	}
+	if k.Type != "service_account" {
+		return nil
+	}
+
+	creds, err := google.CredentialsFromJSON(a.tokenContext(ctx), data, container.CloudPlatformScope)
+	if err != nil {
+		return err
+	}
+	if _, err := creds.TokenSource.Token(); err != nil {
+		if _, ok := err.(*oauth2.RetrieveError); !ok {
+			return err
+		}
+		message := fmt.Sprintf("Service account key %s of %s is rejected, it was deleted, disabled or expired : %s", k.PrivateKeyID, k.ClientEmail, err.Error())
+		a.writeLog(message + " \n")
+		a.notify("critical", message)
+		return nil
+	}
+
+	created, expires, err := a.keyValidity(ctx, k)
+	if err != nil {
+		//without iam.serviceAccountKeys.get the age of the file has to do
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			return err
+		}
+		a.writeLog(fmt.Sprintf("Unable to read when key %s was created, using the age of %s : %s \n", k.PrivateKeyID, path, err.Error()))
+		created = info.ModTime()
+	}
+
+	//the log line gets the times as RFC3339, the notification for people
+	var logged, notified []string
+	if a.KeyMaxAge > 0 {
+		rotation := created.Add(a.KeyMaxAge)
+		if time.Now().After(rotation) {
+			reminder := fmt.Sprintf("is %d days old, past the %d days of --key-max-age", days(time.Since(created)), days(a.KeyMaxAge))
+			logged, notified = append(logged, reminder), append(notified, reminder)
+		} else if time.Until(rotation) < a.KeyRotationWarning {
+			logged = append(logged, fmt.Sprintf("has to be rotated by %s", logTime(rotation)))
+			notified = append(notified, fmt.Sprintf("has to be rotated %s", relativeTime(rotation)))
+		}
+	}
+	if !expires.IsZero() && time.Until(expires) < a.KeyRotationWarning {
+		logged = append(logged, fmt.Sprintf("expires on %s", logTime(expires)))
+		notified = append(notified, fmt.Sprintf("expires %s, on %s", relativeTime(expires), a.displayTime(expires)))
+	}
+	if len(logged) > 0 {
+		key := fmt.Sprintf("Service account key %s of %s ", k.PrivateKeyID, k.ClientEmail)
+		a.writeLog(key + strings.Join(logged, " and ") + " \n")
+		a.notify("warning", key+strings.Join(notified, " and "))
+	}
+	return nil
+}
+
+//when the key was created and when it expires, zero for keys that don't
+func (a *App) keyValidity(ctx context.Context, k keyFile) (time.Time, time.Time, error) {
+	var key struct {
+		ValidAfterTime  time.Time `json:"validAfterTime"`
+		ValidBeforeTime time.Time `json:"validBeforeTime"`
+	}
+	url := fmt.Sprintf("%s/projects/-/serviceAccounts/%s/keys/%s", iamAPI, k.ClientEmail, k.PrivateKeyID)
+	if err := a.callAPI(ctx, http.MethodGet, url, nil, &key); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	//keys that never expire are valid until the end of 9999
+	if key.ValidBeforeTime.Year() >= 9999 {
+		key.ValidBeforeTime = time.Time{}
+	}
+	return key.ValidAfterTime, key.ValidBeforeTime, nil
+}
+
+//whole days of a duration
+func days(d time.Duration) int {
+	return int(d / (24 * time.Hour))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"gke-ip-update/forwarded"
+)
+
+//answer with the X-Forwarded-For header of the request, or the address of the peer without one.
+//Run behind a GCP HTTP(S) Load Balancer, the client finds its IP as GCP sees it with --ip-source lb.
+func (a *App) echoServer() {
+	addr := a.EchoAddr
+	if port := os.Getenv("PORT"); port != "" && addr == "" {
+		addr = ":" + port
+	}
+	if addr == "" {
+		addr = ":8080"
+	}
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		forwarded := r.Header.Get("X-Forwarded-For")
+		if forwarded == "" {
+			forwarded, _, _ = net.SplitHostPort(r.RemoteAddr)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprintln(w, forwarded)
+	})
+	a.writeLog(fmt.Sprintf("Echoing X-Forwarded-For on %s \n", addr))
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+//ask the echo server behind the load balancer for the X-Forwarded-For it got
+func (a *App) lbEchoIP() (string, error) {
+	resp, err := a.httpClient(detection).Get(a.LBEchoURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s answered %s", a.LBEchoURL, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	//the echo server is a backend of the load balancer
+	return forwarded.Client(string(body), true)
+}
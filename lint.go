@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+//prefixes shorter than this authorize more than a home or office network
+const broadPrefix = 24
+
+//reads of the GKE API more frequent than this eat into the quotas of the project
+const minAPIInterval = time.Minute
+
+//names that other people or tools are likely to use for their own networks too
+var genericNames = map[string]bool{"home": true, "office": true, "work": true, "vpn": true, "laptop": true, "default": true}
+
+//a problem found by lint-config
+type finding struct {
+	level   string
+	message string
+}
+
+//check the flags and the --config file for risky settings, exiting with 1 when one of them is an error
+func (a *App) lintConfig() {
+	findings := a.lint()
+	errors := 0
+	for _, f := range findings {
+		fmt.Printf("%s : %s\n", f.level, f.message)
+		if f.level == "error" {
+			errors++
+		}
+	}
+
+	if len(findings) == 0 {
+		fmt.Println("No problems found")
+	}
+	if errors > 0 {
+		os.Exit(1)
+	}
+}
+
+func (a *App) lint() []finding {
+	var findings []finding
+	add := func(level, format string, args ...interface{}) {
+		findings = append(findings, finding{level, fmt.Sprintf(format, args...)})
+	}
+
+	entries := map[string]bool{}
+	if a.NetworkDisplayName == "" {
+		add("error", "no --network-name, the app wouldn't know which networks it maintains")
+	} else if len(a.Links) == 0 {
+		entries[a.NetworkDisplayName] = true
+	}
+	for _, l := range a.Links {
+		entries[a.NetworkDisplayName+"-"+l.name] = true
+	}
+
+	for _, b := range a.StaticCidrs {
+		lintPrefix(add, "--static-cidr "+b.DisplayName, b.CidrBlock)
+		for name := range entries {
+			if isEntry(b.DisplayName, name) {
+				add("error", "--static-cidr %s has the name of the entry %s, the app would replace it", b.DisplayName, name)
+			}
+		}
+	}
+	for _, d := range a.Declared {
+		if parts := strings.SplitN(d, "=", 2); len(parts) == 2 {
+			lintPrefix(add, "--declare "+parts[0], parts[1])
+		}
+	}
+
+	if (a.Orphans != "warn" || a.Adopt) && genericNames[a.NetworkDisplayName] {
+		add("warning", "--orphans %s and --adopt take over networks by name, %q is common enough to be used by someone else. Prefer a distinctive name like %s-%s", a.Orphans, a.NetworkDisplayName, a.NetworkDisplayName, hostName())
+	}
+
+	if a.ObserveInterval < minAPIInterval {
+		add("warning", "--observe-interval %s reads the cluster more than once a minute, which eats into the GKE API quotas of the project", a.ObserveInterval)
+	}
+	if a.Debounce < 0 {
+		add("error", "--debounce can't be negative")
+	}
+	if a.DigestWindow > 0 && a.DigestWindow < time.Minute {
+		add("warning", "--notify-digest %s is too short to batch anything", a.DigestWindow)
+	}
+	if a.MaxFailures == 0 {
+		add("warning", "--max-failures is 0, a broken setup retries forever")
+	}
+	for _, name := range a.Experimental.enabled() {
+		add("warning", "experiment %s is enabled, its flags and behaviour may change between releases", name)
+	}
+
+	for _, path := range []struct{ flag, path string }{{"--service-account", a.CredentialPath}, {"--config", a.ConfigPath}} {
+		if path.path == "" {
+			continue
+		}
+		perm, err := openPermissions(path.path)
+		if err != nil {
+			add("error", "%s : %s", path.flag, err.Error())
+		} else if perm&0007 != 0 {
+			add("error", "%s %s can be read by every user of the machine (%#o), run chmod 600 %s", path.flag, path.path, perm, path.path)
+		} else if perm != 0 {
+			add("warning", "%s %s can be read by its group (%#o)", path.flag, path.path, perm)
+		}
+	}
+
+	return findings
+}
+
+//flag networks authorizing more than a home or office network
+func lintPrefix(add func(level, format string, a ...interface{}), name, cidr string) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		add("error", "%s : %s", name, err.Error())
+		return
+	}
+
+	ones, _ := network.Mask.Size()
+	switch {
+	case ones == 0:
+		add("error", "%s authorizes every address (%s)", name, cidr)
+	case ones < broadPrefix:
+		add("warning", "%s authorizes %d addresses (%s), narrow it if you can", name, 1<<uint(32-ones), cidr)
+	}
+}
+
+//short name of the machine
+func hostName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "host"
+	}
+	return strings.Split(host, ".")[0]
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+//how long identical messages are folded before the message is written again along with its count
+const repeatWindow = time.Hour
+
+//the last message written to the log, so the identical ones following it are counted instead of written
+type logRepeat struct {
+	message string
+	count   int
+	written time.Time
+}
+
+//write a log line, folding it into a count when it repeats the previous one. The key is the message without
+//what differs between identical errors, like the correlation ID.
+func (a *App) appendLog(key, line string) {
+	a.logMu.Lock()
+	defer a.logMu.Unlock()
+
+	r := &a.lastLog
+	if key == r.message && time.Since(r.written) < repeatWindow {
+		r.count++
+		return
+	}
+	if r.count > 0 {
+		a.writeLine(fmt.Sprintf("last message repeated %d times \n", r.count))
+	}
+	a.lastLog = logRepeat{message: key, written: time.Now()}
+	a.writeLine(line)
+}
+
+//write a line to the log file, rotating it once it holds half of --max-log-size
+func (a *App) writeLine(line string) {
+	n, err := a.logFile.Write([]byte(a.timestamp() + " " + line))
+	if err != nil {
+		log.Fatal("Unable to write to a log file")
+	}
+
+	a.logSize += int64(n)
+	if a.logPath == "" || a.MaxLogSize <= 0 || a.logSize < int64(a.MaxLogSize)<<20/2 {
+		return
+	}
+	if err := a.rotateLog(); err != nil {
+		log.Print("Unable to rotate the log file : ", err)
+	}
+}
+
+//move the log file to <log>.1, replacing the previous one, so the logs never take more than --max-log-size
+func (a *App) rotateLog() error {
+	a.logFile.Close()
+	//Windows doesn't rename over an existing file
+	os.Remove(a.logPath + ".1")
+	renameErr := os.Rename(a.logPath, a.logPath+".1")
+
+	f, err := os.OpenFile(a.logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Fatal("Unable to initialize the log file : ", err)
+	}
+	//a failed rename is tried again once as much was written
+	a.logFile, a.logSize = f, 0
+	return renameErr
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	//recent IPs and observed changes kept with --low-memory
+	lowMemoryHistory = 5
+	//the heap grows by a fifth before a collection instead of doubling
+	lowMemoryGCPercent = 20
+	//how far the clock may be from the one of Google before the first API call
+	maxClockSkew = time.Minute
+	//answers with a Date header over plain HTTP, TLS failing while the clock is wrong
+	clockURL = "http://clients3.google.com/generate_204"
+)
+
+//trade features for memory on small machines like a Raspberry Pi next to the router: no admin server, debug endpoints
+//or mDNS beacon, shorter histories and a more eager garbage collector
+func (a *App) applyLowMemory() {
+	if !a.LowMemory {
+		return
+	}
+	if a.AdminAddr != "" || a.MDNS {
+		a.writeLog("The admin server and the mDNS beacon are disabled by --low-memory \n")
+	}
+	a.AdminAddr = ""
+	a.DebugEndpoints = false
+	a.MDNS = false
+	if a.RecentIPs > lowMemoryHistory {
+		a.RecentIPs = lowMemoryHistory
+	}
+	debug.SetGCPercent(lowMemoryGCPercent)
+}
+
+//changes kept in the observer history
+func (a *App) observedLimit() int {
+	if a.LowMemory {
+		return lowMemoryHistory
+	}
+	return maxObservedChanges
+}
+
+//wait up to --clock-wait for the clock to be synchronized, machines without a real time clock booting with a date far
+//in the past, which fails the TLS handshakes and the tokens until NTP caught up
+func (a *App) waitForClock() {
+	if a.ClockWait <= 0 {
+		return
+	}
+
+	started := time.Now()
+	logged := false
+	for {
+		skew, err := a.clockSkew()
+		if err == nil && skew < maxClockSkew && skew > -maxClockSkew {
+			if logged {
+				a.writeLog("Clock synchronized \n")
+			}
+			return
+		}
+		if time.Since(started) >= a.ClockWait {
+			a.writeLog(fmt.Sprintf("The clock still isn't synchronized after %s, going on anyway \n", a.ClockWait))
+			return
+		}
+		if !logged {
+			if err != nil {
+				a.writeLog(fmt.Sprintf("Unable to check the clock : %s, waiting for the network \n", err.Error()))
+			} else {
+				a.writeLog(fmt.Sprintf("The clock is off by %s, waiting for it to be synchronized \n", skew.Round(time.Second)))
+			}
+			logged = true
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+//how far the clock is behind the Date header of a Google server
+func (a *App) clockSkew() (time.Duration, error) {
+	resp, err := a.httpClient(detection).Head(clockURL)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("no date from %s : %s", clockURL, err.Error())
+	}
+	return time.Until(date), nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"gke-ip-update/updater"
+
+	"google.golang.org/api/container/v1"
+)
+
+const manageHelp = `Commands :
+  add <name> <cidr>       authorize a network, an IP is taken as a /32
+  rm <n>                  remove network n
+  rename <n> <name>       change the name of network n
+  list                    show the networks
+  diff                    show the changes
+  apply                   apply the changes after confirmation
+  quit                    leave without applying`
+
+//edit the networks of the cluster interactively, applying the changes after confirming them
+func (a *App) manage() {
+	ctx := context.Background()
+	a.setCreds(a.CredentialPath)
+	if err := a.resolveZone(); err != nil {
+		log.Fatal(err)
+	}
+	cluster := updater.Cluster{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}
+	containerService, err := a.newContainerService(ctx, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := updater.GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var original []*container.CidrBlock
+	if c.MasterAuthorizedNetworksConfig != nil {
+		original = c.MasterAuthorizedNetworksConfig.CidrBlocks
+	}
+	if c.MasterAuthorizedNetworksConfig == nil || !c.MasterAuthorizedNetworksConfig.Enabled {
+		fmt.Printf("Master authorized networks are disabled on %s, applying changes enables them\n\n", cluster.Name)
+	}
+	var edited []*container.CidrBlock
+	for _, b := range original {
+		edited = append(edited, &container.CidrBlock{DisplayName: b.DisplayName, CidrBlock: b.CidrBlock})
+	}
+
+	st := a.loadState()
+	in := bufio.NewScanner(os.Stdin)
+	a.listNetworks(edited, st)
+	fmt.Println("\n" + manageHelp)
+	for {
+		fmt.Print("> ")
+		if !in.Scan() {
+			return
+		}
+		args := strings.Fields(in.Text())
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "add":
+			if len(args) != 3 {
+				fmt.Println("usage : add <name> <cidr>")
+				continue
+			}
+			cidr := args[2]
+			if !strings.Contains(cidr, "/") {
+				cidr += "/32"
+			}
+			if _, network, err := net.ParseCIDR(cidr); err != nil {
+				fmt.Println(err)
+			} else {
+				edited = append(edited, &container.CidrBlock{DisplayName: args[1], CidrBlock: network.String()})
+			}
+		case "rm", "rename":
+			i := 0
+			if len(args) > 1 {
+				i, _ = strconv.Atoi(args[1])
+			}
+			if i < 1 || i > len(edited) || args[0] == "rename" && len(args) != 3 {
+				fmt.Printf("usage : rm <n> or rename <n> <name>, n from 1 to %d\n", len(edited))
+				continue
+			}
+			if args[0] == "rm" {
+				edited = append(edited[:i-1], edited[i:]...)
+			} else {
+				edited[i-1].DisplayName = args[2]
+			}
+		case "list", "ls":
+			a.listNetworks(edited, st)
+		case "diff":
+			printDiff(original, edited)
+		case "apply":
+			if !printDiff(original, edited) {
+				continue
+			}
+			fmt.Print("Apply these changes ? [y/N] ")
+			if !in.Scan() || !strings.HasPrefix(strings.ToLower(strings.TrimSpace(in.Text())), "y") {
+				fmt.Println("Nothing applied")
+				continue
+			}
+			if err := a.applyNetworks(ctx, containerService, cluster, edited, st); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			original = nil
+			for _, b := range edited {
+				original = append(original, &container.CidrBlock{DisplayName: b.DisplayName, CidrBlock: b.CidrBlock})
+			}
+		case "quit", "exit", "q":
+			if printDiff(original, edited) {
+				fmt.Println("Changes not applied")
+			}
+			return
+		default:
+			fmt.Println(manageHelp)
+		}
+	}
+}
+
+//a network listed by manage, with the number the commands take
+type managedNetwork struct {
+	Number     int    `json:"number"`
+	Name       string `json:"name"`
+	CIDR       string `json:"cidr"`
+	Maintained bool   `json:"maintained,omitempty"`
+}
+
+//print the networks numbered for the commands, marking the ones the app maintains
+func (a *App) listNetworks(blocks []*container.CidrBlock, st *state) {
+	t := newTable("#", "NAME", "CIDR", "NOTE")
+	for i, b := range blocks {
+		n := managedNetwork{Number: i + 1, Name: b.DisplayName, CIDR: b.CidrBlock, Maintained: st.dynamic(b.DisplayName)}
+		note := ""
+		if n.Maintained {
+			note = "maintained by the app"
+		}
+		t.add(n, strconv.Itoa(n.Number), n.Name, n.CIDR, note)
+	}
+	a.printTable(t, "No network")
+}
+
+//print the networks added and removed by the edits. Reports whether there are any.
+func printDiff(original, edited []*container.CidrBlock) bool {
+	removed, added := subtract(describeBlocks(original), describeBlocks(edited)), subtract(describeBlocks(edited), describeBlocks(original))
+	for _, r := range removed {
+		fmt.Println("- " + r)
+	}
+	for _, a := range added {
+		fmt.Println("+ " + a)
+	}
+	if len(removed) == 0 && len(added) == 0 {
+		fmt.Println("No changes")
+		return false
+	}
+	return true
+}
+
+//replace the networks of the cluster, waiting for the operation
+func (a *App) applyNetworks(ctx context.Context, containerService *container.Service, cluster updater.Cluster, blocks []*container.CidrBlock, st *state) error {
+	op, err := updater.SetCidrBlocks(ctx, containerService, cluster, blocks)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Waiting for operation %s\n", op.Name)
+	report := func(message string) {
+		fmt.Println(message)
+	}
+	if err := a.waitOperation(ctx, containerService, cluster, op, st, report); err != nil {
+		return err
+	}
+	//the state loaded when the session started may be behind the changes of a running app
+	saved := a.loadState()
+	saved.LastUpdateDuration = st.LastUpdateDuration
+	a.saveState(saved)
+
+	a.writeLog(fmt.Sprintf("Networks of %s edited with manage : %v \n", cluster.Name, describeBlocks(blocks)))
+	fmt.Println("Changes applied")
+	return nil
+}
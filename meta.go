@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//display names with metadata are kept to this length, fields are dropped from the end of --name-metadata to fit
+const maxDisplayName = 50
+
+//keys of the --name-metadata fields in display names
+var metadataKeys = map[string]string{"time": "t", "owner": "o", "host": "h", "version": "v"}
+
+//what a display name tells about its entry, as name~t:<unix time in base 36>~o:<owner>~h:<host>~v:<version>
+type entryMeta struct {
+	Time    time.Time
+	Owner   string
+	Host    string
+	Version string
+}
+
+//describe the metadata for people, "" when there is none
+func (a *App) describeMeta(m entryMeta) string {
+	var parts []string
+	if !m.Time.IsZero() {
+		parts = append(parts, "since "+a.displayWhen(m.Time))
+	}
+	if m.Owner != "" {
+		parts = append(parts, "owner "+m.Owner)
+	}
+	if m.Host != "" {
+		parts = append(parts, "host "+m.Host)
+	}
+	if m.Version != "" {
+		parts = append(parts, "version "+m.Version)
+	}
+	return strings.Join(parts, ", ")
+}
+
+//check the fields of --name-metadata
+func (a *App) validateNameMetadata() error {
+	for _, f := range a.nameMetadataFields() {
+		if _, ok := metadataKeys[f]; !ok {
+			return fmt.Errorf("unknown --name-metadata field %q, expected time, owner, host or version", f)
+		}
+	}
+	return nil
+}
+
+func (a *App) nameMetadataFields() []string {
+	if a.NameMetadata == "" {
+		return nil
+	}
+	return strings.Split(a.NameMetadata, ",")
+}
+
+//the display name of an entry with the fields of --name-metadata
+func (a *App) formatDisplayName(name string, m entryMeta) string {
+	var fields []string
+	for _, f := range a.nameMetadataFields() {
+		value := ""
+		switch f {
+		case "time":
+			if !m.Time.IsZero() {
+				value = strconv.FormatInt(m.Time.Unix(), 36)
+			}
+		case "owner":
+			value = m.Owner
+		case "host":
+			value = m.Host
+		case "version":
+			value = m.Version
+		}
+		if value != "" {
+			fields = append(fields, "~"+metadataKeys[f]+":"+escapeMeta(value))
+		}
+	}
+
+	for len(fields) > 0 && len(name+strings.Join(fields, "")) > maxDisplayName {
+		fields = fields[:len(fields)-1]
+	}
+	return name + strings.Join(fields, "")
+}
+
+//split a display name into the name of the entry and its metadata. Display names that don't hold metadata are names.
+func parseDisplayName(displayName string) (string, entryMeta) {
+	var m entryMeta
+	parts := strings.Split(displayName, "~")
+	if len(parts) == 1 {
+		return displayName, m
+	}
+
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, ":", 2)
+		if len(kv) != 2 {
+			return displayName, entryMeta{}
+		}
+		value, err := unescapeMeta(kv[1])
+		if err != nil {
+			return displayName, entryMeta{}
+		}
+		switch kv[0] {
+		case "t":
+			sec, err := strconv.ParseInt(value, 36, 64)
+			if err != nil {
+				return displayName, entryMeta{}
+			}
+			m.Time = time.Unix(sec, 0)
+		case "o":
+			m.Owner = value
+		case "h":
+			m.Host = value
+		case "v":
+			m.Version = value
+		default:
+			return displayName, entryMeta{}
+		}
+	}
+	return parts[0], m
+}
+
+//percent-encode the separators so values can be read back
+func escapeMeta(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '~', ':', '%', ' ':
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func unescapeMeta(value string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			b.WriteByte(value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", fmt.Errorf("truncated escape in %q", value)
+		}
+		c, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+//metadata of the entries made by this host, the owner being the user of --users-dir the entry belongs to
+//or the one running the app
+func (a *App) localMeta() func(name string, since time.Time) entryMeta {
+	host, _ := os.Hostname()
+	host = strings.Split(host, ".")[0]
+	owner := ""
+	if u, err := user.Current(); err == nil {
+		owner = u.Username
+	}
+	var tenants []tenant
+	if a.UsersDir != "" {
+		tenants, _ = a.loadTenants()
+	}
+
+	return func(name string, since time.Time) entryMeta {
+		m := entryMeta{Time: since, Owner: owner, Host: host, Version: version}
+		if o := entryOwner(tenants, name); o != "" {
+			m.Owner = o
+		}
+		return m
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDisplayNameMetadata(t *testing.T) {
+	since := time.Unix(1600000000, 0)
+	full := entryMeta{Time: since, Owner: "alice", Host: "laptop", Version: "1.2.3"}
+	long := strings.Repeat("n", 30)
+
+	tests := []struct {
+		name     string
+		fields   string
+		entry    string
+		meta     entryMeta
+		display  string
+		wantMeta entryMeta
+	}{
+		{name: "no metadata", entry: "home", meta: full, display: "home"},
+		{name: "every field", fields: "time,owner,host,version", entry: "home", meta: full, display: "home~t:qgljwg~o:alice~h:laptop~v:1.2.3", wantMeta: full},
+		{name: "fields in the order of the flag", fields: "host,owner", entry: "home", meta: full, display: "home~h:laptop~o:alice", wantMeta: entryMeta{Owner: "alice", Host: "laptop"}},
+		{name: "empty fields left out", fields: "time,owner", entry: "home", meta: entryMeta{Owner: "alice"}, display: "home~o:alice", wantMeta: entryMeta{Owner: "alice"}},
+		{name: "separators escaped", fields: "owner", entry: "home", meta: entryMeta{Owner: "a~b:c d%"}, display: "home~o:a%7Eb%3Ac%20d%25", wantMeta: entryMeta{Owner: "a~b:c d%"}},
+		{name: "last fields dropped to fit", fields: "time,owner,host,version", entry: long, meta: full, display: long + "~t:qgljwg~o:alice", wantMeta: entryMeta{Time: since, Owner: "alice"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newApp(&Config{NameMetadata: tt.fields})
+			display := a.formatDisplayName(tt.entry, tt.meta)
+			if display != tt.display {
+				t.Errorf("formatDisplayName() = %q, want %q", display, tt.display)
+			}
+			if len(display) > maxDisplayName && display != tt.entry {
+				t.Errorf("%q is longer than %d", display, maxDisplayName)
+			}
+
+			name, m := parseDisplayName(display)
+			if name != tt.entry {
+				t.Errorf("parseDisplayName(%q) name = %q, want %q", display, name, tt.entry)
+			}
+			if !m.Time.Equal(tt.wantMeta.Time) || m.Owner != tt.wantMeta.Owner || m.Host != tt.wantMeta.Host || m.Version != tt.wantMeta.Version {
+				t.Errorf("parseDisplayName(%q) meta = %+v, want %+v", display, m, tt.wantMeta)
+			}
+		})
+	}
+}
+
+func TestParseDisplayNameWithoutMetadata(t *testing.T) {
+	//names of the users that only look like metadata are kept whole
+	for _, display := range []string{"office", "a~b", "home~x:1", "home~o:%zz", "home~t:not-base36!"} {
+		t.Run(display, func(t *testing.T) {
+			name, m := parseDisplayName(display)
+			if name != display || m != (entryMeta{}) {
+				t.Errorf("parseDisplayName(%q) = %q, %+v, want the name without metadata", display, name, m)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+
+	"google.golang.org/api/container/v1"
+)
+
+//what the authorized networks of a cluster were made of after its last reconcile
+type networkComposition struct {
+	Total   int `json:"total"`
+	Managed int `json:"managed"`
+	//networks the cluster takes at most
+	Limit int `json:"limit"`
+	//when the oldest network maintained by the app got its CIDR
+	OldestManaged time.Time `json:"oldestManaged,omitempty"`
+	//the updates written to the cluster since the app started, and the correlation ID of the reconcile of the last one
+	Updates           int    `json:"updates"`
+	LastCorrelationID string `json:"lastCorrelationId,omitempty"`
+}
+
+//record the networks of the cluster once a change was applied to it by the reconcile id, counting it as an update
+//when it started an operation
+func (a *App) recordComposition(cluster updater.Cluster, change *updater.Change, managed func(displayName string) bool, st *state, id string) {
+	c := networkComposition{OldestManaged: st.oldestEntry(), Limit: change.Limit}
+	if c.Limit == 0 {
+		c.Limit = updater.MaxAuthorizedNetworks
+	}
+	for _, blocks := range [][]*container.CidrBlock{change.Added, change.Kept} {
+		for _, b := range blocks {
+			c.Total++
+			if managed(b.DisplayName) {
+				c.Managed++
+			}
+		}
+	}
+
+	a.status.set(func(s *appStatus) {
+		if s.Networks == nil {
+			s.Networks = map[string]networkComposition{}
+		}
+		previous := s.Networks[cluster.ResourceName()]
+		c.Updates, c.LastCorrelationID = previous.Updates, previous.LastCorrelationID
+		if change.Operation != nil {
+			c.Updates++
+			c.LastCorrelationID = id
+		}
+		s.Networks[cluster.ResourceName()] = c
+	})
+}
+
+//when the oldest entry of the state got its CIDR : the current IPs from when they were first seen,
+//the previous IPs from when they were replaced and the temporary entries from when they were added
+func (st *state) oldestEntry() time.Time {
+	var oldest time.Time
+	older := func(t time.Time) {
+		if !t.IsZero() && (oldest.IsZero() || t.Before(oldest)) {
+			oldest = t
+		}
+	}
+	for name := range st.IPs {
+		older(st.Since[name])
+	}
+	for _, p := range st.History {
+		older(p.Replaced)
+	}
+	for _, t := range st.Temporary {
+		if st.app.applicable(t) {
+			older(t.Added)
+		}
+	}
+	return oldest
+}
+
+//a gauge or counter of /metrics. The alert rules and dashboard of `observability export` are generated from them.
+type metric struct {
+	name string
+	help string
+	//counters are named with _total and can carry exemplars
+	counter bool
+	//unit of the dashboard panel, as Grafana names them
+	unit string
+	//the samples of the gauge, called with the status locked
+	collect func(s *appStatus) []sample
+	//the alert fired on the gauge, none when alert is empty : when the gauge, or the expression of alertOf where %[1]s
+	//is its name, compares to threshold. The summary can use $labels and $value.
+	alert     string
+	alertOf   string
+	threshold string
+	after     string
+	severity  string
+	summary   string
+}
+
+//the expression of the alert of the metric
+func (m metric) expr() string {
+	of := m.name
+	if m.alertOf != "" {
+		of = fmt.Sprintf(m.alertOf, m.name)
+	}
+	return of + " " + m.threshold
+}
+
+//a value of a metric, labelled by cluster unless cluster is empty. The exemplar of a counter is the correlation ID
+//of the reconcile that last increased it.
+type sample struct {
+	cluster  string
+	value    float64
+	exemplar string
+}
+
+//the gauges served on /metrics
+var metrics = []metric{
+	{
+		name: "gke_ip_update_authorized_networks", help: "Networks in the master authorized networks of the cluster.", unit: "short",
+		collect: func(s *appStatus) []sample {
+			return s.perCluster(func(c networkComposition) (float64, bool) { return float64(c.Total), true })
+		},
+		//the limit depends on the cluster, 50 or 100 with a private endpoint only
+		alert: "GkeIpUpdateNetworkLimit", alertOf: "%[1]s / %[1]s_limit", threshold: ">= 0.9", after: "15m", severity: "warning",
+		summary: "{{ $labels.cluster }} uses {{ $value | humanizePercentage }} of the authorized networks GKE takes",
+	},
+	{
+		name: "gke_ip_update_authorized_networks_limit", help: "Networks the master authorized networks of the cluster take at most.", unit: "short",
+		collect: func(s *appStatus) []sample {
+			return s.perCluster(func(c networkComposition) (float64, bool) { return float64(c.Limit), true })
+		},
+	},
+	{
+		name: "gke_ip_update_managed_networks", help: "Networks of the cluster maintained by gke-ip-update.", unit: "short",
+		collect: func(s *appStatus) []sample {
+			return s.perCluster(func(c networkComposition) (float64, bool) { return float64(c.Managed), true })
+		},
+	},
+	{
+		name: "gke_ip_update_cluster_updates_total", help: "Updates written to the cluster since the app started.", unit: "short", counter: true,
+		collect: func(s *appStatus) []sample {
+			samples := s.perCluster(func(c networkComposition) (float64, bool) { return float64(c.Updates), true })
+			for i := range samples {
+				samples[i].exemplar = s.Networks[samples[i].cluster].LastCorrelationID
+			}
+			return samples
+		},
+	},
+	{
+		name: "gke_ip_update_oldest_managed_network_age_seconds", help: "Age of the oldest network maintained by gke-ip-update.", unit: "s",
+		collect: func(s *appStatus) []sample {
+			return s.perCluster(func(c networkComposition) (float64, bool) {
+				return time.Since(c.OldestManaged).Seconds(), !c.OldestManaged.IsZero()
+			})
+		},
+		alert: "GkeIpUpdateStaleNetwork", threshold: "> 90 * 86400", after: "1h", severity: "info",
+		summary: "A network maintained in {{ $labels.cluster }} is more than 90 days old, check it's still needed",
+	},
+	{
+		name: "gke_ip_update_last_check_timestamp_seconds", help: "Unix time of the last check of the IPs.", unit: "dateTimeFromNow",
+		collect: func(s *appStatus) []sample {
+			if s.LastCheck.IsZero() {
+				return nil
+			}
+			return []sample{{value: float64(s.LastCheck.Unix())}}
+		},
+		alert: "GkeIpUpdateNotChecking", alertOf: "time() - %[1]s", threshold: "> 1800", after: "5m", severity: "critical",
+		summary: "gke-ip-update hasn't checked the IPs for more than 30 minutes",
+	},
+	{
+		name: "gke_ip_update_failing", help: "1 while the last check or update failed.", unit: "short",
+		collect: func(s *appStatus) []sample {
+			if s.LastCheck.IsZero() {
+				return nil
+			}
+			failing := 0.0
+			if s.LastError != "" {
+				failing = 1
+			}
+			return []sample{{value: failing}}
+		},
+		alert: "GkeIpUpdateFailing", threshold: "== 1", after: "30m", severity: "warning",
+		summary: "gke-ip-update has been failing for 30 minutes, see /status for the error",
+	},
+}
+
+//a sample per cluster, for the clusters value has one for
+func (s *appStatus) perCluster(value func(c networkComposition) (float64, bool)) []sample {
+	var clusters []string
+	for name := range s.Networks {
+		clusters = append(clusters, name)
+	}
+	sort.Strings(clusters)
+
+	var samples []sample
+	for _, name := range clusters {
+		if v, ok := value(s.Networks[name]); ok {
+			samples = append(samples, sample{cluster: name, value: v})
+		}
+	}
+	return samples
+}
+
+//serve the metrics in the Prometheus text format, or in OpenMetrics when the scraper asks for it. Only OpenMetrics
+//carries the exemplars of the counters, linking them to the logs of the reconcile.
+func (a *App) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	a.status.mu.Lock()
+	collected := make([][]sample, len(metrics))
+	for i, m := range metrics {
+		collected[i] = m.collect(a.status)
+	}
+	a.status.mu.Unlock()
+
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	}
+	for i, m := range metrics {
+		family, kind := m.name, "gauge"
+		if m.counter {
+			kind = "counter"
+			//OpenMetrics names the family without the suffix of its samples
+			if openMetrics {
+				family = strings.TrimSuffix(m.name, "_total")
+			}
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family, m.help, family, kind)
+		for _, s := range collected[i] {
+			labels := ""
+			if s.cluster != "" {
+				labels = fmt.Sprintf("{cluster=%q}", s.cluster)
+			}
+			exemplar := ""
+			if openMetrics && s.exemplar != "" {
+				exemplar = fmt.Sprintf(" # {correlation_id=%q} 1", s.exemplar)
+			}
+			fmt.Fprintf(w, "%s%s %s%s\n", m.name, labels, strconv.FormatFloat(s.value, 'f', -1, 64), exemplar)
+		}
+	}
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//--cluster flags. The first one is the cluster of the commands working on a single one, the daemon and --once update them all.
+type clusterFlags []string
+
+func (c *clusterFlags) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *clusterFlags) Set(value string) error {
+	*c = append(*c, value)
+	return nil
+}
+
+//the clusters to update : the first --cluster, already normalized, then the others with the project of --project
+//when they don't name one and their location looked up when they don't give it
+func (a *App) clusters() ([]updater.Cluster, error) {
+	clusters := []updater.Cluster{{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}}
+	if len(a.Clusters) < 2 {
+		return clusters, nil
+	}
+
+	for _, spec := range a.Clusters[1:] {
+		c, err := updater.ParseCluster(spec)
+		if err != nil {
+			return nil, err
+		}
+		if c.Project == "" {
+			c.Project = a.ProjectID
+		}
+		if c.Zone == "" && a.SimulateIPs == "" {
+			ctx := context.Background()
+			containerService, err := a.newContainerService(ctx, c)
+			if err != nil {
+				return nil, err
+			}
+			if c, err = updater.FindCluster(ctx, containerService, c.Project, c.Name); err != nil {
+				return nil, err
+			}
+			a.writeLog(fmt.Sprintf("Found cluster %s in %s \n", c.Name, c.Zone))
+		}
+		for _, seen := range clusters {
+			if seen == c {
+				return nil, fmt.Errorf("cluster %s is given twice", c.ResourceName())
+			}
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+//what updating one cluster outside of the pipeline gave
+type clusterUpdate struct {
+	cluster updater.Cluster
+	//the snapshot of the state applied
+	st      *state
+	id      string
+	change  *updater.Change
+	elapsed time.Duration
+	smoke   *smokeResult
+	err     error
+	paused  bool
+	//whether its updates were disabled after too many failures
+	disabled bool
+}
+
+//update the clusters in parallel, each with a snapshot of the state, under the correlation ID of the state.
+//What they applied is recorded in the state once they are all done.
+func (a *App) updateClusters(clusters []updater.Cluster, st *state, reason string) []clusterUpdate {
+	updates := make([]clusterUpdate, len(clusters))
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		updates[i] = clusterUpdate{cluster: cluster, st: st.snapshot(), paused: a.isPaused("", cluster), disabled: st.disabled(cluster.ResourceName())}
+		if updates[i].paused {
+			a.writeLog(fmt.Sprintf("Updates of %s are paused, run `gke-ip-update resume` to resume them \n", cluster.Name))
+			continue
+		}
+		if updates[i].disabled {
+			a.writeLog(fmt.Sprintf("Updates of %s are disabled after too many failures, run `gke-ip-update resume` to enable them \n", cluster.ResourceName()))
+			continue
+		}
+
+		wg.Add(1)
+		go func(u *clusterUpdate) {
+			defer wg.Done()
+			started := time.Now()
+			ctx := updater.WithCorrelationID(context.Background(), st.correlationID)
+			if st.correlationID == "" {
+				ctx = reconcileContext(context.Background())
+			}
+			u.id = updater.CorrelationID(ctx)
+			u.change, u.err = a.setGKEIP(ctx, u.cluster, u.st, reason)
+			u.smoke = a.smokeTest(ctx, u.change, u.err)
+			u.elapsed = time.Since(started)
+		}(&updates[i])
+	}
+	wg.Wait()
+
+	var names []string
+	for _, cluster := range clusters {
+		names = append(names, cluster.ResourceName())
+	}
+	for _, u := range updates {
+		if u.paused || u.disabled {
+			continue
+		}
+		if u.st.LastUpdateDuration != 0 {
+			st.LastUpdateDuration = u.st.LastUpdateDuration
+		}
+		st.cleaned(u.st, u.err, u.cluster.ResourceName(), names)
+	}
+	return updates
+}
+
+//record the error of a cluster in the status, or that it's up to date when err is nil
+func (s *appStatus) recordCluster(cluster updater.Cluster, err error) {
+	s.set(func(s *appStatus) {
+		if err == nil {
+			delete(s.Errors, cluster.ResourceName())
+			return
+		}
+		if s.Errors == nil {
+			s.Errors = map[string]string{}
+		}
+		s.Errors[cluster.ResourceName()] = err.Error()
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+//how long the network has to stay quiet before a check, so DHCP and the routes are done when the IPs are looked up
+const networkSettle = 5 * time.Second
+
+//trigger a check when the addresses or links of the machine change, like a SIGHUP.
+//The watcher is restarted a minute after failing.
+func (a *App) watchNetworkChanges(ctx context.Context, trigger chan<- struct{}) {
+	changed := make(chan struct{}, 1)
+	go func() {
+		for {
+			err := watchNetwork(ctx, changed)
+			if ctx.Err() != nil {
+				return
+			}
+			a.writeLog(fmt.Sprintf("Unable to watch the network : %s \n", err.Error()))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Minute):
+			}
+		}
+	}()
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			settle = time.After(networkSettle)
+		case <-settle:
+			settle = nil
+			a.writeLog("Network changed, checking the IPs \n")
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+//signal a change without blocking the watcher, one pending change is enough
+func networkChanged(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
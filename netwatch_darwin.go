@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+)
+
+//read the routing socket until ctx is done, addresses being added or removed and interfaces going up or down
+func watchNetwork(ctx context.Context, changed chan<- struct{}) error {
+	fd, err := syscall.Socket(syscall.AF_ROUTE, syscall.SOCK_RAW, syscall.AF_UNSPEC)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	syscall.CloseOnExec(fd)
+	//non blocking so the runtime poller serves the reads and closing the file stops them
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return os.NewSyscallError("setnonblock", err)
+	}
+	f := os.NewFile(uintptr(fd), "route")
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	buf := make([]byte, os.Getpagesize())
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			return err
+		}
+		//every message starts with its length on 2 bytes, the version and the type
+		if n < 4 {
+			continue
+		}
+		switch buf[3] {
+		case syscall.RTM_NEWADDR, syscall.RTM_DELADDR, syscall.RTM_IFINFO:
+			networkChanged(changed)
+		}
+	}
+}
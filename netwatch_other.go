@@ -0,0 +1,14 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+func watchNetwork(ctx context.Context, changed chan<- struct{}) error {
+	return fmt.Errorf("--watch-network isn't available on %s", runtime.GOOS)
+}
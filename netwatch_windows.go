@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"syscall"
+)
+
+var notifyAddrChange = syscall.NewLazyDLL("iphlpapi.dll").NewProc("NotifyAddrChange")
+
+//wait for NotifyAddrChange until ctx is done. The call blocks until the IPv4 addresses change and can't be cancelled,
+//so it runs on its own and the last one outlives ctx until the next change.
+func watchNetwork(ctx context.Context, changed chan<- struct{}) error {
+	if err := notifyAddrChange.Find(); err != nil {
+		return err
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		for ctx.Err() == nil {
+			if r, _, _ := notifyAddrChange.Call(0, 0); r != 0 {
+				errs <- syscall.Errno(r)
+				return
+			}
+			networkChanged(changed)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errs:
+		return err
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//a note left on a cluster for the other operators, like a migration in progress
+type clusterNote struct {
+	Text  string    `json:"text"`
+	By    string    `json:"by,omitempty"`
+	Added time.Time `json:"added"`
+}
+
+//the notes of the clusters by resource name, kept in notes.json in the state directory
+func (a *App) loadNotes() (map[string]clusterNote, error) {
+	notes := map[string]clusterNote{}
+	data, err := a.readStateFile("notes.json")
+	if os.IsNotExist(err) {
+		return notes, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &notes)
+	}
+	return notes, err
+}
+
+//the note of a cluster, "" when it has none
+func (a *App) noteOf(cluster updater.Cluster) string {
+	notes, err := a.loadNotes()
+	if err != nil {
+		a.writeLog(fmt.Sprintf("Unable to read the notes : %s \n", err.Error()))
+		return ""
+	}
+	return notes[cluster.ResourceName()].Text
+}
+
+//leave a note on --cluster, remove it with --clear, or list the notes without either.
+//Notes are shown in /status, the results of --once and the failure notifications of the cluster.
+func (a *App) note(args []string) {
+	notes, err := a.loadNotes()
+	if err != nil {
+		log.Fatal(err)
+	}
+	text := strings.TrimSpace(strings.Join(args, " "))
+	if text == "" && !a.ClearNote {
+		a.listNotes(notes)
+		return
+	}
+
+	key := a.clusterKey("No cluster provided, give the cluster the note is about with --cluster")
+	if a.ClearNote {
+		delete(notes, key)
+	} else {
+		notes[key] = clusterNote{Text: text, By: currentUser(), Added: time.Now()}
+	}
+
+	data, err := json.MarshalIndent(notes, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := a.writeStateFile("notes.json", data); err != nil {
+		log.Fatal(err)
+	}
+	if a.ClearNote {
+		fmt.Printf("Note of %s removed\n", key)
+	} else {
+		fmt.Printf("Note left on %s\n", key)
+	}
+}
+
+//a row of the listing of the notes
+type noteRow struct {
+	Cluster string `json:"cluster"`
+	clusterNote
+}
+
+func (a *App) listNotes(notes map[string]clusterNote) {
+	a.validateOutput()
+	var clusters []string
+	for name := range notes {
+		clusters = append(clusters, name)
+	}
+	sort.Strings(clusters)
+
+	t := newTable("CLUSTER", "NOTE", "BY", "ADDED")
+	t.timeColumn("added", func(record interface{}) time.Time { return record.(noteRow).Added })
+	for _, name := range clusters {
+		n := notes[name]
+		t.add(noteRow{name, n}, name, n.Text, n.By, a.displayWhen(n.Added))
+	}
+	a.printTable(t, "No note")
+}
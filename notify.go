@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+
+	"google.golang.org/api/container/v1"
+)
+
+//something the user is told about. The fields after Time are only set for updates of the cluster.
+type event struct {
+	Level     string       `json:"level"`
+	Message   string       `json:"message"`
+	Host      string       `json:"host"`
+	Owner     string       `json:"owner,omitempty"`
+	Time      time.Time    `json:"time"`
+	OldIPs    []string     `json:"oldIps,omitempty"`
+	NewIPs    []string     `json:"newIps,omitempty"`
+	Clusters  []string     `json:"clusters,omitempty"`
+	Duration  string       `json:"duration,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	SmokeTest *smokeResult `json:"smokeTest,omitempty"`
+	//the reconcile the event comes from
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+//a channel notifications are sent to
+type notifier interface {
+	notify(e event) error
+}
+
+//notifiers that also keep track of the IP of every entry
+type ipPublisher interface {
+	publishIPs(ips map[string]string) error
+}
+
+//--notify-webhook, --notify-slack and --notify-mqtt flags
+type webhookFlags []string
+
+func (w *webhookFlags) String() string {
+	return strings.Join(*w, ",")
+}
+
+func (w *webhookFlags) Set(value string) error {
+	*w = append(*w, value)
+	return nil
+}
+
+//POSTs events as JSON
+type webhookNotifier struct {
+	app *App
+	url string
+}
+
+func (n webhookNotifier) notify(e event) error {
+	body, ok, err := n.app.renderEvent("webhook", e)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return n.app.post(n.url, body)
+	}
+	return n.app.postJSON(n.url, e)
+}
+
+//posts events to a Slack incoming webhook
+type slackNotifier struct {
+	app *App
+	url string
+}
+
+func (n slackNotifier) notify(e event) error {
+	from := e.Host
+	if e.Owner != "" {
+		from += " (" + e.Owner + ")"
+	}
+	text := fmt.Sprintf("*%s* %s : %s", e.Level, from, e.Message)
+	rendered, ok, err := n.app.renderEvent("slack", e)
+	if err != nil {
+		return err
+	}
+	if ok {
+		text = string(rendered)
+	}
+	return n.app.postJSON(n.url, map[string]string{"text": text})
+}
+
+func (a *App) postJSON(url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return a.post(url, body)
+}
+
+func (a *App) post(url string, body []byte) error {
+	resp, err := a.httpClient(outbound).Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
+
+//the notifiers configured with flags
+func (a *App) notifiers() []notifier {
+	var n []notifier
+	for _, url := range a.Webhooks {
+		n = append(n, webhookNotifier{app: a, url: url})
+	}
+	for _, url := range a.SlackWebhooks {
+		n = append(n, slackNotifier{app: a, url: url})
+	}
+	for _, broker := range a.MQTTBrokers {
+		u, err := url.Parse(broker)
+		if err != nil {
+			a.writeLog(fmt.Sprintf("Ignoring MQTT broker %s : %s \n", broker, err.Error()))
+			continue
+		}
+		n = append(n, mqttNotifier{app: a, broker: u})
+	}
+	return n
+}
+
+//send an event to every notifier, or hold it back for the digest with --notify-digest
+func (a *App) notify(level, message string) {
+	a.notifyEvent(event{Level: level, Message: message})
+}
+
+//notify with the fields of an update
+func (a *App) notifyEvent(e event) {
+	e.Host, _ = os.Hostname()
+	e.Owner = a.Owner
+	e.Time = time.Now()
+	if !a.addToDigest(e) {
+		a.send(e)
+	}
+}
+
+//send an event to every notifier, logging the ones that fail
+func (a *App) send(e event) {
+	for _, n := range a.notifiers() {
+		if err := n.notify(e); err != nil {
+			a.writeLog(fmt.Sprintf("Unable to send notification : %s \n", err.Error()))
+		}
+	}
+}
+
+//publish the IPs of the entries to the notifiers keeping track of them
+func (a *App) publishIPs(ips map[string]string) {
+	for _, n := range a.notifiers() {
+		if p, ok := n.(ipPublisher); ok {
+			if err := p.publishIPs(ips); err != nil {
+				a.writeLog(fmt.Sprintf("Unable to publish the IPs : %s \n", err.Error()))
+			}
+		}
+	}
+}
+
+//tell the user about the outcome of an update and how long it took, failures at the level of the class of the cluster.
+//A failed --smoke-test turns the notification into a warning.
+func (a *App) notifyUpdate(id string, cluster updater.Cluster, change *updater.Change, duration time.Duration, err error, c class, smoke *smokeResult) {
+	e := event{Clusters: []string{cluster.Name}, Duration: duration.Round(time.Second).String(), CorrelationID: id}
+	if err != nil && c.failureLevel == "" {
+		return
+	}
+	if err != nil {
+		e.Level = c.failureLevel
+		e.Error = err.Error()
+		e.Message = fmt.Sprintf("Unable to update the authorized networks of %s : %s", cluster.Name, err.Error())
+		if note := a.noteOf(cluster); note != "" {
+			e.Message += fmt.Sprintf(" (note : %s)", note)
+		}
+		a.notifyEvent(e)
+		return
+	}
+	if change == nil || change.Operation == nil {
+		return
+	}
+
+	message := fmt.Sprintf("Authorized networks of %s updated", cluster.Name)
+	if len(change.Added) > 0 {
+		message += ", added " + strings.Join(describeBlocks(change.Added), ", ")
+	}
+	if len(change.Removed) > 0 {
+		message += ", removed " + strings.Join(describeBlocks(change.Removed), ", ")
+	}
+	e.Level = "info"
+	if smoke != nil {
+		message += ", " + smoke.String()
+		e.SmokeTest = smoke
+		if !smoke.Passed {
+			e.Level = "warning"
+		}
+	}
+	e.Message = message
+	e.NewIPs = blockIPs(change.Added)
+	e.OldIPs = blockIPs(change.Removed)
+	a.notifyEvent(e)
+}
+
+//the addresses of the blocks, without the /32 of single IPs
+func blockIPs(blocks []*container.CidrBlock) []string {
+	var ips []string
+	for _, b := range blocks {
+		ips = append(ips, strings.TrimSuffix(b.CidrBlock, "/32"))
+	}
+	return ips
+}
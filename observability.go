@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+//write Prometheus alert rules and a Grafana dashboard for the gauges of /metrics into --export-dir.
+//Both are generated from the metrics the app serves, so they follow renames and new gauges.
+func (a *App) exportObservability() {
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"gke-ip-update-rules.yml", alertRules()},
+		{"gke-ip-update-dashboard.json", dashboard()},
+	}
+	for _, f := range files {
+		path := filepath.Join(a.ExportDir, f.name)
+		if err := ioutil.WriteFile(path, f.data, 0644); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(path)
+	}
+}
+
+//the alerts of the metrics as a Prometheus rule file
+func alertRules() []byte {
+	var b strings.Builder
+	b.WriteString("groups:\n  - name: gke-ip-update\n    rules:\n")
+	for _, m := range metrics {
+		if m.alert == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "      - alert: %s\n", m.alert)
+		fmt.Fprintf(&b, "        expr: %q\n", m.expr())
+		fmt.Fprintf(&b, "        for: %s\n", m.after)
+		fmt.Fprintf(&b, "        labels:\n          severity: %s\n", m.severity)
+		fmt.Fprintf(&b, "        annotations:\n          summary: %q\n          description: %q\n", m.summary, m.help)
+	}
+	return []byte(b.String())
+}
+
+//a Grafana dashboard with a panel per metric, reading from the Prometheus data source picked in the dashboard
+func dashboard() []byte {
+	var panels []map[string]interface{}
+	for i, m := range metrics {
+		//counters are drawn as the updates of the last hour, with the exemplars linking to their reconcile
+		expr := m.name
+		if m.counter {
+			expr = fmt.Sprintf("increase(%s[1h])", m.name)
+		}
+		panels = append(panels, map[string]interface{}{
+			"id":          i + 1,
+			"type":        "timeseries",
+			"title":       m.name,
+			"description": m.help,
+			"datasource":  map[string]string{"type": "prometheus", "uid": "${datasource}"},
+			"gridPos":     map[string]int{"h": 8, "w": 12, "x": (i % 2) * 12, "y": (i / 2) * 8},
+			"fieldConfig": map[string]interface{}{"defaults": map[string]string{"unit": m.unit}, "overrides": []interface{}{}},
+			"targets": []map[string]interface{}{{
+				"refId":        "A",
+				"expr":         expr,
+				"legendFormat": "{{cluster}}",
+				"exemplar":     m.counter,
+			}},
+		})
+	}
+
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"title":         "gke-ip-update",
+		"uid":           "gke-ip-update",
+		"tags":          []string{"gke-ip-update"},
+		"schemaVersion": 36,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-7d", "to": "now"},
+		"templating": map[string]interface{}{"list": []map[string]interface{}{{
+			"name":  "datasource",
+			"label": "Data source",
+			"type":  "datasource",
+			"query": "prometheus",
+		}}},
+		"panels": panels,
+	}, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return append(data, '\n')
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//changes kept in the observer history
+const maxObservedChanges = 500
+
+//what the observer last saw in the cluster, along with the changes it saw before
+type observed struct {
+	Enabled  bool             `json:"enabled"`
+	Networks []string         `json:"networks"`
+	Checked  time.Time        `json:"checked"`
+	History  []observedChange `json:"history,omitempty"`
+}
+
+//a change to the authorized networks seen by the observer, networks are given as name=cidr
+type observedChange struct {
+	Time    time.Time `json:"time"`
+	Enabled *bool     `json:"enabled,omitempty"`
+	Added   []string  `json:"added,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+}
+
+func (c observedChange) String() string {
+	var parts []string
+	if c.Enabled != nil {
+		parts = append(parts, fmt.Sprintf("master authorized networks enabled : %t", *c.Enabled))
+	}
+	if len(c.Added) > 0 {
+		parts = append(parts, fmt.Sprintf("added %v", c.Added))
+	}
+	if len(c.Removed) > 0 {
+		parts = append(parts, fmt.Sprintf("removed %v", c.Removed))
+	}
+	return strings.Join(parts, ", ")
+}
+
+//watch the authorized networks of the cluster without changing them, recording and notifying every change.
+//Only needs container.clusters.get (and container.clusters.list when --location isn't given).
+func (a *App) observe() {
+	a.keepsRunning = true
+	if a.AdminAddr != "" {
+		//observing applies no temporary entry
+		a.serveStatus(a.AdminAddr, false)
+	}
+	a.setCreds(a.CredentialPath)
+	if err := a.resolveZone(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trigger := make(chan struct{}, 1)
+	go a.handleSignals(ctx, cancel, trigger)
+
+	cluster := updater.Cluster{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}
+	a.writeLog(fmt.Sprintf("Observing the authorized networks of %s \n", a.ClusterID))
+	for {
+		var err error
+		a.recovered("observer", func() {
+			err = a.observeOnce(ctx, cluster)
+		})
+		if err != nil && ctx.Err() == nil {
+			a.writeLog(fmt.Sprintf("Unable to read the authorized networks : %s \n", err.Error()))
+		}
+		a.status.record(nil, err)
+
+		select {
+		case <-ctx.Done():
+			a.flushDigest()
+			a.writeLog("Stopped \n")
+			return
+		case <-trigger:
+		case <-time.After(a.ObserveInterval):
+		}
+	}
+}
+
+//compare the authorized networks of the cluster with the ones seen last time
+func (a *App) observeOnce(ctx context.Context, cluster updater.Cluster) error {
+	containerService, err := a.newContainerService(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	c, err := updater.GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		return err
+	}
+
+	now := observed{Checked: time.Now()}
+	if c.MasterAuthorizedNetworksConfig != nil {
+		now.Enabled = c.MasterAuthorizedNetworksConfig.Enabled
+		now.Networks = describeBlocks(c.MasterAuthorizedNetworksConfig.CidrBlocks)
+	}
+	sort.Strings(now.Networks)
+
+	last, err := a.loadObserved()
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		a.writeLog(fmt.Sprintf("First look at %s : %d authorized networks, enabled : %t \n", cluster.Name, len(now.Networks), now.Enabled))
+		if u := a.undeclared(now.Networks); len(u) > 0 {
+			a.reportDrift(ctx, cluster, u, time.Time{})
+		}
+		return a.saveObserved(now)
+	}
+
+	change := observedChange{Time: now.Checked, Added: subtract(now.Networks, last.Networks), Removed: subtract(last.Networks, now.Networks)}
+	if now.Enabled != last.Enabled {
+		change.Enabled = &now.Enabled
+	}
+	now.History = last.History
+	if change.Enabled != nil || len(change.Added) > 0 || len(change.Removed) > 0 {
+		message := fmt.Sprintf("Authorized networks of %s changed : %s", cluster.Name, change)
+		a.writeLog(message + " \n")
+		a.notify("warning", message)
+
+		if u := a.undeclared(change.Added); len(u) > 0 {
+			a.reportDrift(ctx, cluster, u, last.Checked)
+		}
+
+		now.History = append([]observedChange{change}, now.History...)
+		if len(now.History) > a.observedLimit() {
+			now.History = now.History[:a.observedLimit()]
+		}
+	}
+
+	return a.saveObserved(now)
+}
+
+//the networks in a that aren't in b
+func subtract(a, b []string) []string {
+	in := map[string]bool{}
+	for _, n := range b {
+		in[n] = true
+	}
+
+	var d []string
+	for _, n := range a {
+		if !in[n] {
+			d = append(d, n)
+		}
+	}
+	return d
+}
+
+//read what the observer saw last, nil the first time
+func (a *App) loadObserved() (*observed, error) {
+	data, err := a.readStateFile("observed.json")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	o := &observed{}
+	if err := json.Unmarshal(data, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (a *App) saveObserved(o observed) error {
+	data, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.writeStateFile("observed.json", data)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+//outcome of --once
+type runResult struct {
+	IPs      map[string]string `json:"ips"`
+	Clusters []clusterResult   `json:"clusters"`
+	Error    string            `json:"error,omitempty"`
+}
+
+//what was done to one cluster
+type clusterResult struct {
+	Context   string       `json:"context,omitempty"`
+	Cluster   string       `json:"cluster"`
+	Action    string       `json:"action,omitempty"`
+	Operation string       `json:"operation,omitempty"`
+	Added     []string     `json:"added,omitempty"`
+	Removed   []string     `json:"removed,omitempty"`
+	Duration  string       `json:"duration,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	SmokeTest *smokeResult `json:"smokeTest,omitempty"`
+	//left with the note command
+	Note string `json:"note,omitempty"`
+	//found in the log lines of the update
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+//check the IP and update the cluster a single time, printing what happened
+func (a *App) once() {
+	a.validateOutput()
+	res := a.checkOnce()
+	if !a.printStructured(res) {
+		printResult(res)
+	}
+
+	if res.Error != "" {
+		os.Exit(1)
+	}
+	for _, c := range res.Clusters {
+		if c.Error != "" {
+			os.Exit(1)
+		}
+	}
+}
+
+func (a *App) checkOnce() runResult {
+	st := a.loadState()
+	ips, err := a.findIPs(st.IPs)
+	if err != nil {
+		return runResult{Error: err.Error()}
+	}
+
+	st.correlationID = newCorrelationID()
+	st.update(ips)
+	st.prune()
+	st.expire()
+	st.refreshRanges()
+	a.saveState(st)
+	a.saveIP(a.primaryIP(st.IPs))
+	res := runResult{IPs: ips}
+
+	a.setCreds(a.CredentialPath)
+	if err := a.resolveZone(); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	clusters, err := a.clusters()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	//the first failure is the one of the status and the heartbeat, every cluster reports its own
+	err = nil
+	for _, u := range a.updateClusters(clusters, st, "once") {
+		c := clusterResult{Cluster: u.cluster.ResourceName(), CorrelationID: u.id, SmokeTest: u.smoke, Note: a.noteOf(u.cluster)}
+		if u.paused {
+			c.Action = "paused"
+		} else if u.disabled {
+			c.Action = "disabled"
+		}
+		if u.change != nil {
+			c.Action = u.change.Action()
+			if u.change.Operation != nil {
+				c.Operation = u.change.Operation.Name
+				c.Added = describeBlocks(u.change.Added)
+				c.Removed = describeBlocks(u.change.Removed)
+				c.Duration = u.elapsed.Round(time.Second).String()
+			}
+		}
+		if u.err != nil {
+			c.Error = u.err.Error()
+			if err == nil {
+				err = u.err
+			}
+		}
+		a.status.recordCluster(u.cluster, u.err)
+		res.Clusters = append(res.Clusters, c)
+	}
+	a.saveState(st)
+	a.status.record(ips, err)
+	a.heartbeat(err)
+	return res
+}
+
+func printResult(res runResult) {
+	var names []string
+	for name := range res.IPs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s : %s\n", name, res.IPs[name])
+	}
+	if res.Error != "" {
+		fmt.Printf("error : %s\n", res.Error)
+	}
+
+	for _, c := range res.Clusters {
+		line := fmt.Sprintf("%s : %s", c.Cluster, c.Action)
+		if c.Operation != "" {
+			duration := c.Duration
+			if d, err := time.ParseDuration(c.Duration); err == nil {
+				duration = humanDuration(d)
+			}
+			line += fmt.Sprintf(" (operation %s, %s)", c.Operation, duration)
+		}
+		if len(c.Added) > 0 {
+			line += fmt.Sprintf(" added %v", c.Added)
+		}
+		if len(c.Removed) > 0 {
+			line += fmt.Sprintf(" removed %v", c.Removed)
+		}
+		if c.SmokeTest != nil {
+			line += ", " + c.SmokeTest.String()
+		}
+		if c.Error != "" {
+			line += fmt.Sprintf(" error : %s", c.Error)
+		}
+		if c.Note != "" {
+			line += fmt.Sprintf(" (note : %s)", c.Note)
+		}
+		fmt.Println(line)
+	}
+}
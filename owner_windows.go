@@ -0,0 +1,13 @@
+package main
+
+import "os"
+
+//permissions aren't checked on Windows, where access is controlled with ACLs
+func openPermissions(path string) (os.FileMode, error) {
+	return 0, nil
+}
+
+//owners aren't checked on Windows, where access to the directory is controlled with ACLs
+func fileOwner(path string) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//directory used before the XDG locations
+func legacyStateDir(home string) string {
+	return filepath.Join(home, ".gke_ip_update")
+}
+
+//pick the state and cache directories, $XDG_STATE_HOME/gke-ip-update and $XDG_CACHE_HOME/gke-ip-update by default
+func (a *App) resolveDirs(home string) {
+	if a.LegacyDir {
+		a.stateDir = legacyStateDir(home)
+		a.cacheDir = a.stateDir
+		return
+	}
+
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		cacheHome = filepath.Join(home, ".cache")
+	}
+
+	a.stateDir = filepath.Join(stateHome, "gke-ip-update")
+	a.cacheDir = filepath.Join(cacheHome, "gke-ip-update")
+}
+
+//keep the state of a simulation or of the kubectl plugin apart from the one of the daemon
+func (a *App) useSubDirs(name string) {
+	a.stateDir = filepath.Join(a.stateDir, name)
+	a.cacheDir = filepath.Join(a.cacheDir, name)
+}
+
+//path of a file in the state directory
+func (a *App) statePath(name string) string {
+	return filepath.Join(a.stateDir, name)
+}
+
+//files of the state directory, kept here instead with --no-state
+type memoryStore struct {
+	sync.Mutex
+	files map[string][]byte
+}
+
+//read a file of the state directory, checking its signature with --sign-state
+func (a *App) readStateFile(name string) ([]byte, error) {
+	if !a.NoState {
+		data, err := ioutil.ReadFile(a.statePath(name))
+		if err != nil || !a.SignState {
+			return data, err
+		}
+		return a.verifyStateFile(name, data)
+	}
+
+	a.memoryFiles.Lock()
+	defer a.memoryFiles.Unlock()
+	data, ok := a.memoryFiles.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return data, nil
+}
+
+//write a file of the state directory, readable by the user only, and its signature with --sign-state
+func (a *App) writeStateFile(name string, data []byte) error {
+	if !a.NoState {
+		if !a.SignState {
+			return ioutil.WriteFile(a.statePath(name), data, 0600)
+		}
+		return a.writeSignedStateFile(name, data)
+	}
+
+	a.memoryFiles.Lock()
+	defer a.memoryFiles.Unlock()
+	a.memoryFiles.files[name] = data
+	return nil
+}
+
+//path of a file in the cache directory
+func (a *App) cachePath(name string) string {
+	return filepath.Join(a.cacheDir, name)
+}
+
+//move the contents of ~/.gke_ip_update to the state directory the first time the XDG location is used.
+//Returns a message describing the migration, or "" if there was nothing to do.
+func (a *App) migrateLegacyDir(home string) (string, error) {
+	legacy := legacyStateDir(home)
+	if legacy == a.stateDir {
+		return "", nil
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		return "", nil
+	}
+	if _, err := os.Stat(a.stateDir); err == nil {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.stateDir), 0755); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(legacy, a.stateDir); err != nil {
+		//different file systems, copy the files instead
+		if err := copyDir(legacy, a.stateDir); err != nil {
+			return "", err
+		}
+		if err := os.RemoveAll(legacy); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("Moved %s to %s \n", legacy, a.stateDir), nil
+}
+
+//copy the regular files of a directory
+func copyDir(from, to string) error {
+	if err := os.MkdirAll(to, 0700); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(from)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(from, f.Name()))
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(to, f.Name()), data, f.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
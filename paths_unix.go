@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "os"
+
+//the home directory the state and cache directories default to
+func homeDir() string {
+	return os.Getenv("HOME")
+}
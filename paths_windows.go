@@ -0,0 +1,11 @@
+package main
+
+import "os"
+
+//the home directory the state and cache directories default to, HOME is rarely set on Windows
+func homeDir() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return home
+	}
+	return os.Getenv("USERPROFILE")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+//make sure other users of the machine can't read the service account key or the state: the state and cache directories
+//and the log file are restricted to the user, the key is the user's to fix. With --check-permissions enforce the app
+//refuses to start instead of warning.
+func (a *App) checkPermissions() {
+	if a.CheckPerms == "off" {
+		return
+	}
+	if a.CheckPerms != "warn" && a.CheckPerms != "enforce" {
+		log.Fatalf("Unknown --check-permissions %q, expected warn, enforce or off", a.CheckPerms)
+	}
+
+	if !a.NoState {
+		a.restrict(a.stateDir, 0700)
+		a.restrict(a.cacheDir, 0700)
+	}
+	if a.LogTo == "file" {
+		a.restrict(a.logFile.Name(), 0600)
+	}
+
+	if a.CredentialPath != "" {
+		perm, err := openPermissions(a.CredentialPath)
+		if err != nil {
+			a.permissionProblem(fmt.Sprintf("unable to check the permissions of the service account key %s : %s", a.CredentialPath, err.Error()))
+		} else if perm != 0 {
+			a.permissionProblem(fmt.Sprintf("the service account key %s can be read by other users (%#o), run chmod 600 %s", a.CredentialPath, perm, a.CredentialPath))
+		}
+	}
+}
+
+//remove the access of the group and others to a file or directory of the app
+func (a *App) restrict(path string, mode os.FileMode) {
+	perm, err := openPermissions(path)
+	if err != nil || perm == 0 {
+		return
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		a.permissionProblem(fmt.Sprintf("%s can be read by other users (%#o) and its permissions can't be restricted : %s", path, perm, err.Error()))
+		return
+	}
+	a.writeLog(fmt.Sprintf("Restricted the permissions of %s to %#o \n", path, mode))
+}
+
+//log a permission problem loudly, or stop with --check-permissions enforce
+func (a *App) permissionProblem(message string) {
+	if a.CheckPerms == "enforce" {
+		log.Fatal(message)
+	}
+	a.writeLog("WARNING : " + message + " \n")
+	log.Println("WARNING :", message)
+}
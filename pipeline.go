@@ -0,0 +1,809 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//longest wait between retries of a failing normal target
+const maxBackoff = 30 * time.Minute
+
+//longest wait between checks while the IPs can't be found
+const maxDetectBackoff = 10 * time.Minute
+
+//the result of checking the IPs
+type observation struct {
+	ips map[string]string
+	err error
+	//why the check failed, probed by the detector so the coordinator doesn't wait for it
+	class failureClass
+}
+
+//entries to apply to a target, st is a snapshot the applier owns
+type job struct {
+	st     *state
+	reason string
+	//the correlation ID shared by the targets the job is applied to
+	id string
+	//the number of the job among the ones submitted to its target
+	seq int
+}
+
+//what came out of a job
+type outcome struct {
+	target  *target
+	id      string
+	seq     int
+	st      *state
+	change  *updater.Change
+	elapsed time.Duration
+	err     error
+	//the cluster found by --rebind-labels when the one of the target doesn't exist anymore, or why none was
+	rebound   *updater.Cluster
+	rebindErr error
+	//why the update failed, probed by the worker so the coordinator doesn't wait for it
+	class failureClass
+}
+
+//a cluster the entries are applied to, by its own worker
+type target struct {
+	app     *App
+	name    string
+	cluster updater.Cluster
+	class   class
+	canary  bool
+	jobs    chan job
+	failing bool
+	//whether the cluster was found missing and alerted about
+	gone bool
+	//whether jobs were dropped while the updates of the cluster were paused
+	paused bool
+	//shortest time between two updates, from --cluster-interval. 0 updates it on every change.
+	interval time.Duration
+	//how long the worker waits before its first job, so targets are reconciled one after the other on startup
+	delay time.Duration
+	//the jobs submitted to the worker and the last one it applied, which differ until it applied the latest state
+	submitted int
+	done      int
+	//cancels the --smoke-test of the last update while it runs
+	smokeCancel context.CancelFunc
+}
+
+//the daemon once started: the detector checks the IPs, the debouncer holds back changes that flap,
+//and the coordinator owns the state, handing snapshots of it to the appliers of every target.
+type pipeline struct {
+	app     *App
+	st      *state
+	targets []*target
+	//the job the other targets get once the canary applied it
+	held *job
+	//since when and how many times in a row the IPs couldn't be found, and whether it was alerted about
+	detectFailing  time.Time
+	detectFailures int
+	detectAlerted  bool
+	//the connectivity lost by the machine, and since when
+	outage      failureClass
+	outageSince time.Time
+	//checks the IPs right away, until done
+	trigger chan<- struct{}
+	done    <-chan struct{}
+	//the --ranges sets fetched off the coordinator, and whether a fetch runs
+	ranges         chan fetchedRanges
+	fetchingRanges bool
+	//whether the availability of the bastion changed, probed off the coordinator, and whether a probe runs
+	iapProbes  chan bool
+	probingIAP bool
+}
+
+//watch the IPs until SIGINT / SIGTERM, a SIGHUP checks right away.
+//pending tells the clusters, by resource name, whose update made at startup failed and has to be retried.
+func (a *App) runPipeline(st *state, clusters []updater.Cluster, pending map[string]bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	trigger := make(chan struct{}, 1)
+	go a.handleSignals(ctx, cancel, trigger)
+
+	p := &pipeline{app: a, st: st, trigger: trigger, done: ctx.Done(), ranges: make(chan fetchedRanges), iapProbes: make(chan bool)}
+	for _, cluster := range clusters {
+		p.targets = append(p.targets, &target{
+			app:      a,
+			name:     cluster.ResourceName(),
+			cluster:  cluster,
+			class:    a.classOf("", cluster),
+			canary:   a.isCanary("", cluster),
+			jobs:     make(chan job, 1),
+			failing:  pending[cluster.ResourceName()],
+			paused:   a.isPaused("", cluster),
+			interval: a.intervalOf("", cluster),
+		})
+	}
+	p.prioritize()
+
+	observations := make(chan observation)
+	debounced := make(chan observation)
+	outcomes := make(chan outcome)
+	retries := make(chan *target)
+
+	if a.WatchNetwork {
+		go a.supervise(ctx, "network watcher", func() {
+			a.watchNetworkChanges(ctx, trigger)
+		})
+	}
+	if a.DHCPLease != "" {
+		go a.supervise(ctx, "lease watcher", func() {
+			a.watchLease(ctx, trigger)
+		})
+	}
+	if a.UbusInterface != "" {
+		go a.supervise(ctx, "ubus listener", func() {
+			a.watchUbus(ctx, trigger)
+		})
+	}
+	if len(a.keyFiles()) > 0 && a.SimulateIPs == "" {
+		go a.supervise(ctx, "key reminder", func() {
+			a.remindKeys(ctx)
+		})
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2 + len(p.targets))
+	//copied before the coordinator runs, a restarted detector can't read the IPs it writes
+	previous := copyIPs(st.IPs)
+	go func() {
+		defer wg.Done()
+		defer close(observations)
+		a.supervise(ctx, "detector", func() {
+			a.detect(ctx, previous, trigger, observations)
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		defer close(debounced)
+		a.supervise(ctx, "debouncer", func() {
+			debounceObservations(ctx, a.Debounce, observations, debounced)
+		})
+	}()
+	for _, t := range p.targets {
+		go func(t *target) {
+			defer wg.Done()
+			a.supervise(ctx, "worker of "+t.name, func() {
+				t.work(ctx, outcomes, retries)
+			})
+		}(t)
+	}
+
+	sdNotify("READY=1")
+	a.supervise(ctx, "coordinator", func() {
+		p.run(ctx, debounced, outcomes, retries)
+	})
+	sdNotify("STOPPING=1")
+	cancel()
+	wg.Wait()
+	a.saveState(st)
+	a.flushDigest()
+	a.writeLog("Stopped \n")
+}
+
+//order the targets by class and --priority, so the most important cluster gets every change first,
+//and stagger their startup by --stagger
+func (p *pipeline) prioritize() {
+	sort.SliceStable(p.targets, func(i, j int) bool {
+		return p.app.clusterRank("", p.targets[i].cluster) < p.app.clusterRank("", p.targets[j].cluster)
+	})
+	for i, t := range p.targets {
+		t.delay = time.Duration(i) * p.app.Stagger
+	}
+}
+
+//stop on SIGINT / SIGTERM and trigger a check on SIGHUP
+func (a *App) handleSignals(ctx context.Context, cancel context.CancelFunc, trigger chan<- struct{}) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigs:
+			if sig == syscall.SIGHUP {
+				select {
+				case trigger <- struct{}{}:
+				default:
+				}
+				continue
+			}
+
+			a.writeLog(fmt.Sprintf("Received %s, shutting down \n", sig))
+			cancel()
+			return
+		}
+	}
+}
+
+//check the IPs every detectInterval or when triggered. After a failed check the wait doubles up to maxDetectBackoff,
+//so an outage of the IP check doesn't hammer it.
+func (a *App) detect(ctx context.Context, previous map[string]string, trigger <-chan struct{}, out chan<- observation) {
+	wait := a.detectInterval()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-trigger:
+		case <-time.After(wait):
+		}
+
+		ips, err := a.findIPs(previous)
+		var class failureClass
+		if err == nil {
+			previous = ips
+			wait = a.detectInterval()
+		} else {
+			class = a.classifyFailure()
+			if wait < maxDetectBackoff {
+				wait *= 2
+				if wait > maxDetectBackoff {
+					wait = maxDetectBackoff
+				}
+			}
+		}
+
+		select {
+		case out <- observation{ips: ips, err: err, class: class}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//pass on observations, holding back new IPs for the window. The latest one is passed on when it ends,
+//unless the IPs went back to the ones passed on before.
+func debounceObservations(ctx context.Context, window time.Duration, in <-chan observation, out chan<- observation) {
+	var last map[string]string
+	var pending *observation
+	var timer <-chan time.Time
+	for {
+		var o observation
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer:
+			o, pending, timer = *pending, nil, nil
+		case obs, ok := <-in:
+			if !ok {
+				return
+			}
+			if window > 0 && obs.err == nil && last != nil && !reflect.DeepEqual(obs.ips, last) {
+				if pending == nil {
+					timer = time.After(window)
+				}
+				pending = &obs
+				continue
+			}
+			o, pending, timer = obs, nil, nil
+		}
+
+		if o.err == nil {
+			last = o.ips
+		}
+		select {
+		case out <- o:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//apply the jobs to the target, asking the coordinator for a retry after a failure.
+//The wait doubles after each failure up to the maximum of the class, except while the cluster is busy.
+//With --cluster-interval, a job coming sooner than the interval after the last one waits for it.
+func (t *target) work(ctx context.Context, outcomes chan<- outcome, retries chan<- *target) {
+	if t.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(t.delay):
+		}
+	}
+
+	backoff := t.checkInterval()
+	//when the last job started, and the one waiting for the interval to end
+	var last time.Time
+	var held *job
+	var release <-chan time.Time
+	var retry <-chan time.Time
+	if t.failing {
+		retry = time.After(backoff)
+	}
+	var rotation <-chan time.Time
+	if t.app.RotationCheck > 0 && t.app.SimulateIPs == "" {
+		rotation = time.After(0)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-retry:
+			retry = nil
+			select {
+			case retries <- t:
+			case <-ctx.Done():
+				return
+			}
+		case <-rotation:
+			if err := t.app.checkRotation(ctx, t.cluster); err != nil && ctx.Err() == nil {
+				t.app.writeLog(fmt.Sprintf("Unable to check the credentials of %s : %s \n", t.name, err.Error()))
+			}
+			rotation = time.After(t.app.RotationCheck)
+		case <-release:
+			release = nil
+			j := *held
+			held = nil
+			last = time.Now()
+			if !t.apply(ctx, j, &backoff, &retry, outcomes) {
+				return
+			}
+		case j := <-t.jobs:
+			if wait := t.interval - time.Since(last); t.interval > 0 && wait > 0 {
+				if held == nil {
+					release = time.After(wait)
+				}
+				held = &j
+				continue
+			}
+			last = time.Now()
+			if !t.apply(ctx, j, &backoff, &retry, outcomes) {
+				return
+			}
+		}
+	}
+}
+
+//apply a job, scheduling the retry after a failure. Reports false once the context is done.
+func (t *target) apply(ctx context.Context, j job, backoff *time.Duration, retry *<-chan time.Time, outcomes chan<- outcome) bool {
+	*retry = nil
+	started := time.Now()
+	jobCtx := updater.WithCorrelationID(ctx, j.id)
+	change, err := t.app.setGKEIP(jobCtx, t.cluster, j.st, j.reason)
+	if err == nil && t.canary {
+		err = t.app.masterReachable(ctx, t.cluster)
+	}
+	if err == nil {
+		t.smokeInBackground(jobCtx, change)
+	}
+	if ctx.Err() != nil {
+		if change != nil && change.Operation != nil {
+			t.app.writeRunLog(j.id, fmt.Sprintf("Stopped waiting for operation %s, it continues in the cluster \n", change.Operation.Name))
+		}
+		return false
+	}
+
+	var rebound *updater.Cluster
+	var rebindErr error
+	if updater.IsNotFound(err) {
+		//a missing cluster isn't coming back soon, the next search is the retry
+		rebound, rebindErr = t.app.rebind(ctx, t.cluster)
+		if rebound == nil {
+			*retry = time.After(goneRetry)
+		}
+	} else if err == nil {
+		*backoff = t.checkInterval()
+	} else {
+		*retry = time.After(*backoff)
+		if !waiting(err) && *backoff < t.class.maxBackoff {
+			*backoff *= 2
+			if *backoff > t.class.maxBackoff {
+				*backoff = t.class.maxBackoff
+			}
+		}
+	}
+
+	var class failureClass
+	if err != nil && !updater.IsNotFound(err) {
+		class = t.app.classifyFailure()
+	}
+
+	select {
+	case outcomes <- outcome{target: t, id: j.id, seq: j.seq, st: j.st, change: change, elapsed: time.Since(started), err: err, rebound: rebound, rebindErr: rebindErr, class: class}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+//how often the target is updated, --cluster-interval or the check interval
+func (t *target) checkInterval() time.Duration {
+	if t.interval > 0 {
+		return t.interval
+	}
+	return t.app.checkInterval()
+}
+
+//check whether an update failed because the cluster is busy, which retrying later fixes
+func waiting(err error) bool {
+	switch err.(type) {
+	case *updater.NotRunningError, *operationTimeoutError:
+		return true
+	}
+	return false
+}
+
+//when an update the cluster wasn't ready for is retried
+func retriedWhen(err *updater.NotRunningError) string {
+	if err.Exclusion != "" {
+		return "once the exclusion ends"
+	}
+	return "once it is RUNNING"
+}
+
+//queue a job, replacing one the worker didn't pick up yet. Jobs get a correlation ID if they have none.
+//Targets whose updates were disabled after too many failures drop them until resumed.
+func (t *target) submit(j job) {
+	if j.st.disabled(t.name) {
+		return
+	}
+	if t.app.isPaused("", t.cluster) {
+		if !t.paused {
+			t.app.writeLog(fmt.Sprintf("Updates of %s are paused, the change (%s) is applied once resumed \n", t.cluster.Name, j.reason))
+		}
+		t.paused = true
+		return
+	}
+	t.paused = false
+	if j.id == "" {
+		j.id = newCorrelationID()
+	}
+	t.submitted++
+	j.seq = t.submitted
+	select {
+	case <-t.jobs:
+	default:
+	}
+	t.jobs <- j
+}
+
+//own the state, turning observations into jobs and recording their outcomes, until the context is done
+func (p *pipeline) run(ctx context.Context, observations <-chan observation, outcomes <-chan outcome, retries <-chan *target) {
+	//the watchdog of systemd is only fed while the coordinator keeps going
+	var watchdog <-chan time.Time
+	if t := watchdogTicker(); t != nil {
+		defer t.Stop()
+		watchdog = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-watchdog:
+			sdNotify("WATCHDOG=1")
+		case o, ok := <-observations:
+			if !ok {
+				return
+			}
+			p.observe(o)
+		case o := <-outcomes:
+			p.applied(o)
+		case d := <-p.app.decisions:
+			p.decide(d)
+		case f := <-p.ranges:
+			p.rangesFetched(f)
+		case changed := <-p.iapProbes:
+			p.iapProbed(changed)
+		case t := <-retries:
+			//a change held back by the canary isn't rolled out by a retry
+			if p.held == nil || t.canary {
+				t.submit(job{st: p.st.snapshot(), reason: "retry"})
+			}
+		}
+	}
+}
+
+//answer a request of the admin API on the temporary entries, rolling an approved one out
+func (p *pipeline) decide(d decision) {
+	if d.name == "" {
+		d.reply <- decisionReply{pending: p.st.pendingEntries()}
+		return
+	}
+
+	message, err := p.st.decide(d.name, d.approved, d.by)
+	if err == nil {
+		p.app.saveState(p.st)
+		if d.approved {
+			p.submit(job{st: p.st.snapshot(), reason: "temporary entry approved"})
+		}
+		p.app.status.setPending(p.pending())
+	}
+	d.reply <- decisionReply{message: message, err: err}
+}
+
+//fetch the --ranges sets when they are due, unless a fetch still runs. The result comes back to the coordinator.
+func (p *pipeline) fetchRanges() {
+	if p.fetchingRanges || !p.st.rangesDue() {
+		return
+	}
+	p.fetchingRanges = true
+	go func() {
+		f := p.app.fetchRanges()
+		select {
+		case p.ranges <- f:
+		case <-p.done:
+		}
+	}()
+}
+
+//store the fetched --ranges sets, handing them to every target when they changed
+func (p *pipeline) rangesFetched(f fetchedRanges) {
+	p.fetchingRanges = false
+	if !p.st.applyRanges(f) {
+		return
+	}
+	p.st.correlationID = newCorrelationID()
+	p.app.saveState(p.st)
+	p.submit(job{st: p.st.snapshot(), reason: "published ranges changed", id: p.st.correlationID})
+	p.app.status.setPending(p.pending())
+}
+
+//check with --prefer-iap whether the bastion can be used, unless a probe still runs.
+//The result comes back to the coordinator.
+func (p *pipeline) probeIAP() {
+	if !p.app.PreferIAP || p.probingIAP {
+		return
+	}
+	p.probingIAP = true
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), iapProbeTimeout)
+		defer cancel()
+		changed := p.app.refreshIAP(ctx)
+		select {
+		case p.iapProbes <- changed:
+		case <-p.done:
+		}
+	}()
+}
+
+//hand the entries to every target again once the bastion became usable or stopped being
+func (p *pipeline) iapProbed(changed bool) {
+	p.probingIAP = false
+	if !changed {
+		return
+	}
+	p.st.correlationID = newCorrelationID()
+	p.submit(job{st: p.st.snapshot(), reason: "bastion availability changed", id: p.st.correlationID})
+	p.app.status.setPending(p.pending())
+}
+
+//update the state from an observation and hand the changes to every target
+func (p *pipeline) observe(o observation) {
+	st := p.st
+	if len(st.Disabled) > 0 {
+		for _, name := range p.app.resumed(st) {
+			for _, t := range p.targets {
+				if t.name == name && t.failing {
+					t.submit(job{st: st.snapshot(), reason: "updates resumed"})
+				}
+			}
+		}
+	}
+
+	if o.err != nil {
+		p.app.status.record(st.IPs, o.err)
+		p.detectionFailed(o.err, o.class)
+		go p.app.heartbeat(o.err)
+		return
+	}
+	p.detectionRecovered()
+
+	for _, t := range p.targets {
+		if t.paused && !p.app.isPaused("", t.cluster) {
+			t.submit(job{st: st.snapshot(), reason: "updates resumed"})
+		}
+	}
+
+	p.fetchRanges()
+	p.probeIAP()
+	admitted, expired := st.admit(), st.expire()
+	st.correlationID = newCorrelationID()
+	reason := ""
+	switch {
+	case st.update(o.ips):
+		reason = "ip changed"
+		p.app.publishIPs(st.IPs)
+	case st.prune():
+		reason = "previous ip expired"
+	case admitted:
+		reason = "temporary entry added"
+	case expired:
+		reason = "temporary entry expired"
+	}
+	if reason != "" {
+		p.app.saveState(st)
+		p.app.saveIP(p.app.primaryIP(st.IPs))
+		p.submit(job{st: st.snapshot(), reason: reason, id: st.correlationID})
+	}
+
+	//the IPs just seen aren't authorized until every target applied them
+	p.app.status.setPending(p.pending())
+	p.app.status.record(st.IPs, p.failure())
+	go p.app.heartbeat(p.failure())
+}
+
+//check whether a target has a job it didn't apply yet, or the canary holds one back from the others
+func (p *pipeline) pending() bool {
+	if p.held != nil {
+		return true
+	}
+	for _, t := range p.targets {
+		if t.done < t.submitted {
+			return true
+		}
+	}
+	return false
+}
+
+//the resource names of the clusters of the targets
+func (p *pipeline) clusterNames() []string {
+	var names []string
+	for _, t := range p.targets {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+//the error of a target whose last update failed, nil when they are all up to date
+func (p *pipeline) failure() error {
+	for _, t := range p.targets {
+		if t.failing {
+			return fmt.Errorf("the update of %s failed", t.name)
+		}
+	}
+	return nil
+}
+
+//count a failed check of the IPs, alerting once it has been failing for --detect-alert-after
+func (p *pipeline) detectionFailed(err error, class failureClass) {
+	if p.detectFailures == 0 {
+		p.detectFailing = time.Now()
+	}
+	p.detectFailures++
+	p.app.writeLog(fmt.Sprintf("Unable to find the IPs (%d failures in a row), the cluster keeps the last ones : %s \n", p.detectFailures, err.Error()))
+
+	if !p.connectivityLost(class) && !p.detectAlerted && p.app.DetectAlertAfter > 0 && time.Since(p.detectFailing) >= p.app.DetectAlertAfter {
+		p.detectAlerted = true
+		message := func(failing string) string {
+			return fmt.Sprintf("The IPs couldn't be found for %s (%d failures), changes aren't followed : %s", failing, p.detectFailures, err.Error())
+		}
+		failing := time.Since(p.detectFailing)
+		p.app.writeLog(message(logDuration(failing)) + " \n")
+		p.app.notify("critical", message(humanDuration(failing)))
+	}
+}
+
+//reset the failed checks once the IPs are found again
+func (p *pipeline) detectionRecovered() {
+	p.connectivityRestored()
+	if p.detectFailures == 0 {
+		return
+	}
+
+	failing := time.Since(p.detectFailing)
+	p.app.writeLog(fmt.Sprintf("The IPs are found again after %d failures in %s \n", p.detectFailures, logDuration(failing)))
+	if p.detectAlerted {
+		p.app.notify("info", fmt.Sprintf("The IPs are found again after %d failures in %s", p.detectFailures, humanDuration(failing)))
+	}
+	p.detectFailures, p.detectAlerted = 0, false
+}
+
+//hand a job to every target, or only to the canary when there is one, the others getting it once the canary applied it
+func (p *pipeline) submit(j job) {
+	if j.id == "" {
+		j.id = newCorrelationID()
+	}
+	var canary *target
+	for _, t := range p.targets {
+		if t.canary {
+			canary = t
+		}
+	}
+	if canary == nil || len(p.targets) == 1 {
+		for _, t := range p.targets {
+			t.submit(j)
+		}
+		return
+	}
+
+	p.held = &j
+	canary.submit(job{st: j.st.snapshot(), reason: j.reason, id: j.id})
+}
+
+//roll the held job out to the other targets once the canary succeeded, alert when it failed
+func (p *pipeline) canaryApplied(o outcome) {
+	if p.held == nil {
+		return
+	}
+	if o.err != nil {
+		if !o.target.failing {
+			message := fmt.Sprintf("Canary %s failed, the change is held back from the other clusters until it succeeds : %s", o.target.name, o.err.Error())
+			p.app.writeRunLog(o.id, message+" \n")
+			p.app.notify("critical", message)
+		}
+		return
+	}
+
+	j := *p.held
+	p.held = nil
+	for _, t := range p.targets {
+		if !t.canary {
+			t.submit(job{st: j.st.snapshot(), reason: j.reason, id: j.id})
+		}
+	}
+}
+
+//record the outcome of a job in the state
+func (p *pipeline) applied(o outcome) {
+	st := p.st
+	if o.err == nil && o.seq > o.target.done {
+		o.target.done = o.seq
+	}
+	if o.st.LastUpdateDuration != 0 {
+		st.LastUpdateDuration = o.st.LastUpdateDuration
+	}
+
+	//an update failing because the machine is offline is only reported by the connectivity notifications
+	outage := o.err != nil && p.connectivityLost(o.class)
+	gone := updater.IsNotFound(o.err)
+	if !outage && !gone && (!o.target.failing || o.err == nil) {
+		p.app.notifyUpdate(o.id, o.target.cluster, o.change, o.elapsed, o.err, o.target.class, nil)
+	}
+	if o.target.canary {
+		p.canaryApplied(o)
+	}
+	o.target.failing = o.err != nil
+	if o.err == nil {
+		p.connectivityRestored()
+	}
+	st.cleaned(o.st, o.err, o.target.name, p.clusterNames())
+	if e, ok := o.err.(*updater.NotRunningError); ok {
+		p.app.writeRunLog(o.id, fmt.Sprintf("%s, the update will be retried %s \n", o.err.Error(), retriedWhen(e)))
+	} else if _, ok := o.err.(*operationTimeoutError); ok {
+		//the update may well succeed, the retry finds out
+		p.app.writeRunLog(o.id, fmt.Sprintf("Update of %s : %s \n", o.target.name, o.err.Error()))
+	} else if gone {
+		//a missing cluster doesn't count towards disabling the updates, it's looked for again instead
+		if p.clusterGone(o) {
+			o.target.submit(job{st: st.snapshot(), reason: "cluster rebound", id: o.id})
+		}
+	} else if o.err != nil {
+		p.app.writeRunLog(o.id, fmt.Sprintf("Unable to update ip in the GKE cluster %s : %s \n", o.target.name, o.err.Error()))
+		if !outage {
+			p.app.countFailure(st, o.target.name, o.err, o.target.class)
+		}
+	} else {
+		st.succeeded(o.target.name)
+	}
+
+	//entries `allow` added while the update ran would be lost by saving the state
+	if st.admit() {
+		p.submit(job{st: st.snapshot(), reason: "temporary entry added"})
+	}
+	p.app.saveState(st)
+	p.app.status.recordCluster(o.target.cluster, o.err)
+	//the status shows a failure while any cluster is failing
+	err := o.err
+	if err == nil {
+		err = p.failure()
+	}
+	p.app.status.setPending(p.pending())
+	p.app.status.record(st.IPs, err)
+}
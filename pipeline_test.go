@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gke-ip-update/checkiptest"
+	"gke-ip-update/updater"
+)
+
+//drive the detector, the debouncer and the coordinator against checkiptest, the test applying the jobs of the target
+func TestPipeline(t *testing.T) {
+	s := checkiptest.NewServer(checkiptest.Response{IP: "203.0.113.1"})
+	defer s.Close()
+	a := newTestApp(t, "--network-name", "home", "--checkip-url", s.URL, "--interval", "1h", "--keep-ips", "1")
+
+	st := a.loadState()
+	cluster := updater.Cluster{Project: "p", Zone: "europe-west1", Name: "prod"}
+	tgt := &target{app: a, name: cluster.ResourceName(), cluster: cluster, jobs: make(chan job, 1)}
+	p := &pipeline{app: a, st: st, targets: []*target{tgt}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trigger := make(chan struct{}, 1)
+	observations := make(chan observation)
+	debounced := make(chan observation)
+	outcomes := make(chan outcome)
+	retries := make(chan *target)
+	go a.detect(ctx, nil, trigger, observations)
+	go debounceObservations(ctx, 0, observations, debounced)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		p.run(ctx, debounced, outcomes, retries)
+	}()
+
+	next := func(t *testing.T) job {
+		t.Helper()
+		select {
+		case j := <-tgt.jobs:
+			return j
+		case <-time.After(5 * time.Second):
+			t.Fatal("no job submitted")
+		}
+		return job{}
+	}
+	apply := func(j job) {
+		j.st.writing(j.st.entries())
+		outcomes <- outcome{target: tgt, id: j.id, seq: j.seq, st: j.st, change: &updater.Change{}}
+	}
+
+	t.Run("ip found", func(t *testing.T) {
+		trigger <- struct{}{}
+		j := next(t)
+		if j.reason != "ip changed" || j.id == "" {
+			t.Errorf("job %q with id %q, want an ip change with a correlation id", j.reason, j.id)
+		}
+		if want := map[string]string{"home": "203.0.113.1"}; !reflect.DeepEqual(j.st.IPs, want) {
+			t.Errorf("job IPs = %v, want %v", j.st.IPs, want)
+		}
+		apply(j)
+	})
+
+	t.Run("unchanged ip not applied again", func(t *testing.T) {
+		trigger <- struct{}{}
+		for s.Requests() < 2 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		select {
+		case j := <-tgt.jobs:
+			t.Errorf("job %q submitted for an unchanged IP", j.reason)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("ip changed", func(t *testing.T) {
+		s.SetResponses(checkiptest.Response{IP: "203.0.113.2"})
+		trigger <- struct{}{}
+		j := next(t)
+		var got []string
+		for _, e := range j.st.entries() {
+			got = append(got, e.DisplayName+"="+e.CidrBlock)
+		}
+		if want := []string{"home=203.0.113.2/32", "home-prev1=203.0.113.1/32"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("entries = %v, want %v", got, want)
+		}
+		apply(j)
+	})
+
+	t.Run("state once stopped", func(t *testing.T) {
+		cancel()
+		<-stopped
+		if !reflect.DeepEqual(st.IPs, map[string]string{"home": "203.0.113.2"}) {
+			t.Errorf("state IPs = %v", st.IPs)
+		}
+		if want := map[string]string{"home": "home", "home-prev1": "home"}; !reflect.DeepEqual(st.Managed, want) {
+			t.Errorf("managed = %v, want %v", st.Managed, want)
+		}
+		if tgt.done != tgt.submitted || p.pending() {
+			t.Errorf("%d jobs applied out of %d, want every job applied", tgt.done, tgt.submitted)
+		}
+		if a.status.Pending {
+			t.Error("status still pending once the target applied the IPs")
+		}
+	})
+}
+
+func TestDebounceObservations(t *testing.T) {
+	a := observation{ips: map[string]string{"home": "203.0.113.1"}}
+	b := observation{ips: map[string]string{"home": "203.0.113.2"}}
+	c := observation{ips: map[string]string{"home": "203.0.113.3"}}
+	failed := observation{err: errors.New("checkip answered 503")}
+
+	tests := []struct {
+		name   string
+		window time.Duration
+		in     []observation
+		want   []observation
+	}{
+		{name: "first observation passed on", window: time.Hour, in: []observation{a}, want: []observation{a}},
+		{name: "same ips passed on", window: time.Hour, in: []observation{a, a}, want: []observation{a, a}},
+		{name: "latest change passed on after the window", window: 50 * time.Millisecond, in: []observation{a, b, c}, want: []observation{a, c}},
+		{name: "flap back ignored", window: 50 * time.Millisecond, in: []observation{a, b, a}, want: []observation{a, a}},
+		{name: "failures passed on", window: 50 * time.Millisecond, in: []observation{a, failed, b}, want: []observation{a, failed, b}},
+		{name: "no window", in: []observation{a, b, a}, want: []observation{a, b, a}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			in := make(chan observation)
+			out := make(chan observation, len(tt.in))
+			go debounceObservations(ctx, tt.window, in, out)
+
+			for _, o := range tt.in {
+				in <- o
+			}
+			var got []observation
+			timeout := time.After(tt.window + 500*time.Millisecond)
+			for len(got) < len(tt.want) {
+				select {
+				case o := <-out:
+					got = append(got, o)
+				case <-timeout:
+					t.Fatalf("got %v before the timeout, want %v", got, tt.want)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIAPProbed(t *testing.T) {
+	tests := []struct {
+		name    string
+		changed bool
+	}{
+		{name: "availability unchanged"},
+		{name: "availability changed", changed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t, "--network-name", "home")
+			cluster := updater.Cluster{Project: "p", Zone: "europe-west1", Name: "prod"}
+			tgt := &target{app: a, name: cluster.ResourceName(), cluster: cluster, jobs: make(chan job, 1)}
+			p := &pipeline{app: a, st: &state{IPs: map[string]string{"home": "203.0.113.1"}, app: a}, targets: []*target{tgt}, probingIAP: true}
+
+			p.iapProbed(tt.changed)
+			if p.probingIAP {
+				t.Error("probe still running")
+			}
+			select {
+			case j := <-tgt.jobs:
+				if !tt.changed {
+					t.Errorf("job %q submitted for an unchanged availability", j.reason)
+				} else if j.reason != "bastion availability changed" || j.id == "" {
+					t.Errorf("job %q with id %q, want the bastion availability with a correlation id", j.reason, j.id)
+				}
+			default:
+				if tt.changed {
+					t.Error("no job submitted")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//whether the binary was installed as the kubectl plugin, run as `kubectl gke-ip`
+func isPlugin() bool {
+	return strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe") == "kubectl-gke_ip"
+}
+
+//commands of the kubectl plugin, for the cluster of the current kubeconfig context unless --cluster is given
+func (a *App) plugin(command string) {
+	if a.AllGKEContexts {
+		if command != "ensure" {
+			log.Fatal("--all-gke-contexts only works with ensure")
+		}
+		a.ensureAllContexts()
+		return
+	}
+
+	if a.ClusterID == "" {
+		c, err := kubeContextCluster(a.KubeContext)
+		if err != nil {
+			log.Fatal(err)
+		}
+		a.ProjectID, a.ClusterZone, a.ClusterID = c.Project, c.Zone, c.Name
+	}
+	if a.NetworkDisplayName == "" {
+		a.NetworkDisplayName = defaultNetworkName()
+	}
+
+	switch command {
+	case "ensure":
+		a.validateArgs()
+		a.Once = true
+		a.once()
+	case "status":
+		a.validateCluster()
+		a.pluginStatus()
+	default:
+		log.Fatalf("Usage: kubectl gke-ip [ensure|status] [flags]")
+	}
+}
+
+//the cluster of a kubeconfig context, the current one when name is empty
+func kubeContextCluster(name string) (updater.Cluster, error) {
+	args := []string{"config", "view", "--minify", "-o", "json"}
+	if name != "" {
+		args = append(args, "--context", name)
+	}
+	out, err := exec.Command("kubectl", args...).Output()
+	if err != nil {
+		return updater.Cluster{}, fmt.Errorf("unable to read the kubeconfig : %s", err.Error())
+	}
+
+	var config struct {
+		CurrentContext string `json:"current-context"`
+	}
+	if err := json.Unmarshal(out, &config); err != nil {
+		return updater.Cluster{}, err
+	}
+	if name == "" {
+		name = config.CurrentContext
+	}
+
+	return updater.ParseContext(name)
+}
+
+//names of the kubeconfig contexts created by gcloud for GKE clusters
+func gkeContexts() ([]string, error) {
+	out, err := exec.Command("kubectl", "config", "view", "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the kubeconfig : %s", err.Error())
+	}
+
+	var config struct {
+		Contexts []struct {
+			Name string `json:"name"`
+		} `json:"contexts"`
+	}
+	if err := json.Unmarshal(out, &config); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, c := range config.Contexts {
+		if _, err := updater.ParseContext(c.Name); err == nil {
+			names = append(names, c.Name)
+		}
+	}
+	return names, nil
+}
+
+//name of the current kubeconfig context, "" when there is none
+func currentContext() string {
+	out, err := exec.Command("kubectl", "config", "current-context").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+//order in which the cluster of a context is reconciled: by class, the ones of --priority first, then the current context
+func (a *App) contextRank(name, current string) int {
+	c, _ := updater.ParseContext(name)
+	rank := a.clusterRank(name, c)
+	if a.priorityRank(name, c) == len(a.Priorities) && name != current {
+		rank++
+	}
+	return rank
+}
+
+//authorize the current IP in the cluster of every GKE context and print a summary of them
+func (a *App) ensureAllContexts() {
+	contexts, err := gkeContexts()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(contexts) == 0 {
+		log.Fatal("No GKE context in the kubeconfig")
+	}
+	if a.NetworkDisplayName == "" {
+		a.NetworkDisplayName = defaultNetworkName()
+	}
+
+	//the cluster kubectl points at is the one needed right away
+	current := currentContext()
+	sort.SliceStable(contexts, func(i, j int) bool {
+		return a.contextRank(contexts[i], current) < a.contextRank(contexts[j], current)
+	})
+	//the canary goes before everything else
+	for i, name := range contexts {
+		if c, _ := updater.ParseContext(name); a.isCanary(name, c) {
+			contexts = append([]string{name}, append(contexts[:i:i], contexts[i+1:]...)...)
+			break
+		}
+	}
+
+	var res runResult
+	failed := false
+	canaryFailed := ""
+	for i, name := range contexts {
+		c, _ := updater.ParseContext(name)
+		if !a.inGroup(name, c) {
+			continue
+		}
+		if a.isPaused(name, c) {
+			res.Clusters = append(res.Clusters, clusterResult{Context: name, Cluster: c.ResourceName(), Action: "paused"})
+			continue
+		}
+		if canaryFailed != "" {
+			res.Clusters = append(res.Clusters, clusterResult{Context: name, Cluster: c.ResourceName(), Action: "skipped", Error: canaryFailed})
+			continue
+		}
+		if i > 0 && a.Stagger > 0 {
+			time.Sleep(a.Stagger)
+		}
+		a.ProjectID, a.ClusterZone, a.ClusterID = c.Project, c.Zone, c.Name
+		a.validateArgs()
+
+		r := a.checkOnce()
+		if r.IPs != nil {
+			res.IPs = r.IPs
+		}
+		if r.Error != "" {
+			r.Clusters = []clusterResult{{Cluster: c.ResourceName(), Error: r.Error}}
+		}
+		for _, cr := range r.Clusters {
+			cr.Context = name
+			if a.isCanary(name, c) && cr.Error == "" {
+				if err := a.masterReachable(context.Background(), c); err != nil {
+					cr.Error = err.Error()
+				}
+			}
+			if a.isCanary(name, c) && cr.Error != "" {
+				canaryFailed = "skipped, the canary " + name + " failed"
+				message := fmt.Sprintf("Canary %s failed, the other clusters were left alone : %s", name, cr.Error)
+				a.writeLog(message + " \n")
+				a.notify("critical", message)
+			}
+			//best-effort clusters don't fail the command
+			failed = failed || cr.Error != "" && (a.classOf(name, c).failureLevel != "" || a.isCanary(name, c))
+			res.Clusters = append(res.Clusters, cr)
+		}
+	}
+
+	if !a.printStructured(res) {
+		t := newTable("CONTEXT", "ACTION", "OPERATION", "ERROR")
+		for _, c := range res.Clusters {
+			t.add(c, c.Context, c.Action, c.Operation, c.Error)
+		}
+		a.printTable(t, "No context")
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+//entry name used by the plugin when --network-name isn't given
+func defaultNetworkName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "kubectl-gke-ip"
+	}
+	return strings.Split(host, ".")[0]
+}
+
+//print whether the current IP is authorized in the cluster
+func (a *App) pluginStatus() {
+	st := a.loadState()
+	ips, err := a.findIPs(st.IPs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	a.setCreds(a.CredentialPath)
+	if err := a.resolveZone(); err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+	cluster := updater.Cluster{Project: a.ProjectID, Zone: a.ClusterZone, Name: a.ClusterID}
+	containerService, err := a.newContainerService(ctx, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+	blocks, err := updater.GetCidrBlocks(ctx, containerService, cluster)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Cluster : projects/%s/locations/%s/clusters/%s\n", a.ProjectID, a.ClusterZone, a.ClusterID)
+	for name, ip := range ips {
+		authorized := ""
+		if b := coveringBlock(ip, blocks); b != nil {
+			authorized = b.DisplayName
+		}
+
+		if authorized != "" {
+			entry, meta := parseDisplayName(authorized)
+			if m := a.describeMeta(meta); m != "" {
+				entry += " (" + m + ")"
+			}
+			fmt.Printf("%s : %s is authorized as %s\n", name, ip, entry)
+		} else {
+			fmt.Printf("%s : %s is not authorized, run kubectl gke-ip ensure\n", name, ip)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+//print a symbol telling whether the IP was authorized at the last check of the daemon, --once or check, for shell prompts.
+//IPs the daemon still has to apply aren't authorized yet.
+//Only reads the status they leave in the cache directory, so it returns right away. Exits with 0 when authorized,
+//1 when not and 2 when the status is missing or older than --prompt-stale.
+func (a *App) prompt() {
+	symbols := strings.SplitN(a.PromptSymbols, ",", 3)
+	for len(symbols) < 3 {
+		symbols = append(symbols, "")
+	}
+
+	var s appStatus
+	data, err := ioutil.ReadFile(a.cachePath("status.json"))
+	if err == nil {
+		err = json.Unmarshal(data, &s)
+	}
+	switch {
+	case err != nil || len(s.IPs) == 0 || time.Since(s.LastCheck) > a.PromptStale:
+		fmt.Println(symbols[2])
+		os.Exit(2)
+	case s.LastError != "" || s.Pending:
+		fmt.Println(symbols[1])
+		os.Exit(1)
+	default:
+		fmt.Println(symbols[0])
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//networks a master accepts at most, the ones of the published sets have to fit along with every other entry.
+//Clusters with only a private endpoint take more, but the entries are the same for every cluster.
+const maxClusterNetworks = updater.MaxAuthorizedNetworks
+
+//sources publishing far more networks than a cluster takes, refused right away instead of failing every refresh
+var oversizedRanges = map[string]string{
+	"github:actions": "the hosted runners of GitHub Actions use thousands of ranges, use larger runners with static IPs or self-hosted runners behind a known egress",
+}
+
+//the ranges Google Cloud publishes for its regions
+const googleCloudRanges = "https://www.gstatic.com/ipranges/cloud.json"
+
+//a list of ranges in the format Google publishes them, the scope being the region
+type googleRanges struct {
+	Prefixes []struct {
+		IPv4Prefix string `json:"ipv4Prefix"`
+		Scope      string `json:"scope"`
+	} `json:"prefixes"`
+}
+
+//a set of networks published by a CI provider, each authorized under its own entry <name>-<n>
+type rangeSet struct {
+	name   string
+	source string
+}
+
+//--ranges flags, given as name=source
+type rangeFlags []rangeSet
+
+func (r *rangeFlags) String() string {
+	var specs []string
+	for _, s := range *r {
+		specs = append(specs, s.name+"="+s.source)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (r *rangeFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected name=source, got %q", value)
+	}
+
+	source := parts[1]
+	if !strings.HasPrefix(source, "github:") && !strings.HasPrefix(source, "gcp:") && !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return fmt.Errorf("unknown source %q for ranges %s, expected github:<key>, gcp:<region> or an URL", source, parts[0])
+	}
+	if reason, ok := oversizedRanges[source]; ok {
+		return fmt.Errorf("%s never fits in a cluster : %s", source, reason)
+	}
+
+	*r = append(*r, rangeSet{name: parts[0], source: source})
+	return nil
+}
+
+//fetch the IPv4 networks of the set, sorted so the entries keep their names while the set doesn't change
+func (a *App) fetch(r rangeSet) ([]string, error) {
+	url := r.source
+	switch {
+	case strings.HasPrefix(url, "github:"):
+		url = "https://api.github.com/meta"
+	case strings.HasPrefix(url, "gcp:"):
+		url = googleCloudRanges
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" && strings.HasPrefix(r.source, "github:") {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := a.httpClient(outbound).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching the ranges of %s failed with status %s", r.name, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	//the GitHub meta API lists the ranges of every service, Google the ones of every region,
+	//other providers a JSON array or one network per line
+	var published []string
+	var google googleRanges
+	if strings.HasPrefix(r.source, "github:") {
+		var meta map[string]json.RawMessage
+		if err := json.Unmarshal(body, &meta); err != nil {
+			return nil, err
+		}
+		key := strings.TrimPrefix(r.source, "github:")
+		if _, ok := meta[key]; !ok {
+			return nil, fmt.Errorf("the GitHub meta API has no %q ranges", key)
+		}
+		if err := json.Unmarshal(meta[key], &published); err != nil {
+			return nil, err
+		}
+	} else if json.Unmarshal(body, &google) == nil && len(google.Prefixes) > 0 {
+		scope := strings.TrimPrefix(r.source, "gcp:")
+		for _, p := range google.Prefixes {
+			if p.IPv4Prefix != "" && (!strings.HasPrefix(r.source, "gcp:") || p.Scope == scope) {
+				published = append(published, p.IPv4Prefix)
+			}
+		}
+		if len(published) == 0 {
+			return nil, fmt.Errorf("no IPv4 range published for %s", r.source)
+		}
+	} else if json.Unmarshal(body, &published) != nil {
+		for _, line := range strings.Split(string(body), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				published = append(published, line)
+			}
+		}
+	}
+
+	var networks []string
+	for _, p := range published {
+		if !strings.Contains(p, "/") {
+			p += "/32"
+		}
+		ip, network, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q in the ranges of %s", p, r.name)
+		}
+		//masters only take IPv4 networks
+		if ip.To4() != nil {
+			networks = append(networks, network.String())
+		}
+	}
+	sort.Strings(networks)
+	return networks, nil
+}
+
+//the networks of every --ranges set, or why a set couldn't be fetched
+type fetchedRanges struct {
+	networks map[string][]string
+	errs     map[string]error
+}
+
+//fetch the --ranges sets every --ranges-interval, keeping the networks of a set that can't be fetched or no longer
+//fits in the cluster. Sets no longer configured are emptied, so the update removes their entries.
+//Reports whether any set changed.
+func (st *state) refreshRanges() bool {
+	if !st.rangesDue() {
+		return false
+	}
+	return st.applyRanges(st.app.fetchRanges())
+}
+
+//check whether the sets have to be fetched, once every --ranges-interval or right away when --ranges changed
+func (st *state) rangesDue() bool {
+	return time.Since(st.RangesChecked) >= st.app.RangesInterval || st.rangesConfigured()
+}
+
+//fetch every --ranges set. It doesn't touch the state, so the daemon fetches them off the coordinator.
+func (a *App) fetchRanges() fetchedRanges {
+	f := fetchedRanges{networks: map[string][]string{}, errs: map[string]error{}}
+	for _, r := range a.Ranges {
+		networks, err := a.fetch(r)
+		if err != nil {
+			f.errs[r.name] = err
+			continue
+		}
+		f.networks[r.name] = networks
+	}
+	return f
+}
+
+//store the fetched sets, reporting whether any changed
+func (st *state) applyRanges(f fetchedRanges) bool {
+	st.RangesChecked = time.Now()
+
+	changed := false
+	configured := map[string]bool{}
+	for _, r := range st.app.Ranges {
+		configured[r.name] = true
+		networks, err := f.networks[r.name], f.errs[r.name]
+		//the other sets, the entries and the static networks take their share
+		others := len(st.entries()) + len(st.app.StaticCidrs) - len(st.Ranges[r.name])
+		if err == nil && others+len(networks) > maxClusterNetworks {
+			err = fmt.Errorf("%s publishes %d networks, the cluster takes %d along with the %d other networks", r.source, len(networks), maxClusterNetworks-others, others)
+		}
+		if err != nil {
+			if _, ok := st.Ranges[r.name]; !ok {
+				st.ranges(r.name, nil)
+			}
+			message := fmt.Sprintf("Unable to refresh the ranges of %s, keeping the current ones : %s", r.name, err.Error())
+			st.app.writeLog(message + " \n")
+			st.app.notify("warning", message)
+			continue
+		}
+
+		if !reflect.DeepEqual(networks, st.Ranges[r.name]) {
+			st.app.writeLog(fmt.Sprintf("Ranges of %s changed : added %v, removed %v \n", r.name, subtract(networks, st.Ranges[r.name]), subtract(st.Ranges[r.name], networks)))
+			st.ranges(r.name, networks)
+			changed = true
+		}
+	}
+
+	for name, networks := range st.Ranges {
+		if !configured[name] && len(networks) > 0 {
+			st.app.writeLog(fmt.Sprintf("Ranges of %s are no longer configured, removing them \n", name))
+			st.Ranges[name] = nil
+			changed = true
+		}
+	}
+	return changed
+}
+
+//check whether --ranges changed since the sets were last fetched
+func (st *state) rangesConfigured() bool {
+	configured := map[string]bool{}
+	for _, r := range st.app.Ranges {
+		if _, ok := st.Ranges[r.name]; !ok {
+			return true
+		}
+		configured[r.name] = true
+	}
+	for name, networks := range st.Ranges {
+		if !configured[name] && len(networks) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *state) ranges(name string, networks []string) {
+	if st.Ranges == nil {
+		st.Ranges = map[string][]string{}
+	}
+	st.Ranges[name] = networks
+}
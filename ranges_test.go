@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		networks []string
+		err      string
+	}{
+		{
+			name:     "one network per line",
+			body:     "# runners\n198.51.100.0/24\n\n203.0.113.7\n",
+			networks: []string{"198.51.100.0/24", "203.0.113.7/32"},
+		},
+		{
+			name:     "json array, IPv6 left out",
+			body:     `["203.0.113.0/25", "2001:db8::/32", "198.51.100.9/24"]`,
+			networks: []string{"198.51.100.0/24", "203.0.113.0/25"},
+		},
+		{
+			name:     "google format",
+			body:     `{"prefixes": [{"ipv4Prefix": "203.0.113.0/24", "scope": "europe-west1"}, {"ipv6Prefix": "2001:db8::/32", "scope": "europe-west1"}]}`,
+			networks: []string{"203.0.113.0/24"},
+		},
+		{
+			name: "invalid network",
+			body: "203.0.113.0/24\nnot-a-network\n",
+			err:  `invalid network "not-a-network/32" in the ranges of ci`,
+		},
+		{
+			name:   "failing source",
+			status: http.StatusServiceUnavailable,
+			err:    "fetching the ranges of ci failed with status 503",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			networks, err := newTestApp(t).fetch(rangeSet{name: "ci", source: srv.URL})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(networks, tt.networks) {
+				t.Errorf("got %v, want %v", networks, tt.networks)
+			}
+		})
+	}
+}
+
+func TestApplyRanges(t *testing.T) {
+	tooMany := make([]string, maxClusterNetworks)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("10.0.%d.%d/32", i/256, i%256)
+	}
+
+	tests := []struct {
+		name    string
+		stored  map[string][]string
+		fetched fetchedRanges
+		changed bool
+		ranges  map[string][]string
+	}{
+		{
+			name:    "unchanged",
+			stored:  map[string][]string{"ci": {"203.0.113.0/24"}},
+			fetched: fetchedRanges{networks: map[string][]string{"ci": {"203.0.113.0/24"}}},
+			ranges:  map[string][]string{"ci": {"203.0.113.0/24"}},
+		},
+		{
+			name:    "changed",
+			stored:  map[string][]string{"ci": {"203.0.113.0/24"}},
+			fetched: fetchedRanges{networks: map[string][]string{"ci": {"198.51.100.0/24"}}},
+			changed: true,
+			ranges:  map[string][]string{"ci": {"198.51.100.0/24"}},
+		},
+		{
+			name:    "failed fetch keeps the networks",
+			stored:  map[string][]string{"ci": {"203.0.113.0/24"}},
+			fetched: fetchedRanges{errs: map[string]error{"ci": errors.New("unreachable")}},
+			ranges:  map[string][]string{"ci": {"203.0.113.0/24"}},
+		},
+		{
+			name:    "first fetch failing records the set",
+			fetched: fetchedRanges{errs: map[string]error{"ci": errors.New("unreachable")}},
+			ranges:  map[string][]string{"ci": nil},
+		},
+		{
+			name:    "set too large for the cluster refused",
+			stored:  map[string][]string{"ci": {"203.0.113.0/24"}},
+			fetched: fetchedRanges{networks: map[string][]string{"ci": tooMany}},
+			ranges:  map[string][]string{"ci": {"203.0.113.0/24"}},
+		},
+		{
+			name:    "set no longer configured emptied",
+			stored:  map[string][]string{"ci": {"203.0.113.0/24"}, "old": {"198.51.100.0/24"}},
+			fetched: fetchedRanges{networks: map[string][]string{"ci": {"203.0.113.0/24"}}},
+			changed: true,
+			ranges:  map[string][]string{"ci": {"203.0.113.0/24"}, "old": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &state{IPs: map[string]string{"home": "192.0.2.1"}, Ranges: tt.stored, app: newTestApp(t, "--ranges", "ci=https://ranges.example.com")}
+			if changed := st.applyRanges(tt.fetched); changed != tt.changed {
+				t.Errorf("got changed %v, want %v", changed, tt.changed)
+			}
+			if !reflect.DeepEqual(st.Ranges, tt.ranges) {
+				t.Errorf("got ranges %v, want %v", st.Ranges, tt.ranges)
+			}
+			if st.rangesDue() {
+				t.Error("ranges due right after being applied")
+			}
+		})
+	}
+}
+
+func TestRangesDue(t *testing.T) {
+	tests := []struct {
+		name    string
+		checked time.Duration
+		stored  map[string][]string
+		due     bool
+	}{
+		{name: "checked recently", checked: time.Minute, stored: map[string][]string{"ci": nil}},
+		{name: "interval elapsed", checked: 2 * time.Hour, stored: map[string][]string{"ci": nil}, due: true},
+		{name: "set added", checked: time.Minute, due: true},
+		{name: "set removed", checked: time.Minute, stored: map[string][]string{"ci": nil, "old": {"198.51.100.0/24"}}, due: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &state{Ranges: tt.stored, RangesChecked: time.Now().Add(-tt.checked), app: newTestApp(t, "--ranges", "ci=https://ranges.example.com")}
+			if due := st.rangesDue(); due != tt.due {
+				t.Errorf("got due %v, want %v", due, tt.due)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//how long to wait before looking again for a cluster that disappeared
+const goneRetry = time.Hour
+
+//--rebind-labels flags, the resource labels identifying the cluster when it's deleted and recreated or renamed
+type labelFlags map[string]string
+
+func (l labelFlags) String() string {
+	var labels []string
+	for k, v := range l {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ",")
+}
+
+func (l labelFlags) Set(value string) error {
+	for _, label := range strings.Split(value, ",") {
+		i := strings.Index(label, "=")
+		if i <= 0 {
+			return fmt.Errorf("expected key=value, got %q", label)
+		}
+		l[strings.TrimSpace(label[:i])] = strings.TrimSpace(label[i+1:])
+	}
+	return nil
+}
+
+//look for the cluster carrying --rebind-labels in the project of a cluster that disappeared.
+//Returns nil when there are no labels to look for, or no single cluster carries them.
+func (a *App) rebind(ctx context.Context, gone updater.Cluster) (*updater.Cluster, error) {
+	if len(a.RebindLabels) == 0 {
+		return nil, nil
+	}
+
+	containerService, err := a.newContainerService(ctx, gone)
+	if err != nil {
+		return nil, err
+	}
+	found, err := updater.FindClustersByLabels(ctx, containerService, gone.Project, a.RebindLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no cluster of project %s has the labels %s", gone.Project, a.RebindLabels)
+	case 1:
+		return &found[0], nil
+	default:
+		var names []string
+		for _, c := range found {
+			names = append(names, c.Zone+"/"+c.Name)
+		}
+		return nil, fmt.Errorf("%d clusters of project %s have the labels %s, not picking one : %s", len(found), gone.Project, a.RebindLabels, strings.Join(names, ", "))
+	}
+}
+
+//alert once about a target whose cluster doesn't exist anymore, moving it to the cluster found by its labels if there is one.
+//Reports whether the target was rebound.
+func (p *pipeline) clusterGone(o outcome) bool {
+	t := o.target
+	if o.rebound != nil {
+		message := fmt.Sprintf("Cluster %s no longer exists, updating %s/%s found by its labels %s instead. Change --cluster to keep it after a restart",
+			t.cluster.Name, o.rebound.Zone, o.rebound.Name, p.app.RebindLabels)
+		p.app.writeRunLog(o.id, message+" \n")
+		p.app.notify("warning", message)
+
+		//the commands working on one cluster follow the first one
+		if t.cluster == (updater.Cluster{Project: p.app.ProjectID, Zone: p.app.ClusterZone, Name: p.app.ClusterID}) {
+			p.app.ClusterZone, p.app.ClusterID = o.rebound.Zone, o.rebound.Name
+		}
+		t.cluster = *o.rebound
+		t.name = t.cluster.ResourceName()
+		t.gone = false
+		return true
+	}
+
+	if t.gone {
+		p.app.writeRunLog(o.id, fmt.Sprintf("Cluster %s still doesn't exist, looking again in %s \n", t.name, goneRetry))
+		return false
+	}
+	t.gone = true
+	message := fmt.Sprintf("Cluster %s no longer exists, it was deleted or renamed. Its networks aren't updated, it's looked for again every %s", t.name, goneRetry)
+	if o.rebindErr != nil {
+		message += " : " + o.rebindErr.Error()
+	} else if len(p.app.RebindLabels) == 0 {
+		message += ", give --rebind-labels to find the cluster replacing it"
+	}
+	p.app.writeRunLog(o.id, message+" \n")
+	p.app.notify("critical", message)
+	return false
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+)
+
+//the endpoint and CA of a cluster when they were last checked, to notice a credential rotation
+type clusterCredentials struct {
+	Endpoint string    `json:"endpoint"`
+	CA       string    `json:"ca"`
+	Checked  time.Time `json:"checked"`
+}
+
+//compare the endpoint and CA of the cluster with the ones seen last time, alerting when they changed and refreshing
+//the kubeconfig with --refresh-kubeconfig. A credential rotation changes both, kubectl fails until it gets the new ones.
+func (a *App) checkRotation(ctx context.Context, cluster updater.Cluster) error {
+	containerService, err := a.newContainerService(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	c, err := updater.GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		return err
+	}
+	now := clusterCredentials{Endpoint: c.Endpoint, Checked: time.Now()}
+	if c.MasterAuth != nil && c.MasterAuth.ClusterCaCertificate != "" {
+		sum := sha256.Sum256([]byte(c.MasterAuth.ClusterCaCertificate))
+		now.CA = hex.EncodeToString(sum[:8])
+	}
+
+	//the workers of every cluster share the file
+	a.credentialsMu.Lock()
+	defer a.credentialsMu.Unlock()
+	seen := map[string]clusterCredentials{}
+	data, err := a.readStateFile("credentials.json")
+	if err == nil {
+		err = json.Unmarshal(data, &seen)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	name := cluster.ResourceName()
+	if last, ok := seen[name]; ok {
+		var changes []string
+		if last.Endpoint != now.Endpoint {
+			changes = append(changes, fmt.Sprintf("endpoint %s -> %s", last.Endpoint, now.Endpoint))
+		}
+		if last.CA != now.CA {
+			changes = append(changes, fmt.Sprintf("CA %s -> %s", last.CA, now.CA))
+		}
+		if len(changes) > 0 {
+			message := fmt.Sprintf("Credentials of %s changed (%s), kubeconfigs need the new ones", cluster.Name, strings.Join(changes, ", "))
+			if a.RefreshKubeconfig {
+				if err := refreshKubeconfig(ctx, cluster); err != nil {
+					message += ", refreshing the local one failed : " + err.Error()
+				} else {
+					message += ", the local one was refreshed"
+				}
+			}
+			a.writeLog(message + " \n")
+			a.notify("warning", message)
+		}
+	}
+
+	seen[name] = now
+	data, err = json.MarshalIndent(seen, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.writeStateFile("credentials.json", data)
+}
+
+//fetch the new endpoint and CA of the cluster into the kubeconfig, the way gcloud wrote them
+func refreshKubeconfig(ctx context.Context, cluster updater.Cluster) error {
+	out, err := exec.CommandContext(ctx, "gcloud", "container", "clusters", "get-credentials", cluster.Name,
+		"--location", cluster.Zone, "--project", cluster.Project).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s : %s", err.Error(), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
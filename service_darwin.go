@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//label of the LaunchAgent
+const agentLabel = "io.github.niraj-oss.gke-ip-update"
+
+//keeps the app running while the network is up and restarts it when it exits
+var agentPlist = template.Must(template.New("plist").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>{{xml .Label}}</string>
+  <key>ProgramArguments</key>
+  <array>
+{{- range .Args}}
+    <string>{{xml .}}</string>
+{{- end}}
+  </array>
+  <key>RunAtLoad</key>
+  <true/>
+  <key>KeepAlive</key>
+  <dict>
+    <key>NetworkState</key>
+    <true/>
+  </dict>
+  <key>ThrottleInterval</key>
+  <integer>30</integer>
+  <key>StandardErrorPath</key>
+  <string>{{xml .Stderr}}</string>
+</dict>
+</plist>
+`))
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+//where the plist of the LaunchAgent lives
+func agentPath() string {
+	return filepath.Join(homeDir(), "Library", "LaunchAgents", agentLabel+".plist")
+}
+
+//write a LaunchAgent running the app with the given flags and load it
+func (a *App) installService(args []string) {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var plist bytes.Buffer
+	err = agentPlist.Execute(&plist, struct {
+		Label  string
+		Args   []string
+		Stderr string
+	}{agentLabel, append([]string{exe}, args...), a.statePath("launchd.log")})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	path := agentPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		//reload an agent installed before with other flags
+		launchctl("unload", path)
+	}
+	if err := ioutil.WriteFile(path, plist.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err := launchctl("load", "-w", path); err != nil {
+		log.Fatal(err)
+	}
+
+	a.writeLog(fmt.Sprintf("Installed LaunchAgent %s \n", path))
+	fmt.Printf("LaunchAgent %s installed and started\n", agentLabel)
+}
+
+//stop the LaunchAgent and remove its plist
+func (a *App) uninstallService() {
+	path := agentPath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Println("LaunchAgent is not installed")
+		return
+	}
+	if err := launchctl("unload", "-w", path); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		log.Fatal(err)
+	}
+
+	a.writeLog(fmt.Sprintf("Removed LaunchAgent %s \n", path))
+	fmt.Printf("LaunchAgent %s removed\n", agentLabel)
+}
+
+func launchctl(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s : %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return nil
+}
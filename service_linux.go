@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//name of the systemd user unit
+const unitName = "gke-ip-update.service"
+
+//restarts the app when it exits with an error, once the network is up. The daemon tells systemd when it is ready
+//and is restarted when its coordinator hangs
+var unitFile = template.Must(template.New("unit").Parse(`[Unit]
+Description=Keeps the public IP authorized in the master authorized networks of {{.Cluster}}
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+{{if .Notify}}Type=notify
+NotifyAccess=main
+TimeoutStartSec=15min
+WatchdogSec=5min
+{{end}}ExecStart={{.Command}}
+Restart=on-failure
+RestartSec=30
+
+[Install]
+WantedBy=default.target
+`))
+
+//where the unit lives, $XDG_CONFIG_HOME/systemd/user
+func unitPath() string {
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		config = filepath.Join(homeDir(), ".config")
+	}
+	return filepath.Join(config, "systemd", "user", unitName)
+}
+
+//write a systemd user unit running the app with the given flags, enable and start it
+func (a *App) installService(args []string) {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var command []string
+	for _, arg := range append([]string{exe}, args...) {
+		command = append(command, unitQuote(arg))
+	}
+	var unit strings.Builder
+	if err := unitFile.Execute(&unit, struct {
+		Cluster, Command string
+		Notify           bool
+	}{a.ClusterID, strings.Join(command, " "), !a.Once}); err != nil {
+		log.Fatal(err)
+	}
+
+	path := unitPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(unit.String()), 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		log.Fatal(err)
+	}
+	if err := systemctl("enable", unitName); err != nil {
+		log.Fatal(err)
+	}
+	//restart a unit installed before with other flags
+	if err := systemctl("restart", unitName); err != nil {
+		log.Fatal(err)
+	}
+
+	a.writeLog(fmt.Sprintf("Installed systemd user unit %s \n", path))
+	fmt.Printf("systemd user unit %s installed and started, run `loginctl enable-linger` to keep it running after logout\n", unitName)
+}
+
+//stop and disable the unit, then remove it
+func (a *App) uninstallService() {
+	path := unitPath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Println("systemd user unit is not installed")
+		return
+	}
+	if err := systemctl("disable", "--now", unitName); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		log.Fatal(err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		log.Fatal(err)
+	}
+
+	a.writeLog(fmt.Sprintf("Removed systemd user unit %s \n", path))
+	fmt.Printf("systemd user unit %s removed\n", unitName)
+}
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s : %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+//quote an argument of ExecStart, where systemd expands % specifiers and $ variables
+func unitQuote(arg string) string {
+	arg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t'\\\"") {
+		return arg
+	}
+	return `"` + arg + `"`
+}
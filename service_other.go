@@ -0,0 +1,18 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package main
+
+import (
+	"log"
+	"runtime"
+)
+
+//no service manager is supported, the app can still be started by hand or from cron with --once
+func (a *App) installService(args []string) {
+	log.Fatalf("install-service isn't available on %s", runtime.GOOS)
+}
+
+func (a *App) uninstallService() {
+	log.Fatalf("uninstall-service isn't available on %s", runtime.GOOS)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+//name of the Task Scheduler entry
+const taskName = "gke-ip-update"
+
+//Task Scheduler definition, see https://docs.microsoft.com/en-us/windows/win32/taskschd/task-scheduler-schema
+type taskDefinition struct {
+	XMLName     xml.Name `xml:"Task"`
+	Version     string   `xml:"version,attr"`
+	Xmlns       string   `xml:"xmlns,attr"`
+	Description string   `xml:"RegistrationInfo>Description"`
+	Triggers    struct {
+		Logon struct {
+			Enabled bool   `xml:"Enabled"`
+			UserID  string `xml:"UserId"`
+		} `xml:"LogonTrigger"`
+		Event struct {
+			Enabled      bool   `xml:"Enabled"`
+			Subscription string `xml:"Subscription"`
+			Delay        string `xml:"Delay"`
+		} `xml:"EventTrigger"`
+	} `xml:"Triggers"`
+	Settings struct {
+		MultipleInstancesPolicy    string `xml:"MultipleInstancesPolicy"`
+		DisallowStartIfOnBatteries bool   `xml:"DisallowStartIfOnBatteries"`
+		StopIfGoingOnBatteries     bool   `xml:"StopIfGoingOnBatteries"`
+		StartWhenAvailable         bool   `xml:"StartWhenAvailable"`
+		RunOnlyIfNetworkAvailable  bool   `xml:"RunOnlyIfNetworkAvailable"`
+		ExecutionTimeLimit         string `xml:"ExecutionTimeLimit"`
+	} `xml:"Settings"`
+	Command   string `xml:"Actions>Exec>Command"`
+	Arguments string `xml:"Actions>Exec>Arguments"`
+}
+
+//network profile events logged when the machine connects to a network
+const networkChangeQuery = `<QueryList><Query Id="0" Path="Microsoft-Windows-NetworkProfile/Operational"><Select Path="Microsoft-Windows-NetworkProfile/Operational">*[System[EventID=10000]]</Select></Query></QueryList>`
+
+//register a scheduled task running the app with --once and the given flags at logon and whenever the network changes
+func (a *App) installService(args []string) {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	u, err := user.Current()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var task taskDefinition
+	task.Version = "1.2"
+	task.Xmlns = "http://schemas.microsoft.com/windows/2004/02/mit/task"
+	task.Description = "Keeps the public IP authorized in the master authorized networks of " + a.ClusterID
+	task.Triggers.Logon.Enabled = true
+	task.Triggers.Logon.UserID = u.Username
+	task.Triggers.Event.Enabled = true
+	task.Triggers.Event.Subscription = networkChangeQuery
+	task.Triggers.Event.Delay = "PT30S"
+	task.Settings.MultipleInstancesPolicy = "IgnoreNew"
+	task.Settings.StartWhenAvailable = true
+	task.Settings.RunOnlyIfNetworkAvailable = true
+	task.Settings.ExecutionTimeLimit = "PT1H"
+	task.Command = exe
+	task.Arguments = taskArguments(append(args, "--once"))
+
+	data, err := xml.MarshalIndent(task, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	//schtasks reads the definition as UTF-16
+	path := filepath.Join(os.TempDir(), taskName+".xml")
+	if err := ioutil.WriteFile(path, utf16File(`<?xml version="1.0" encoding="UTF-16"?>`+"\n"+string(data)), 0600); err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	if err := schtasks("/Create", "/TN", taskName, "/XML", path, "/F"); err != nil {
+		log.Fatal(err)
+	}
+	a.writeLog(fmt.Sprintf("Installed scheduled task %s \n", taskName))
+	fmt.Printf("Scheduled task %s installed, it runs at logon and whenever the network changes\n", taskName)
+}
+
+//remove the scheduled task
+func (a *App) uninstallService() {
+	if err := schtasks("/Delete", "/TN", taskName, "/F"); err != nil {
+		log.Fatal(err)
+	}
+	a.writeLog(fmt.Sprintf("Removed scheduled task %s \n", taskName))
+	fmt.Printf("Scheduled task %s removed\n", taskName)
+}
+
+func schtasks(args ...string) error {
+	out, err := exec.Command("schtasks", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("schtasks %s : %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+//the command line of the task, quoting arguments with spaces the way Windows programs split them
+func taskArguments(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\"") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = `"` + strings.Replace(arg, `"`, `\"`, -1) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+//UTF-16 little endian with a byte order mark
+func utf16File(s string) []byte {
+	data := []byte{0xff, 0xfe}
+	for _, c := range utf16.Encode([]rune(s)) {
+		data = append(data, byte(c), byte(c>>8))
+	}
+	return data
+}
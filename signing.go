@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//the HMAC key signing the state files, created with the state directory. Existing files are signed when it is,
+//so upgrading doesn't look like tampering. A missing key while files are signed isn't recreated : signing the files
+//again as they are would accept whatever was changed once the key was deleted.
+func (a *App) stateKey() ([]byte, error) {
+	a.stateKeyOnce.Do(func() {
+		path := a.statePath("state.key")
+		key, err := ioutil.ReadFile(path)
+		if !os.IsNotExist(err) {
+			a.stateKeyValue, a.stateKeyErr = key, err
+			return
+		}
+		signed, err := filepath.Glob(a.statePath("*.sig"))
+		if err != nil {
+			a.stateKeyErr = err
+			return
+		}
+		if len(signed) > 0 {
+			a.stateKeyErr = fmt.Errorf("%s is missing while the state files are signed, restore it, or move the state directory %s aside to start over", path, a.stateDir)
+			return
+		}
+
+		key = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			a.stateKeyErr = err
+			return
+		}
+		if err := ioutil.WriteFile(path, key, 0600); err != nil {
+			a.stateKeyErr = err
+			return
+		}
+		a.stateKeyValue = key
+		a.stateKeyErr = a.signExistingFiles(key)
+	})
+	return a.stateKeyValue, a.stateKeyErr
+}
+
+//sign the files of the state directory written before signing was enabled
+func (a *App) signExistingFiles(key []byte) error {
+	return filepath.Walk(a.stateDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(a.stateDir, path)
+		if err != nil || strings.HasSuffix(name, ".sig") || strings.HasSuffix(name, ".key") || strings.Contains(name, ".log") {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path+".sig", []byte(signature(key, data)), 0600)
+	})
+}
+
+//HMAC-SHA256 of a state file, hex encoded
+func signature(key, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//write a signed state file : the file, then its signature as <name>.sig, each replaced at once through a temporary
+//file so readers never see half of one. A file that was tampered with is kept as <name>.tampered before it's replaced.
+func (a *App) writeSignedStateFile(name string, data []byte) error {
+	key, err := a.stateKey()
+	if err != nil {
+		return err
+	}
+	path := a.statePath(name)
+	if old, err := ioutil.ReadFile(path); err == nil && !a.signatureMatches(key, name, old) {
+		if err := os.Rename(path, path+".tampered"); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	return writeFileAtomic(path+".sig", []byte(signature(key, data)))
+}
+
+//replace a file readable by the user only at once, by renaming a temporary file over it
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+//check whether the signature of a state file matches its data
+func (a *App) signatureMatches(key []byte, name string, data []byte) bool {
+	sig, err := ioutil.ReadFile(a.statePath(name + ".sig"))
+	return err == nil && hmac.Equal(bytes.TrimSpace(sig), []byte(signature(key, data)))
+}
+
+//check the signature of a state file. A file modified by something else than the app is alerted about and reads as
+//missing, so the app starts over from the cluster instead of trusting it. Reading changes nothing : the next write of
+//the file keeps the tampered one as <name>.tampered.
+func (a *App) verifyStateFile(name string, data []byte) ([]byte, error) {
+	key, err := a.stateKey()
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		if a.signatureMatches(key, name, data) {
+			return data, nil
+		}
+		if attempt > 2 {
+			break
+		}
+
+		//another process may be between writing the file and its signature
+		time.Sleep(200 * time.Millisecond)
+		if data, err = ioutil.ReadFile(a.statePath(name)); err != nil {
+			return nil, err
+		}
+	}
+
+	path := a.statePath(name)
+	a.tamperedMu.Lock()
+	alerted := a.tampered[name]
+	a.tampered[name] = true
+	a.tamperedMu.Unlock()
+	if !alerted {
+		message := fmt.Sprintf("State file %s was modified outside of gke-ip-update, it's ignored and kept as %s.tampered once the app writes it again", path, path)
+		a.writeLog(message + " \n")
+		a.notify("critical", message)
+	}
+	return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+}
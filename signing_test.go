@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//an app keeping its state in a temporary directory
+func newStateApp(t *testing.T) *App {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gke-ip-update-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	a := newTestApp(t)
+	a.stateDir = dir
+	return a
+}
+
+func TestVerifyStateFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, a *App)
+		valid  bool
+	}{
+		{name: "untouched", tamper: func(t *testing.T, a *App) {}, valid: true},
+		{
+			name: "file modified",
+			tamper: func(t *testing.T, a *App) {
+				writeFile(t, a.statePath("ip.txt"), "198.51.100.7")
+			},
+		},
+		{
+			name: "signature modified",
+			tamper: func(t *testing.T, a *App) {
+				writeFile(t, a.statePath("ip.txt.sig"), signature([]byte("another key"), []byte("203.0.113.1")))
+			},
+		},
+		{
+			name: "signature removed",
+			tamper: func(t *testing.T, a *App) {
+				if err := os.Remove(a.statePath("ip.txt.sig")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newStateApp(t)
+			if err := a.writeSignedStateFile("ip.txt", []byte("203.0.113.1")); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(t, a)
+
+			data, err := ioutil.ReadFile(a.statePath("ip.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := a.verifyStateFile("ip.txt", data)
+			if tt.valid {
+				if err != nil || string(got) != "203.0.113.1" {
+					t.Fatalf("got %q, %v, want the file", got, err)
+				}
+				return
+			}
+			if !os.IsNotExist(err) {
+				t.Fatalf("got %q, %v, want the file to read as missing", got, err)
+			}
+
+			//the next write keeps the tampered file aside
+			if err := a.writeSignedStateFile("ip.txt", []byte("203.0.113.2")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(a.statePath("ip.txt.tampered")); err != nil {
+				t.Errorf("tampered file not kept : %v", err)
+			}
+			if data, err := a.verifyStateFile("ip.txt", []byte("203.0.113.2")); err != nil || string(data) != "203.0.113.2" {
+				t.Errorf("got %q, %v after writing the file again", data, err)
+			}
+		})
+	}
+}
+
+func TestStateKey(t *testing.T) {
+	t.Run("existing files signed", func(t *testing.T) {
+		a := newStateApp(t)
+		writeFile(t, a.statePath("ip.txt"), "203.0.113.1")
+		if _, err := a.stateKey(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.verifyStateFile("ip.txt", []byte("203.0.113.1")); err != nil {
+			t.Errorf("file written before the key doesn't verify : %v", err)
+		}
+		if info, err := os.Stat(a.statePath("state.key")); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("got key %v, %v, want a file readable by the user only", info, err)
+		}
+	})
+
+	t.Run("missing key not recreated", func(t *testing.T) {
+		a := newStateApp(t)
+		writeFile(t, a.statePath("ip.txt"), "203.0.113.1")
+		writeFile(t, a.statePath("ip.txt.sig"), "0123")
+		if _, err := a.stateKey(); err == nil {
+			t.Error("key recreated while the files are signed")
+		}
+		if _, err := os.Stat(a.statePath("state.key")); !os.IsNotExist(err) {
+			t.Errorf("got %v, want no key written", err)
+		}
+	})
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
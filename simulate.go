@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gke-ip-update/updater"
+
+	"google.golang.org/api/container/v1"
+)
+
+//fake IP changes against an in-memory cluster, to try notifications without waiting for the ISP.
+//Enabled with the hidden --simulate-ip flag.
+type simulatedCluster struct {
+	start  time.Time
+	blocks []*container.CidrBlock
+	ops    int
+}
+
+//the fake IP for the current step, moving to the next one of --simulate-ip every --simulate-interval
+func (a *App) simulatedIP() (string, error) {
+	ips := strings.Split(a.SimulateIPs, ",")
+	if a.simulation.start.IsZero() {
+		a.simulation.start = time.Now()
+	}
+
+	step := int(time.Since(a.simulation.start) / a.SimulateInterval)
+	return strings.TrimSpace(ips[step%len(ips)]), nil
+}
+
+//apply the entries to the in-memory cluster
+func (a *App) simulateUpdate(st *state) (*updater.Change, error) {
+	entries := st.entries()
+	st.writing(entries)
+	blocks, change := updater.Plan(a.simulation.blocks, entries, st.managed)
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return change, nil
+	}
+
+	a.simulation.ops++
+	a.simulation.blocks = blocks
+	change.Operation = &container.Operation{Name: fmt.Sprintf("simulated-%d", a.simulation.ops), Status: "DONE"}
+	a.writeLog(fmt.Sprintf("Simulated update %s : added %v removed %v \n", change.Operation.Name, describeBlocks(change.Added), describeBlocks(change.Removed)))
+	return change, nil
+}
+
+//how long to wait between checks
+func (a *App) checkInterval() time.Duration {
+	if a.SimulateIPs != "" {
+		return a.SimulateInterval
+	}
+	return a.Interval
+}
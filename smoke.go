@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gke-ip-update/updater"
+)
+
+//how long --smoke-test is retried after an update, authorized networks taking a little while to apply
+const smokeTestWindow = time.Minute
+
+//how long a run of --smoke-test can take
+const smokeTestTimeout = 30 * time.Second
+
+//longest output of --smoke-test kept in the report
+const maxSmokeOutput = 300
+
+//the outcome of --smoke-test after an update
+type smokeResult struct {
+	Passed bool   `json:"passed"`
+	Output string `json:"output,omitempty"`
+}
+
+func (r *smokeResult) String() string {
+	s := "smoke test passed"
+	if !r.Passed {
+		s = "smoke test failed"
+	}
+	if r.Output != "" {
+		s += " : " + r.Output
+	}
+	return s
+}
+
+//run --smoke-test once an update changed the cluster, catching a kubeconfig or credentials that are still broken
+//although the IP is authorized. It's tried for a minute, nil when there was nothing to test.
+func (a *App) smokeTest(ctx context.Context, change *updater.Change, err error) *smokeResult {
+	if a.SmokeTest == "" || err != nil || change == nil || change.Operation == nil || a.SimulateIPs != "" {
+		return nil
+	}
+	args, err := splitCommand(a.SmokeTest)
+	if err != nil {
+		return &smokeResult{Output: err.Error()}
+	}
+
+	deadline := time.Now().Add(smokeTestWindow)
+	for {
+		cmdCtx, cancel := context.WithTimeout(ctx, smokeTestTimeout)
+		out, err := exec.CommandContext(cmdCtx, args[0], args[1:]...).CombinedOutput()
+		cancel()
+
+		res := &smokeResult{Passed: err == nil, Output: strings.TrimSpace(string(out))}
+		if err != nil && res.Output == "" {
+			res.Output = err.Error()
+		}
+		res.Output = truncateOutput(res.Output, maxSmokeOutput)
+		if res.Passed || time.Now().After(deadline) || ctx.Err() != nil {
+			a.writeRunLog(updater.CorrelationID(ctx), fmt.Sprintf("Ran %q, %s \n", a.SmokeTest, res))
+			return res
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+//run --smoke-test for an update of the target without holding up its worker, which would miss the next changes for
+//up to a minute. A test still running is cancelled by the next one. A failure is notified on its own, as a warning.
+func (t *target) smokeInBackground(ctx context.Context, change *updater.Change) {
+	if t.app.SmokeTest == "" || change == nil || change.Operation == nil {
+		return
+	}
+	if t.smokeCancel != nil {
+		t.smokeCancel()
+	}
+	ctx, t.smokeCancel = context.WithCancel(ctx)
+	go func() {
+		res := t.app.smokeTest(ctx, change, nil)
+		if res == nil || res.Passed || ctx.Err() != nil {
+			return
+		}
+		t.app.notifyEvent(event{
+			Level:         "warning",
+			Message:       fmt.Sprintf("After the update of %s, the %s", t.cluster.Name, res),
+			Clusters:      []string{t.cluster.Name},
+			SmokeTest:     res,
+			CorrelationID: updater.CorrelationID(ctx),
+		})
+	}()
+}
+
+//cut an output to max bytes at most without splitting a character, marking it cut with ...
+func truncateOutput(output string, max int) string {
+	if len(output) <= max {
+		return output
+	}
+	for max > 0 && !utf8.RuneStart(output[max]) {
+		max--
+	}
+	return output[:max] + "..."
+}
+
+//split a command into its arguments the way a shell does, without running one : arguments are separated by spaces
+//unless they are quoted with ' or ", and a backslash escapes the next character outside of single quotes.
+//A command without any argument is refused.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+	for _, r := range command {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no command in %q", command)
+	}
+	return args, nil
+}
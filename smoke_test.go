@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{command: "kubectl get --raw /readyz", want: []string{"kubectl", "get", "--raw", "/readyz"}},
+		{command: "  kubectl\tversion \n", want: []string{"kubectl", "version"}},
+		{command: `kubectl --context "gke_p_europe-west1_prod cluster" get ns`, want: []string{"kubectl", "--context", "gke_p_europe-west1_prod cluster", "get", "ns"}},
+		{command: `sh -c 'echo "$HOME" \ ok'`, want: []string{"sh", "-c", `echo "$HOME" \ ok`}},
+		{command: `echo a\ b "c\"d" ''`, want: []string{"echo", "a b", `c"d`, ""}},
+		{command: `echo 'unterminated`, wantErr: true},
+		{command: `echo trailing\`, wantErr: true},
+		{command: "", wantErr: true},
+		{command: " \t ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got, err := splitCommand(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitCommand(%q) error = %v, want error %v", tt.command, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		max    int
+		want   string
+	}{
+		{output: "ok", max: 10, want: "ok"},
+		{output: "connection refused", max: 10, want: "connection..."},
+		{output: "délai dépassé", max: 2, want: "d..."},
+		{output: strings.Repeat("é", 3), max: 3, want: "é..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			if got := truncateOutput(tt.output, tt.max); got != tt.want {
+				t.Errorf("truncateOutput(%q, %d) = %q, want %q", tt.output, tt.max, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//a WAN link whose public IP is authorized under its own entry
+type link struct {
+	name   string
+	source string
+}
+
+//--link flags, given as name=source
+type linkFlags []link
+
+func (l *linkFlags) String() string {
+	var specs []string
+	for _, k := range *l {
+		specs = append(specs, k.name+"="+k.source)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (l *linkFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected name=source, got %q", value)
+	}
+
+	source := parts[1]
+	if source != "checkip" && source != "lb" && !strings.HasPrefix(source, "hostname:") && net.ParseIP(source).To4() == nil {
+		return fmt.Errorf("unknown source %q for link %s, expected checkip, lb, hostname:<host> or an IPv4 address", source, parts[0])
+	}
+
+	*l = append(*l, link{name: parts[0], source: source})
+	return nil
+}
+
+//check whether one of the links reads its IP from source
+func (l linkFlags) uses(source string) bool {
+	for _, k := range l {
+		if k.source == source {
+			return true
+		}
+	}
+	return false
+}
+
+//find the public IP of the link
+func (a *App) findIP(l link) (string, error) {
+	ip, err := a.findRawIP(l)
+	if err != nil {
+		return "", err
+	}
+	return normalizeIP(ip)
+}
+
+func (a *App) findRawIP(l link) (string, error) {
+	switch {
+	case l.source == "checkip":
+		return a.checkIP()
+	case l.source == "lb":
+		return a.lbEchoIP()
+	case strings.HasPrefix(l.source, "hostname:"):
+		return resolveHostname(strings.TrimPrefix(l.source, "hostname:"), a.ResolverAddr)
+	default:
+		return l.source, nil
+	}
+}
+
+//find the public IP of every entry, the ones of the users of --users-dir included, keyed by display name.
+//Links that can't be checked keep their previous IP.
+func (a *App) findIPs(previous map[string]string) (map[string]string, error) {
+	ips, err := a.findOwnIPs(previous)
+	if err != nil {
+		return nil, err
+	}
+
+	tenants, errs := a.loadTenants()
+	for _, err := range errs {
+		a.writeLog(fmt.Sprintf("Unable to read the users : %s \n", err.Error()))
+	}
+	for _, t := range tenants {
+		for _, l := range t.links {
+			name := t.entryName(l)
+			ip, err := a.findIP(l)
+			if err != nil {
+				a.writeLog(fmt.Sprintf("Unable to find the IP of link %s of %s : %s \n", l.name, t.user, err.Error()))
+				ip = previous[name]
+			}
+			if ip != "" {
+				ips[name] = ip
+			}
+		}
+	}
+
+	return ips, nil
+}
+
+//find the public IP of the entries of the daemon itself
+func (a *App) findOwnIPs(previous map[string]string) (map[string]string, error) {
+	if len(a.Links) == 0 {
+		ip, err := a.findPublicIP()
+		if err == nil {
+			ip, err = normalizeIP(ip)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{a.NetworkDisplayName: ip}, nil
+	}
+
+	ips := map[string]string{}
+	var failed []string
+	for _, l := range a.Links {
+		name := a.NetworkDisplayName + "-" + l.name
+		ip, err := a.findIP(l)
+		if err != nil {
+			a.writeLog(fmt.Sprintf("Unable to find the IP of link %s : %s \n", l.name, err.Error()))
+			failed = append(failed, l.name)
+			ip = previous[name]
+		}
+		if ip != "" {
+			ips[name] = ip
+		}
+	}
+
+	if len(failed) == len(a.Links) {
+		return nil, fmt.Errorf("unable to find the IP of any link (%s)", strings.Join(failed, ", "))
+	}
+
+	return ips, nil
+}
+
+//find the public IP address using the configured source
+func (a *App) findPublicIP() (string, error) {
+	if a.SimulateIPs != "" {
+		return a.simulatedIP()
+	}
+
+	switch a.IPSource {
+	case "checkip":
+		return a.checkIP()
+	case "hostname":
+		return resolveHostname(a.Hostname, a.ResolverAddr)
+	case "lb":
+		return a.lbEchoIP()
+	default:
+		return "", fmt.Errorf("unknown ip source %q", a.IPSource)
+	}
+}
+
+//ask checkip.amazonaws.com (or --checkip-url) for the public IP address
+func (a *App) checkIP() (string, error) {
+	resp, err := a.httpClient(detection).Get(a.CheckIPURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s answered %s", a.CheckIPURL, resp.Status)
+	}
+
+	ip, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(ip), nil
+}
+
+//write an IP the way it is compared and stored, whatever format the source gave it in, so a provider
+//changing its format doesn't look like an IP change on every check. Spaces and line endings are dropped and
+//IPv4-mapped IPv6 addresses become IPv4 ones. Other IPv6 addresses are refused, the entries are authorized as /32.
+func normalizeIP(s string) (string, error) {
+	ip := net.ParseIP(strings.TrimSpace(strings.TrimPrefix(s, "\ufeff")))
+	if ip == nil {
+		return "", fmt.Errorf("%q isn't an IP address", strings.TrimSpace(s))
+	}
+	v4 := ip.To4()
+	if v4 == nil {
+		return "", fmt.Errorf("%s isn't an IPv4 address", ip)
+	}
+	return v4.String(), nil
+}
+
+//use the address a DDNS hostname points to, optionally asking a specific DNS server
+func resolveHostname(host, server string) (string, error) {
+	resolver := net.DefaultResolver
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+
+	var v6 []string
+	for _, addr := range addrs {
+		if ip4 := addr.IP.To4(); ip4 != nil {
+			return ip4.String(), nil
+		}
+		v6 = append(v6, addr.IP.String())
+	}
+
+	if len(v6) > 0 {
+		return "", fmt.Errorf("%s only has IPv6 addresses (%s), master authorized networks need IPv4", host, strings.Join(v6, ", "))
+	}
+
+	return "", fmt.Errorf("%s has no addresses", host)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gke-ip-update/checkiptest"
+)
+
+func TestCheckIP(t *testing.T) {
+	s := checkiptest.NewServer(checkiptest.Response{IP: "203.0.113.1"}, checkiptest.Response{Status: 503})
+	defer s.Close()
+	a := newTestApp(t, "--network-name", "home", "--checkip-url", s.URL)
+
+	t.Run("answer", func(t *testing.T) {
+		ip, err := a.checkIP()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip != "203.0.113.1\n" {
+			t.Errorf("checkIP() = %q, want the body of the answer", ip)
+		}
+	})
+	t.Run("failing answer", func(t *testing.T) {
+		if _, err := a.checkIP(); err == nil {
+			t.Error("checkIP() succeeded on a 503")
+		}
+		if s.Requests() != 2 {
+			t.Errorf("%d requests, want 2", s.Requests())
+		}
+	})
+}
+
+func TestFindIPs(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []checkiptest.Response
+		args      []string
+		previous  map[string]string
+		want      map[string]string
+		wantErr   bool
+	}{
+		{
+			name:      "checkip",
+			responses: []checkiptest.Response{{IP: "203.0.113.1"}},
+			want:      map[string]string{"home": "203.0.113.1"},
+		},
+		{
+			name:      "ipv4-mapped answer normalized",
+			responses: []checkiptest.Response{{IP: "::ffff:203.0.113.1"}},
+			want:      map[string]string{"home": "203.0.113.1"},
+		},
+		{
+			name:      "checkip failing",
+			responses: []checkiptest.Response{{Status: 503}},
+			previous:  map[string]string{"home": "203.0.113.1"},
+			wantErr:   true,
+		},
+		{
+			name:      "ipv6 answer",
+			responses: []checkiptest.Response{{IP: "2001:db8::1"}},
+			wantErr:   true,
+		},
+		{
+			name:      "not an ip",
+			responses: []checkiptest.Response{{IP: "<html>"}},
+			wantErr:   true,
+		},
+		{
+			name:      "links",
+			responses: []checkiptest.Response{{IP: "203.0.113.1"}},
+			args:      []string{"--link", "fiber=checkip", "--link", "lte=198.51.100.7"},
+			want:      map[string]string{"home-fiber": "203.0.113.1", "home-lte": "198.51.100.7"},
+		},
+		{
+			name:      "failing link keeps its previous ip",
+			responses: []checkiptest.Response{{Status: 503}},
+			args:      []string{"--link", "fiber=checkip", "--link", "lte=198.51.100.7"},
+			previous:  map[string]string{"home-fiber": "203.0.113.1", "home-lte": "198.51.100.7"},
+			want:      map[string]string{"home-fiber": "203.0.113.1", "home-lte": "198.51.100.7"},
+		},
+		{
+			name:      "every link failing",
+			responses: []checkiptest.Response{{Status: 503}},
+			args:      []string{"--link", "fiber=checkip", "--link", "backup=checkip"},
+			previous:  map[string]string{"home-fiber": "203.0.113.1", "home-backup": "198.51.100.7"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := checkiptest.NewServer(tt.responses...)
+			defer s.Close()
+			a := newTestApp(t, append([]string{"--network-name", "home", "--checkip-url", s.URL}, tt.args...)...)
+
+			got, err := a.findIPs(tt.previous)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findIPs() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findIPs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeIP(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "203.0.113.1", want: "203.0.113.1"},
+		{in: " 203.0.113.1\r\n", want: "203.0.113.1"},
+		{in: "\ufeff203.0.113.1", want: "203.0.113.1"},
+		{in: "::ffff:203.0.113.1", want: "203.0.113.1"},
+		{in: "2001:db8::1", wantErr: true},
+		{in: "2001:0db8:0000:0000:0000:0000:0000:0001", wantErr: true},
+		{in: "<html>", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := normalizeIP(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeIP(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeIP(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
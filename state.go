@@ -0,0 +1,675 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/container/v1"
+)
+
+//local state describing what the app authorized in the cluster
+type state struct {
+	IPs                map[string]string `json:"ips"`
+	History            []previousIP      `json:"history,omitempty"`
+	LastUpdateDuration time.Duration     `json:"lastUpdateDuration,omitempty"`
+	//consecutive failed updates of the clusters by resource name, and the clusters whose updates they disabled
+	Failures map[string]int `json:"clusterFailures,omitempty"`
+	Disabled []string       `json:"disabledClusters,omitempty"`
+	//entries the app used to maintain, which stay in the cluster unless --orphans removes them
+	Orphans []string `json:"orphans,omitempty"`
+	//the clusters, by resource name, an orphan or a managed network was removed from. It's forgotten once every
+	//cluster removed it.
+	Removed map[string][]string `json:"removed,omitempty"`
+	//the networks the app wrote, by display name without metadata, with the entry, set of ranges or temporary entry
+	//they belong to. Only these and the ones the state would write are maintained, whatever other networks are named.
+	Managed map[string]string `json:"managed,omitempty"`
+	//when the current IP of every entry was first seen
+	Since map[string]time.Time `json:"since,omitempty"`
+	//the last --recent-ips IPs of the entries, newest first
+	Recent []recentIP `json:"recent,omitempty"`
+	//networks authorized by `allow` until they expire
+	Temporary []temporaryEntry `json:"temporary,omitempty"`
+	//the networks of the --ranges sets, and when they were last fetched
+	Ranges        map[string][]string `json:"ranges,omitempty"`
+	RangesChecked time.Time           `json:"rangesChecked,omitempty"`
+	//the networks of the last import, which then lists every network of the cluster besides the ones of the app
+	Static   []staticEntry `json:"static,omitempty"`
+	Imported bool          `json:"imported,omitempty"`
+	//the IPs the guard refused for every entry, so they are alerted about once
+	rejected map[string]string
+	//the networks the last update of a snapshot wrote, as names returns them
+	written map[string]string
+	//the correlation ID of the reconcile applying the IPs seen by the next update
+	correlationID string
+	app           *App
+}
+
+//an IP that used to be authorized under an entry
+type previousIP struct {
+	Name     string    `json:"name"`
+	IP       string    `json:"ip"`
+	Replaced time.Time `json:"replaced"`
+}
+
+//read the state, starting from scratch if there is none yet.
+//The entries of the users of --users-dir are read from their own files.
+func (a *App) loadState() *state {
+	st := a.readState("state.json")
+	if a.UsersDir == "" || a.NoState {
+		return st
+	}
+
+	paths, err := filepath.Glob(a.statePath(filepath.Join("users", "*.json")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, path := range paths {
+		u := a.readState(filepath.Join("users", filepath.Base(path)))
+		for name, ip := range u.IPs {
+			st.IPs[name] = ip
+		}
+		for name, t := range u.Since {
+			st.since(name, t)
+		}
+		st.History = append(st.History, u.History...)
+		st.Recent = append(st.Recent, u.Recent...)
+	}
+	sort.SliceStable(st.Recent, func(i, j int) bool {
+		return st.Recent[i].Seen.After(st.Recent[j].Seen)
+	})
+
+	return st
+}
+
+//read a state file of the state directory
+func (a *App) readState(name string) *state {
+	st := &state{IPs: map[string]string{}, app: a}
+
+	data, err := a.readStateFile(name)
+	if os.IsNotExist(err) {
+		return st
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := json.Unmarshal(data, st); err != nil {
+		a.writeLog(fmt.Sprintf("Ignoring unreadable state file %s : %s \n", name, err.Error()))
+		return &state{IPs: map[string]string{}, app: a}
+	}
+	if st.IPs == nil {
+		st.IPs = map[string]string{}
+	}
+	//older versions stored the IPs as the source gave them
+	for name, ip := range st.IPs {
+		if normalized, err := normalizeIP(ip); err == nil {
+			st.IPs[name] = normalized
+		}
+	}
+	for i, p := range st.History {
+		if normalized, err := normalizeIP(p.IP); err == nil {
+			st.History[i].IP = normalized
+		}
+	}
+
+	return st
+}
+
+//persist the state, keeping the entries of every user of --users-dir apart in users/<user>.json
+func (a *App) saveState(st *state) {
+	if a.UsersDir == "" || a.NoState {
+		a.writeState("state.json", st)
+		return
+	}
+
+	tenants, _ := a.loadTenants()
+	parts := map[string]*state{"": {IPs: map[string]string{}, LastUpdateDuration: st.LastUpdateDuration, Failures: st.Failures, Disabled: st.Disabled, Orphans: st.Orphans, Removed: st.Removed, Managed: st.Managed, Temporary: st.Temporary, Ranges: st.Ranges, RangesChecked: st.RangesChecked, Static: st.Static, Imported: st.Imported}}
+	part := func(displayName string) *state {
+		owner := entryOwner(tenants, displayName)
+		p, ok := parts[owner]
+		if !ok {
+			p = &state{IPs: map[string]string{}}
+			parts[owner] = p
+		}
+		return p
+	}
+	for name, ip := range st.IPs {
+		part(name).IPs[name] = ip
+		if t, ok := st.Since[name]; ok {
+			part(name).since(name, t)
+		}
+	}
+	for _, p := range st.History {
+		h := part(p.Name)
+		h.History = append(h.History, p)
+	}
+	for _, r := range st.Recent {
+		h := part(r.Name)
+		h.Recent = append(h.Recent, r)
+	}
+
+	if err := os.MkdirAll(a.statePath("users"), 0700); err != nil {
+		log.Fatal(err)
+	}
+	for owner, p := range parts {
+		if owner == "" {
+			a.writeState("state.json", p)
+		} else {
+			a.writeState(filepath.Join("users", owner+".json"), p)
+		}
+	}
+
+	//forget the users that are gone
+	paths, err := filepath.Glob(a.statePath(filepath.Join("users", "*.json")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, path := range paths {
+		if _, ok := parts[strings.TrimSuffix(filepath.Base(path), ".json")]; !ok {
+			os.Remove(path)
+			os.Remove(path + ".sig")
+		}
+	}
+}
+
+//write a state file of the state directory
+func (a *App) writeState(name string, st *state) {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := a.writeStateFile(name, data); err != nil {
+		log.Fatal(err)
+	}
+}
+
+//count a failed update of a cluster, disabling its updates once the failures allowed by its class are reached.
+//The other clusters keep being updated.
+func (a *App) countFailure(st *state, cluster string, err error, c class) {
+	if st.Failures == nil {
+		st.Failures = map[string]int{}
+	}
+	st.Failures[cluster]++
+	max := c.maxFailures(a.Config)
+	if max == 0 || st.Failures[cluster] < max || st.disabled(cluster) {
+		return
+	}
+
+	st.Disabled = append(st.Disabled, cluster)
+	message := fmt.Sprintf("Updates of %s disabled after %d consecutive failures, run `gke-ip-update resume` once the problem is fixed. Last error : %s", cluster, st.Failures[cluster], err.Error())
+	a.writeLog(message + " \n")
+	//even the classes whose failures aren't notified tell when they stop being updated
+	level := c.failureLevel
+	if level == "" {
+		level = "warning"
+	}
+	a.notify(level, message)
+}
+
+//reset the failures of a cluster once it was updated
+func (st *state) succeeded(cluster string) {
+	delete(st.Failures, cluster)
+}
+
+//check whether the updates of a cluster were disabled after too many failures
+func (st *state) disabled(cluster string) bool {
+	return contains(st.Disabled, cluster)
+}
+
+//the clusters `resume` re-enabled since their updates were disabled
+func (a *App) resumed(st *state) []string {
+	saved := a.loadState()
+	var resumed, disabled []string
+	for _, cluster := range st.Disabled {
+		if saved.disabled(cluster) {
+			disabled = append(disabled, cluster)
+			continue
+		}
+		resumed = append(resumed, cluster)
+		delete(st.Failures, cluster)
+		a.writeLog(fmt.Sprintf("Updates of %s resumed \n", cluster))
+	}
+	st.Disabled = disabled
+	return resumed
+}
+
+//re-enable updates disabled after too many failures, and the ones paused with pause
+func (a *App) resume() {
+	unpaused := a.unpause()
+	st := a.loadState()
+	if len(st.Disabled) == 0 {
+		if !unpaused {
+			fmt.Println("Updates are not disabled")
+		}
+		return
+	}
+
+	for _, cluster := range st.Disabled {
+		delete(st.Failures, cluster)
+	}
+	fmt.Printf("Updates of %s resumed, a running app picks this up on its next check\n", strings.Join(st.Disabled, ", "))
+	st.Disabled = nil
+	a.saveState(st)
+}
+
+//replace the IPs of every entry, remembering the ones that were replaced, unless the guard refuses them.
+//Reports whether anything changed.
+func (st *state) update(ips map[string]string) bool {
+	ips = st.guard(ips)
+	changed := len(ips) != len(st.IPs)
+	var gone, added []string
+	for name := range st.IPs {
+		if _, ok := ips[name]; !ok {
+			gone = append(gone, name)
+		}
+	}
+	for name, ip := range ips {
+		old, ok := st.IPs[name]
+		if !ok {
+			added = append(added, name)
+		}
+		if old == ip {
+			continue
+		}
+
+		changed = true
+		st.since(name, time.Now())
+		st.seen(name, ip)
+		if old != "" {
+			st.app.writeLog(fmt.Sprintf("IP change detected for %s from : %s , to : %s \n", name, old, ip))
+			st.remember(name, old)
+		}
+	}
+
+	if len(gone) > 0 {
+		st.orphan(gone, added, ips)
+	}
+	for _, name := range gone {
+		delete(st.Since, name)
+	}
+	for _, name := range added {
+		delete(st.Removed, name)
+	}
+	st.Orphans = subtract(st.Orphans, added)
+	st.IPs = ips
+	return changed
+}
+
+//record when the current IP of an entry was first seen
+func (st *state) since(name string, t time.Time) {
+	if st.Since == nil {
+		st.Since = map[string]time.Time{}
+	}
+	st.Since[name] = t
+}
+
+//remember the entries that are no longer configured. With --orphans rename, a single entry replaced by a single
+//new one is a rename: its previous IPs move to the new name.
+func (st *state) orphan(gone, added []string, ips map[string]string) {
+	sort.Strings(gone)
+	if st.app.Orphans == "rename" && len(gone) == 1 && len(added) == 1 {
+		old, name := gone[0], added[0]
+		for i := range st.History {
+			if st.History[i].Name == old {
+				st.History[i].Name = name
+			}
+		}
+		if st.IPs[old] != ips[name] {
+			st.remember(name, st.IPs[old])
+		}
+		st.app.writeLog(fmt.Sprintf("Entry %s renamed to %s \n", old, name))
+	} else if st.app.Orphans == "warn" {
+		st.app.writeLog(fmt.Sprintf("Entries no longer configured stay in the cluster : %s, run with --orphans remove or --orphans rename to clean them up \n", strings.Join(gone, ", ")))
+		//the networks of the orphans are no longer the app's to remove
+		for name, owner := range st.Managed {
+			if contains(gone, owner) {
+				delete(st.Managed, name)
+				delete(st.Removed, name)
+			}
+		}
+	}
+
+	for _, name := range gone {
+		if !contains(st.Orphans, name) {
+			st.Orphans = append(st.Orphans, name)
+		}
+	}
+}
+
+//record the networks a successful update of the applied state wrote as managed, and the orphans, expired temporary
+//entries and managed networks it removed from the cluster, forgetting them once they are removed from every one of
+//the clusters. Until then they stay managed, so the clusters that failed, are paused or wait for their
+//--cluster-interval still remove them.
+func (st *state) cleaned(applied *state, err error, cluster string, clusters []string) {
+	if err != nil {
+		return
+	}
+	everywhere := func(removedFrom []string) bool {
+		for _, c := range clusters {
+			if !contains(removedFrom, c) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if applied.written != nil {
+		if st.Managed == nil {
+			st.Managed = map[string]string{}
+		}
+		for name, owner := range applied.written {
+			st.Managed[name] = owner
+			if removedFrom := subtract(st.Removed[name], []string{cluster}); len(removedFrom) > 0 {
+				st.Removed[name] = removedFrom
+			} else {
+				delete(st.Removed, name)
+			}
+		}
+		for name := range st.Managed {
+			if _, ok := applied.written[name]; ok {
+				continue
+			}
+			if !contains(st.Removed[name], cluster) {
+				if st.Removed == nil {
+					st.Removed = map[string][]string{}
+				}
+				st.Removed[name] = append(st.Removed[name], cluster)
+			}
+			if everywhere(st.Removed[name]) {
+				delete(st.Managed, name)
+				delete(st.Removed, name)
+			}
+		}
+	}
+
+	if st.app.Orphans != "warn" {
+		var orphans []string
+		for _, name := range st.Orphans {
+			if contains(applied.Orphans, name) && !contains(st.Removed[name], cluster) {
+				if st.Removed == nil {
+					st.Removed = map[string][]string{}
+				}
+				st.Removed[name] = append(st.Removed[name], cluster)
+			}
+			if everywhere(st.Removed[name]) {
+				delete(st.Removed, name)
+				continue
+			}
+			orphans = append(orphans, name)
+		}
+		st.Orphans = orphans
+	}
+
+	var temporary []temporaryEntry
+	for _, t := range st.Temporary {
+		if i := applied.temporary(t.Name); i >= 0 && applied.Temporary[i].Expired && applied.Temporary[i].Added.Equal(t.Added) && !contains(t.RemovedFrom, cluster) {
+			t.RemovedFrom = append(append([]string(nil), t.RemovedFrom...), cluster)
+		}
+		if !t.Expired || !everywhere(t.RemovedFrom) {
+			temporary = append(temporary, t)
+		}
+	}
+	st.Temporary = temporary
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+//add an IP to the front of the history
+func (st *state) remember(name, ip string) {
+	history := []previousIP{{Name: name, IP: ip, Replaced: time.Now()}}
+	for _, p := range st.History {
+		if p.Name != name || p.IP != ip {
+			history = append(history, p)
+		}
+	}
+
+	st.History = history
+	st.prune()
+}
+
+//drop previous IPs that are neither among the last --keep-ips of their entry nor inside the --grace-period.
+//Reports whether anything was dropped.
+func (st *state) prune() bool {
+	var history []previousIP
+	kept := map[string]int{}
+	for _, p := range st.History {
+		if kept[p.Name] < st.app.KeepIPs || time.Since(p.Replaced) < st.app.GracePeriod {
+			kept[p.Name]++
+			history = append(history, p)
+		}
+	}
+
+	pruned := len(history) != len(st.History)
+	st.History = history
+	return pruned
+}
+
+//networks the app should maintain
+func (st *state) entries() []*container.CidrBlock {
+	var names []string
+	for name := range st.IPs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	meta := func(name string, since time.Time) entryMeta {
+		return entryMeta{}
+	}
+	if st.app.NameMetadata != "" {
+		meta = st.app.localMeta()
+	}
+
+	var blocks []*container.CidrBlock
+	for _, name := range names {
+		displayName := st.app.formatDisplayName(name, meta(name, st.Since[name]))
+		blocks = append(blocks, &container.CidrBlock{CidrBlock: fmt.Sprintf("%s/32", st.IPs[name]), DisplayName: displayName})
+	}
+
+	seen := map[string]int{}
+	for _, p := range st.History {
+		current, ok := st.IPs[p.Name]
+		if !ok || current == p.IP {
+			continue
+		}
+		seen[p.Name]++
+		//previous IPs carry the time they were replaced
+		displayName := st.app.formatDisplayName(fmt.Sprintf("%s-prev%d", p.Name, seen[p.Name]), meta(p.Name, p.Replaced))
+		blocks = append(blocks, &container.CidrBlock{CidrBlock: fmt.Sprintf("%s/32", p.IP), DisplayName: displayName})
+	}
+
+	var sets []string
+	for name := range st.Ranges {
+		sets = append(sets, name)
+	}
+	sort.Strings(sets)
+	for _, name := range sets {
+		for i, network := range st.Ranges[name] {
+			displayName := st.app.formatDisplayName(fmt.Sprintf("%s-%d", name, i+1), meta(name, st.RangesChecked))
+			blocks = append(blocks, &container.CidrBlock{CidrBlock: network, DisplayName: displayName})
+		}
+	}
+
+	for _, t := range st.Temporary {
+		if st.app.applicable(t) {
+			blocks = append(blocks, &container.CidrBlock{CidrBlock: t.CIDR, DisplayName: st.app.formatDisplayName(t.Name, meta(t.Name, t.Added))})
+		}
+	}
+
+	for _, s := range st.Static {
+		blocks = append(blocks, &container.CidrBlock{CidrBlock: s.CIDR, DisplayName: s.Name})
+	}
+
+	return blocks
+}
+
+//the display names, without metadata, of the networks entries returns, with what they belong to : the entry of an IP
+//or previous IP, range:<set> for a set of ranges and temporary:<name> for a temporary entry
+func (st *state) names() map[string]string {
+	names := map[string]string{}
+	for name := range st.IPs {
+		names[name] = name
+	}
+	seen := map[string]int{}
+	for _, p := range st.History {
+		if current, ok := st.IPs[p.Name]; ok && current != p.IP {
+			seen[p.Name]++
+			names[fmt.Sprintf("%s-prev%d", p.Name, seen[p.Name])] = p.Name
+		}
+	}
+	for set, networks := range st.Ranges {
+		for i := range networks {
+			names[fmt.Sprintf("%s-%d", set, i+1)] = "range:" + set
+		}
+	}
+	for _, t := range st.Temporary {
+		if st.app.applicable(t) {
+			names[t.Name] = "temporary:" + t.Name
+		}
+	}
+	return names
+}
+
+//record the networks of entries an update writes, so they are managed once it succeeded
+func (st *state) writing(entries []*container.CidrBlock) {
+	names := st.names()
+	st.written = map[string]string{}
+	for _, e := range entries {
+		name, _ := parseDisplayName(e.DisplayName)
+		if owner, ok := names[name]; ok {
+			st.written[name] = owner
+		}
+	}
+}
+
+//the entries without the current and previous IPs, which --prefer-iap leaves out while the bastion is running
+func (st *state) withoutIPs(entries []*container.CidrBlock) []*container.CidrBlock {
+	names := st.names()
+	var kept []*container.CidrBlock
+	for _, e := range entries {
+		name, _ := parseDisplayName(e.DisplayName)
+		if _, ok := st.IPs[names[name]]; !ok {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+//check whether a network in the cluster is maintained by the app : every network once some were imported,
+//the entries and previous IPs otherwise
+func (st *state) managed(displayName string) bool {
+	return st.Imported || st.dynamic(displayName)
+}
+
+//check whether a network is maintained by the app : one it would write now, or wrote and didn't remove from every
+//cluster yet. A network of the users named like an entry, a previous IP or a range isn't.
+func (st *state) dynamic(displayName string) bool {
+	name, _ := parseDisplayName(displayName)
+	if _, ok := st.Managed[name]; ok {
+		return true
+	}
+	if _, ok := st.names()[name]; ok {
+		return true
+	}
+	if st.app.Orphans != "warn" && contains(st.Orphans, name) {
+		return true
+	}
+	return st.temporary(name) >= 0
+}
+
+//check whether a network is the entry name or one of its previous IPs, whatever metadata its display name holds
+func isEntry(displayName, name string) bool {
+	displayName, _ = parseDisplayName(displayName)
+	if displayName == name {
+		return true
+	}
+
+	n := strings.TrimPrefix(displayName, name+"-prev")
+	_, err := strconv.Atoi(n)
+	return n != displayName && err == nil
+}
+
+//copy of the state for an applier, so updates don't race with the next check
+func (st *state) snapshot() *state {
+	return &state{
+		IPs:                copyIPs(st.IPs),
+		History:            append([]previousIP(nil), st.History...),
+		LastUpdateDuration: st.LastUpdateDuration,
+		Failures:           copyFailures(st.Failures),
+		Disabled:           append([]string(nil), st.Disabled...),
+		Orphans:            append([]string(nil), st.Orphans...),
+		Removed:            copyRemoved(st.Removed),
+		Managed:            copyManaged(st.Managed),
+		Since:              copySince(st.Since),
+		Recent:             append([]recentIP(nil), st.Recent...),
+		Temporary:          append([]temporaryEntry(nil), st.Temporary...),
+		Ranges:             copyRanges(st.Ranges),
+		RangesChecked:      st.RangesChecked,
+		Static:             append([]staticEntry(nil), st.Static...),
+		Imported:           st.Imported,
+		app:                st.app,
+	}
+}
+
+func copyIPs(ips map[string]string) map[string]string {
+	c := make(map[string]string, len(ips))
+	for name, ip := range ips {
+		c[name] = ip
+	}
+	return c
+}
+
+func copyRemoved(removed map[string][]string) map[string][]string {
+	c := make(map[string][]string, len(removed))
+	for name, clusters := range removed {
+		c[name] = append([]string(nil), clusters...)
+	}
+	return c
+}
+
+func copyManaged(managed map[string]string) map[string]string {
+	c := make(map[string]string, len(managed))
+	for name, owner := range managed {
+		c[name] = owner
+	}
+	return c
+}
+
+//the sets are replaced rather than changed, their networks can be shared
+func copyRanges(ranges map[string][]string) map[string][]string {
+	c := make(map[string][]string, len(ranges))
+	for name, networks := range ranges {
+		c[name] = networks
+	}
+	return c
+}
+
+func copyFailures(failures map[string]int) map[string]int {
+	c := make(map[string]int, len(failures))
+	for cluster, n := range failures {
+		c[cluster] = n
+	}
+	return c
+}
+
+func copySince(since map[string]time.Time) map[string]time.Time {
+	c := make(map[string]time.Time, len(since))
+	for name, t := range since {
+		c[name] = t
+	}
+	return c
+}
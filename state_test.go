@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gke-ip-update/updater"
+
+	"google.golang.org/api/container/v1"
+)
+
+func historyOf(st *state) []string {
+	var h []string
+	for _, p := range st.History {
+		h = append(h, p.Name+"="+p.IP)
+	}
+	return h
+}
+
+func TestStateUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		from    map[string]string
+		before  []previousIP
+		to      map[string]string
+		changed bool
+		history []string
+	}{
+		{
+			name: "unchanged",
+			from: map[string]string{"home": "203.0.113.1"},
+			to:   map[string]string{"home": "203.0.113.1"},
+		},
+		{
+			name:    "ip changed, the previous one kept",
+			args:    []string{"--keep-ips", "1"},
+			from:    map[string]string{"home": "203.0.113.1"},
+			to:      map[string]string{"home": "203.0.113.2"},
+			changed: true,
+			history: []string{"home=203.0.113.1"},
+		},
+		{
+			name:    "ip changed, no previous ip kept",
+			from:    map[string]string{"home": "203.0.113.1"},
+			to:      map[string]string{"home": "203.0.113.2"},
+			changed: true,
+		},
+		{
+			name:    "previous ips beyond --keep-ips dropped",
+			args:    []string{"--keep-ips", "1"},
+			from:    map[string]string{"home-fiber": "203.0.113.2", "home-lte": "198.51.100.7"},
+			before:  []previousIP{{Name: "home-fiber", IP: "203.0.113.1"}},
+			to:      map[string]string{"home-fiber": "203.0.113.3", "home-lte": "198.51.100.7"},
+			changed: true,
+			history: []string{"home-fiber=203.0.113.2"},
+		},
+		{
+			name:    "link added",
+			from:    map[string]string{"home-fiber": "203.0.113.1"},
+			to:      map[string]string{"home-fiber": "203.0.113.1", "home-lte": "198.51.100.7"},
+			changed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &state{IPs: tt.from, History: tt.before, app: newTestApp(t, tt.args...)}
+			if changed := st.update(copyIPs(tt.to)); changed != tt.changed {
+				t.Errorf("update() = %v, want %v", changed, tt.changed)
+			}
+			if !reflect.DeepEqual(st.IPs, tt.to) {
+				t.Errorf("IPs = %v, want %v", st.IPs, tt.to)
+			}
+			if got := historyOf(st); !reflect.DeepEqual(got, tt.history) {
+				t.Errorf("history = %v, want %v", got, tt.history)
+			}
+		})
+	}
+}
+
+func TestStateCleaned(t *testing.T) {
+	clusters := []string{"projects/p/locations/l/clusters/a", "projects/p/locations/l/clusters/b"}
+	a, b := clusters[0], clusters[1]
+
+	tests := []struct {
+		name    string
+		args    []string
+		st      state
+		applied state
+		err     error
+		cluster string
+		managed map[string]string
+		removed map[string][]string
+		orphans []string
+	}{
+		{
+			name:    "written networks managed",
+			applied: state{written: map[string]string{"home": "home", "ci-1": "range:ci"}},
+			cluster: a,
+			managed: map[string]string{"home": "home", "ci-1": "range:ci"},
+		},
+		{
+			name:    "failed update",
+			st:      state{Managed: map[string]string{"old": "old"}},
+			applied: state{written: map[string]string{"home": "home"}},
+			err:     errors.New("failed"),
+			cluster: a,
+			managed: map[string]string{"old": "old"},
+		},
+		{
+			name:    "network removed from one cluster stays managed",
+			st:      state{Managed: map[string]string{"home": "home", "home-prev1": "home"}},
+			applied: state{written: map[string]string{"home": "home"}},
+			cluster: a,
+			managed: map[string]string{"home": "home", "home-prev1": "home"},
+			removed: map[string][]string{"home-prev1": {a}},
+		},
+		{
+			name:    "network removed from every cluster forgotten",
+			st:      state{Managed: map[string]string{"home": "home", "home-prev1": "home"}, Removed: map[string][]string{"home-prev1": {a}}},
+			applied: state{written: map[string]string{"home": "home"}},
+			cluster: b,
+			managed: map[string]string{"home": "home"},
+		},
+		{
+			name:    "network written again",
+			st:      state{Managed: map[string]string{"ci-1": "range:ci"}, Removed: map[string][]string{"ci-1": {a, b}}},
+			applied: state{written: map[string]string{"ci-1": "range:ci"}},
+			cluster: a,
+			managed: map[string]string{"ci-1": "range:ci"},
+			removed: map[string][]string{"ci-1": {b}},
+		},
+		{
+			name:    "orphan removed from one cluster",
+			args:    []string{"--orphans", "remove"},
+			st:      state{Orphans: []string{"home"}},
+			applied: state{Orphans: []string{"home"}},
+			cluster: a,
+			removed: map[string][]string{"home": {a}},
+			orphans: []string{"home"},
+		},
+		{
+			name:    "orphan removed from every cluster",
+			args:    []string{"--orphans", "remove"},
+			st:      state{Orphans: []string{"home"}, Removed: map[string][]string{"home": {a}}},
+			applied: state{Orphans: []string{"home"}},
+			cluster: b,
+		},
+		{
+			name:    "orphans kept with --orphans warn",
+			st:      state{Orphans: []string{"home"}},
+			applied: state{Orphans: []string{"home"}},
+			cluster: a,
+			orphans: []string{"home"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, tt.args...)
+			st, applied := tt.st, tt.applied
+			st.app, applied.app = app, app
+			st.cleaned(&applied, tt.err, tt.cluster, clusters)
+			if (len(st.Managed) != 0 || len(tt.managed) != 0) && !reflect.DeepEqual(st.Managed, tt.managed) {
+				t.Errorf("managed = %v, want %v", st.Managed, tt.managed)
+			}
+			if (len(st.Removed) != 0 || len(tt.removed) != 0) && !reflect.DeepEqual(st.Removed, tt.removed) {
+				t.Errorf("removed = %v, want %v", st.Removed, tt.removed)
+			}
+			if !reflect.DeepEqual(st.Orphans, tt.orphans) {
+				t.Errorf("orphans = %v, want %v", st.Orphans, tt.orphans)
+			}
+		})
+	}
+}
+
+func TestStateCleanedTemporary(t *testing.T) {
+	clusters := []string{"projects/p/locations/l/clusters/a", "projects/p/locations/l/clusters/b"}
+	app := newTestApp(t)
+	expired := temporaryEntry{Name: "temp-ci", CIDR: "192.0.2.1/32", Added: time.Now().Add(-time.Hour), Expired: true}
+	st := &state{Temporary: []temporaryEntry{expired}, app: app}
+
+	t.Run("removed from the first cluster", func(t *testing.T) {
+		st.cleaned(&state{Temporary: []temporaryEntry{expired}, app: app}, nil, clusters[0], clusters)
+		if len(st.Temporary) != 1 || !reflect.DeepEqual(st.Temporary[0].RemovedFrom, clusters[:1]) {
+			t.Errorf("temporary = %+v, want the entry removed from the first cluster", st.Temporary)
+		}
+	})
+	t.Run("removed from every cluster", func(t *testing.T) {
+		st.cleaned(&state{Temporary: []temporaryEntry{expired}, app: app}, nil, clusters[1], clusters)
+		if len(st.Temporary) != 0 {
+			t.Errorf("temporary = %+v, want the entry forgotten once removed from every cluster", st.Temporary)
+		}
+	})
+}
+
+func TestStateDynamic(t *testing.T) {
+	tests := []struct {
+		args    []string
+		network string
+		want    bool
+	}{
+		{network: "home", want: true},
+		{network: "home~t:qgljwg~h:laptop", want: true},
+		{network: "home-prev1", want: true},
+		{network: "home-prev2"},
+		{network: "ci-1", want: true},
+		{network: "ci-3"},
+		{network: "old-ci-1", want: true},
+		{network: "temp-ci", want: true},
+		{network: "gone"},
+		{args: []string{"--orphans", "remove"}, network: "gone", want: true},
+		{network: "office"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(append([]string{tt.network}, tt.args...), " "), func(t *testing.T) {
+			st := &state{
+				IPs:       map[string]string{"home": "203.0.113.2"},
+				History:   []previousIP{{Name: "home", IP: "203.0.113.1"}},
+				Ranges:    map[string][]string{"ci": {"192.0.2.0/24", "198.51.100.0/24"}},
+				Managed:   map[string]string{"old-ci-1": "range:old-ci"},
+				Orphans:   []string{"gone"},
+				Temporary: []temporaryEntry{{Name: "temp-ci", CIDR: "192.0.2.1/32", Expired: true}},
+				app:       newTestApp(t, tt.args...),
+			}
+			if got := st.dynamic(tt.network); got != tt.want {
+				t.Errorf("dynamic(%q) = %v, want %v", tt.network, got, tt.want)
+			}
+		})
+	}
+}
+
+//a previous IP whose grace period passed is no longer an entry, the snapshot of the applier still removes it
+func TestSnapshotRemovesExpiredNetworks(t *testing.T) {
+	st := &state{
+		IPs:     map[string]string{"home": "203.0.113.2"},
+		Managed: map[string]string{"home": "home", "home-prev1": "home", "ci-2": "range:ci"},
+		Removed: map[string][]string{"ci-2": {"projects/p/locations/l/clusters/a"}},
+		app:     newTestApp(t),
+	}
+	snapshot := st.snapshot()
+	t.Run("managed and removed copied", func(t *testing.T) {
+		if !reflect.DeepEqual(snapshot.Managed, st.Managed) || !reflect.DeepEqual(snapshot.Removed, st.Removed) {
+			t.Errorf("snapshot managed %v and removed %v, want %v and %v", snapshot.Managed, snapshot.Removed, st.Managed, st.Removed)
+		}
+	})
+	t.Run("expired networks removed", func(t *testing.T) {
+		existing := []*container.CidrBlock{
+			{DisplayName: "home", CidrBlock: "203.0.113.2/32"},
+			{DisplayName: "home-prev1", CidrBlock: "203.0.113.1/32"},
+			{DisplayName: "ci-2", CidrBlock: "192.0.2.0/24"},
+			{DisplayName: "office", CidrBlock: "198.51.100.0/24"},
+		}
+		_, change := updater.Plan(existing, snapshot.entries(), snapshot.managed)
+		var removed []string
+		for _, c := range change.Removed {
+			removed = append(removed, c.DisplayName)
+		}
+		if want := []string{"home-prev1", "ci-2"}; !reflect.DeepEqual(removed, want) {
+			t.Errorf("removed %v, want %v", removed, want)
+		}
+	})
+}
+
+func TestStateOrphans(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		from     map[string]string
+		orphaned []string
+		managed  map[string]string
+		to       map[string]string
+		history  []string
+		orphans  []string
+		want     map[string]string
+	}{
+		{
+			name:    "entry gone with --orphans warn",
+			from:    map[string]string{"home": "203.0.113.1"},
+			to:      map[string]string{"office": "203.0.113.1"},
+			managed: map[string]string{"home": "home", "home-prev1": "home", "ci-1": "range:ci"},
+			orphans: []string{"home"},
+			want:    map[string]string{"ci-1": "range:ci"},
+		},
+		{
+			name:    "entry gone with --orphans remove",
+			args:    []string{"--orphans", "remove"},
+			from:    map[string]string{"home": "203.0.113.1"},
+			to:      map[string]string{"office": "203.0.113.1"},
+			managed: map[string]string{"home": "home"},
+			orphans: []string{"home"},
+			want:    map[string]string{"home": "home"},
+		},
+		{
+			name:    "entry renamed",
+			args:    []string{"--orphans", "rename", "--keep-ips", "1"},
+			from:    map[string]string{"home": "203.0.113.1"},
+			to:      map[string]string{"house": "203.0.113.2"},
+			history: []string{"house=203.0.113.1"},
+			orphans: []string{"home"},
+		},
+		{
+			name:     "orphan configured again",
+			from:     map[string]string{"office": "198.51.100.1"},
+			orphaned: []string{"home"},
+			to:       map[string]string{"home": "203.0.113.1", "office": "198.51.100.1"},
+			managed:  map[string]string{"home": "home"},
+			want:     map[string]string{"home": "home"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &state{IPs: tt.from, Orphans: tt.orphaned, Managed: tt.managed, app: newTestApp(t, tt.args...)}
+			st.update(copyIPs(tt.to))
+			if got := historyOf(st); !reflect.DeepEqual(got, tt.history) {
+				t.Errorf("history = %v, want %v", got, tt.history)
+			}
+			if !reflect.DeepEqual(st.Orphans, tt.orphans) {
+				t.Errorf("orphans = %v, want %v", st.Orphans, tt.orphans)
+			}
+			if (len(st.Managed) != 0 || len(tt.want) != 0) && !reflect.DeepEqual(st.Managed, tt.want) {
+				t.Errorf("managed = %v, want %v", st.Managed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//what the app is doing, served on --admin-addr
+type appStatus struct {
+	app        *App
+	mu         sync.Mutex
+	IPs        map[string]string `json:"ips"`
+	LastCheck  time.Time         `json:"lastCheck"`
+	LastUpdate time.Time         `json:"lastUpdate"`
+	LastError  string            `json:"lastError,omitempty"`
+	//whether the IPs of the last check still have to be applied to a cluster
+	Pending bool `json:"pending,omitempty"`
+	//the source of --credentials that worked last
+	Credentials string           `json:"credentials,omitempty"`
+	Operation   *operationStatus `json:"operation,omitempty"`
+	//the authorized networks of every cluster, by resource name
+	Networks map[string]networkComposition `json:"networks,omitempty"`
+	//the error of the last update of the clusters that failed, by resource name
+	Errors map[string]string `json:"errors,omitempty"`
+	//the notes left on the clusters with the note command, by resource name
+	Notes map[string]clusterNote `json:"notes,omitempty"`
+}
+
+//a GKE operation being waited on
+type operationStatus struct {
+	Name     string    `json:"name"`
+	Status   string    `json:"status"`
+	Started  time.Time `json:"started"`
+	Elapsed  string    `json:"elapsed"`
+	Estimate string    `json:"estimate,omitempty"`
+	//the reconcile that started it
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+//change the status while holding its lock
+func (s *appStatus) set(change func(s *appStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change(s)
+}
+
+//record the outcome of a check, keeping it in the cache directory for the prompt command
+func (s *appStatus) record(ips map[string]string, err error) {
+	s.set(func(s *appStatus) {
+		s.LastCheck = time.Now()
+		s.IPs = ips
+		s.LastError = ""
+		if err != nil {
+			s.LastError = err.Error()
+		}
+
+		if !s.app.NoState {
+			if data, err := json.Marshal(s); err == nil {
+				ioutil.WriteFile(s.app.cachePath("status.json"), data, 0600)
+			}
+		}
+	})
+}
+
+//record whether the IPs still have to be applied, written out with the next record
+func (s *appStatus) setPending(pending bool) {
+	s.set(func(s *appStatus) {
+		s.Pending = pending
+	})
+}
+
+//serve the status, which needs the --admin-token when there is one
+func (s *appStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.app.authorized(w, r, false) {
+		return
+	}
+	//notes are left by other processes
+	notes, err := s.app.loadNotes()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.Notes = notes
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+//serve the status on addr in the background, and the approvals when a coordinator takes the decisions
+func (a *App) serveStatus(addr string, approvals bool) {
+	mux := http.NewServeMux()
+	mux.Handle("/status", a.status)
+	mux.HandleFunc("/version", serveVersion)
+	mux.HandleFunc("/metrics", a.serveMetrics)
+	if approvals {
+		mux.HandleFunc("/approvals", a.serveApprovals)
+	}
+	if a.DebugEndpoints {
+		a.handleDebug(mux)
+	}
+
+	go func() {
+		log.Fatal(http.ListenAndServe(addr, mux))
+	}()
+}
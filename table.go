@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+//the rows of a listing, printed as a table or, with --output json or yaml, as the records behind them.
+//--filter and --sort pick and order the rows, --columns the columns of the table.
+type table struct {
+	columns []string
+	rows    []tableRow
+	//the times shown by the columns of times for people, which --sort orders by instead of the text
+	times map[int]func(record interface{}) time.Time
+}
+
+type tableRow struct {
+	cells  []string
+	record interface{}
+}
+
+func newTable(columns ...string) *table {
+	return &table{columns: columns}
+}
+
+//add a row, its cells in the order of the columns
+func (t *table) add(record interface{}, cells ...string) {
+	t.rows = append(t.rows, tableRow{cells: cells, record: record})
+}
+
+//declare a column showing the time of the records for people, so --sort orders it by the time itself
+func (t *table) timeColumn(name string, of func(record interface{}) time.Time) {
+	if t.times == nil {
+		t.times = map[int]func(record interface{}) time.Time{}
+	}
+	t.times[t.column(name)] = of
+}
+
+//the index of a column, named as in the header in any case, with - or _ for spaces
+func (t *table) column(name string) int {
+	header := strings.NewReplacer("-", " ", "_", " ").Replace(strings.ToUpper(strings.TrimSpace(name)))
+	for i, c := range t.columns {
+		if c == header {
+			return i
+		}
+	}
+	log.Fatalf("Unknown column %q, expected one of %s", name, strings.ToLower(strings.Join(t.columns, ", ")))
+	return -1
+}
+
+//--filter flags : column=value, column!=value or column~text for the values containing text, all of them have to match
+type filterFlags []string
+
+func (f *filterFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *filterFlags) Set(value string) error {
+	if _, _, _, err := parseFilter(value); err != nil {
+		return err
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+func parseFilter(spec string) (string, string, string, error) {
+	i := strings.IndexAny(spec, "!=~")
+	if i <= 0 || spec[i] == '!' && !strings.HasPrefix(spec[i:], "!=") {
+		return "", "", "", fmt.Errorf("expected column=value, column!=value or column~text, got %q", spec)
+	}
+	op := spec[i : i+1]
+	if op == "!" {
+		op = "!="
+	}
+	return spec[:i], op, spec[i+len(op):], nil
+}
+
+//whether a row matches every --filter
+func (a *App) matches(t *table, r tableRow) bool {
+	for _, spec := range a.Filters {
+		column, op, value, _ := parseFilter(spec)
+		cell := r.cells[t.column(column)]
+		switch {
+		case op == "=" && !strings.EqualFold(cell, value),
+			op == "!=" && strings.EqualFold(cell, value),
+			op == "~" && !strings.Contains(strings.ToLower(cell), strings.ToLower(value)):
+			return false
+		}
+	}
+	return true
+}
+
+//order the rows by --sort, a column prefixed with - for the descending order. Numbers sort as numbers, times as times.
+func (a *App) sortRows(t *table, rows []tableRow) {
+	if a.SortBy == "" {
+		return
+	}
+	name, descending := strings.TrimPrefix(a.SortBy, "-"), strings.HasPrefix(a.SortBy, "-")
+	i := t.column(name)
+	sort.SliceStable(rows, func(x, y int) bool {
+		if descending {
+			x, y = y, x
+		}
+		if of, ok := t.times[i]; ok {
+			return of(rows[x].record).Before(of(rows[y].record))
+		}
+		l, r := rows[x].cells[i], rows[y].cells[i]
+		lf, lErr := strconv.ParseFloat(l, 64)
+		rf, rErr := strconv.ParseFloat(r, 64)
+		if lErr == nil && rErr == nil {
+			return lf < rf
+		}
+		return l < r
+	})
+}
+
+//print the rows matching --filter in the order of --sort, as a table of --columns or as JSON or YAML records.
+//empty is printed instead of an empty table.
+func (a *App) printTable(t *table, empty string) {
+	var rows []tableRow
+	for _, r := range t.rows {
+		if a.matches(t, r) {
+			rows = append(rows, r)
+		}
+	}
+	a.sortRows(t, rows)
+
+	records := []interface{}{}
+	for _, r := range rows {
+		records = append(records, r.record)
+	}
+	if a.printStructured(records) {
+		return
+	}
+
+	if len(rows) == 0 {
+		fmt.Println(empty)
+		return
+	}
+	columns := make([]int, len(t.columns))
+	for i := range columns {
+		columns[i] = i
+	}
+	if a.Columns != "" {
+		columns = nil
+		for _, name := range strings.Split(a.Columns, ",") {
+			columns = append(columns, t.column(name))
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	line := func(values []string) {
+		var cells []string
+		for _, i := range columns {
+			cells = append(cells, values[i])
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	line(t.columns)
+	for _, r := range rows {
+		line(r.cells)
+	}
+	w.Flush()
+}
+
+//check --output : table (or text), json or yaml
+func (a *App) validateOutput() {
+	switch a.OutputFormat {
+	case "text", "table", "json", "yaml":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %q, expected table, json or yaml\n", a.OutputFormat)
+		os.Exit(2)
+	}
+}
+
+//print a result with --output json or yaml, the YAML keys being the JSON ones. Reports whether it did.
+func (a *App) printStructured(v interface{}) bool {
+	switch a.OutputFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+	case "yaml":
+		data, err := json.Marshal(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var generic interface{}
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			log.Fatal(err)
+		}
+		if data, err = yaml.Marshal(generic); err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(data)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		spec              string
+		column, op, value string
+		err               bool
+	}{
+		{spec: "cluster=prod", column: "cluster", op: "=", value: "prod"},
+		{spec: "cluster!=prod", column: "cluster", op: "!=", value: "prod"},
+		{spec: "name~home", column: "name", op: "~", value: "home"},
+		{spec: "name=", column: "name", op: "=", value: ""},
+		{spec: "name=a=b", column: "name", op: "=", value: "a=b"},
+		{spec: "=prod", err: true},
+		{spec: "prod", err: true},
+		{spec: "name!prod", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			column, op, value, err := parseFilter(tt.spec)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if column != tt.column || op != tt.op || value != tt.value {
+				t.Errorf("got %q %q %q, want %q %q %q", column, op, value, tt.column, tt.op, tt.value)
+			}
+		})
+	}
+}
+
+func TestFilterAndSortRows(t *testing.T) {
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	type record struct {
+		name string
+		at   time.Time
+	}
+	newRows := func() *table {
+		tbl := newTable("NAME", "CLUSTER", "CHANGES", "WHEN")
+		tbl.add(record{"home", day.Add(2 * time.Hour)}, "home", "prod", "10", "2 hours ago")
+		tbl.add(record{"office", day}, "office", "staging", "9", "4 hours ago")
+		tbl.add(record{"home-lte", day.Add(time.Hour)}, "home-lte", "prod", "100", "3 hours ago")
+		tbl.timeColumn("when", func(r interface{}) time.Time {
+			return r.(record).at
+		})
+		return tbl
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		names []string
+	}{
+		{name: "unsorted", names: []string{"home", "office", "home-lte"}},
+		{name: "filter equal, ignoring case", args: []string{"--filter", "cluster=PROD"}, names: []string{"home", "home-lte"}},
+		{name: "filter different", args: []string{"--filter", "cluster!=prod"}, names: []string{"office"}},
+		{name: "filter containing", args: []string{"--filter", "name~HOME"}, names: []string{"home", "home-lte"}},
+		{name: "filters all matching", args: []string{"--filter", "name~home", "--filter", "changes=100"}, names: []string{"home-lte"}},
+		{name: "numbers sorted as numbers", args: []string{"--sort", "changes"}, names: []string{"office", "home", "home-lte"}},
+		{name: "descending", args: []string{"--sort", "-changes"}, names: []string{"home-lte", "home", "office"}},
+		{name: "text", args: []string{"--sort", "cluster"}, names: []string{"home", "home-lte", "office"}},
+		{name: "times sorted as times", args: []string{"--sort", "when"}, names: []string{"office", "home-lte", "home"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t, tt.args...)
+			tbl := newRows()
+			var rows []tableRow
+			for _, r := range tbl.rows {
+				if a.matches(tbl, r) {
+					rows = append(rows, r)
+				}
+			}
+			a.sortRows(tbl, rows)
+
+			var names []string
+			for _, r := range rows {
+				names = append(names, r.record.(record).name)
+			}
+			if !reflect.DeepEqual(names, tt.names) {
+				t.Errorf("got %v, want %v", names, tt.names)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+//notification templates given with --notify-template and the per-notifier flags, parsed once
+type notifierTemplates struct {
+	once   sync.Once
+	byKind map[string]*template.Template
+	err    error
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+//the template of a kind of notifier (webhook, slack or mqtt), falling back to --notify-template. nil when there is none.
+func (a *App) notifierTemplate(kind string) (*template.Template, error) {
+	a.templates.once.Do(func() {
+		a.templates.byKind = map[string]*template.Template{}
+		for kind, text := range map[string]string{"": a.NotifyTemplate, "webhook": a.WebhookTemplate, "slack": a.SlackTemplate, "mqtt": a.MQTTTemplate} {
+			if text == "" {
+				continue
+			}
+			t, err := parseTemplate(kind, text)
+			if err != nil {
+				a.templates.err = err
+				return
+			}
+			a.templates.byKind[kind] = t
+		}
+	})
+	if a.templates.err != nil {
+		return nil, a.templates.err
+	}
+
+	if t, ok := a.templates.byKind[kind]; ok {
+		return t, nil
+	}
+	return a.templates.byKind[""], nil
+}
+
+//parse the templates and render them once with a sample event, so a typo or an unknown field stops the app at
+//startup instead of failing every notification
+func (a *App) validateTemplates() error {
+	sample := event{
+		Level: "info", Message: "sample", Host: "host", Owner: "owner", Time: time.Now(),
+		OldIPs: []string{"198.51.100.4"}, NewIPs: []string{"203.0.113.7"}, Clusters: []string{"cluster"},
+		Duration: "1m0s", Error: "error", SmokeTest: &smokeResult{}, CorrelationID: "0123abcd",
+	}
+	for _, kind := range []string{"", "webhook", "slack", "mqtt"} {
+		t, err := a.notifierTemplate(kind)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			continue
+		}
+		if err := t.Execute(ioutil.Discard, sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//parse a template given inline, or read from a file when it starts with @
+func parseTemplate(name, text string) (*template.Template, error) {
+	if strings.HasPrefix(text, "@") {
+		data, err := ioutil.ReadFile(text[1:])
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+//render the event with the template of a kind of notifier. ok is false when there is no template.
+func (a *App) renderEvent(kind string, e event) (rendered []byte, ok bool, err error) {
+	t, err := a.notifierTemplate(kind)
+	if err != nil || t == nil {
+		return nil, false, err
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, e); err != nil {
+		return nil, false, err
+	}
+	return b.Bytes(), true, nil
+}
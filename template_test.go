@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRenderEvent(t *testing.T) {
+	f, err := ioutil.TempFile("", "template-*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("from file {{.Level}}")
+	f.Close()
+
+	e := event{Level: "warning", Message: `quoted "text"`, NewIPs: []string{"203.0.113.7", "198.51.100.4"}}
+	tests := []struct {
+		name     string
+		args     []string
+		kind     string
+		rendered string
+		none     bool
+	}{
+		{name: "no template", kind: "webhook", none: true},
+		{name: "shared template", args: []string{"--notify-template", "{{.Level}}: {{join .NewIPs \", \"}}"}, kind: "slack", rendered: "warning: 203.0.113.7, 198.51.100.4"},
+		{name: "template of the kind wins", args: []string{"--notify-template", "{{.Level}}", "--notify-template-mqtt", "mqtt {{.Message}}"}, kind: "mqtt", rendered: `mqtt quoted "text"`},
+		{name: "other kinds keep the shared one", args: []string{"--notify-template", "{{.Level}}", "--notify-template-mqtt", "mqtt"}, kind: "webhook", rendered: "warning"},
+		{name: "json escapes the values", args: []string{"--notify-template-webhook", `{"text": {{json .Message}}}`}, kind: "webhook", rendered: `{"text": "quoted \"text\""}`},
+		{name: "read from a file", args: []string{"--notify-template", "@" + f.Name()}, kind: "slack", rendered: "from file warning"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t, tt.args...)
+			if err := a.validateTemplates(); err != nil {
+				t.Fatal(err)
+			}
+			rendered, ok, err := a.renderEvent(tt.kind, e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok == tt.none {
+				t.Fatalf("got rendered %v, want %v", ok, !tt.none)
+			}
+			if string(rendered) != tt.rendered {
+				t.Errorf("got %q, want %q", rendered, tt.rendered)
+			}
+		})
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "syntax error", args: []string{"--notify-template", "{{.Level"}},
+		{name: "unknown field", args: []string{"--notify-template-slack", "{{.Severity}}"}},
+		{name: "unknown function", args: []string{"--notify-template", "{{upper .Level}}"}},
+		{name: "missing file", args: []string{"--notify-template-webhook", "@/nonexistent/template"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := newTestApp(t, tt.args...).validateTemplates(); err == nil {
+				t.Error("template accepted")
+			}
+		})
+	}
+}
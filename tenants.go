@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//a user of a shared host whose entries are managed by the daemon, read from <--users-dir>/<user>.conf.
+//Every line of the file is a link given as name=source, authorized under the entry <user>-<name>.
+type tenant struct {
+	user  string
+	links linkFlags
+}
+
+//read the users of --users-dir, returning the problems found with their files.
+//A file is only used if it is owned by its user or by root.
+func (a *App) loadTenants() ([]tenant, []error) {
+	if a.UsersDir == "" {
+		return nil, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(a.UsersDir, "*.conf"))
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var tenants []tenant
+	var errs []error
+	for _, path := range paths {
+		t := tenant{user: strings.TrimSuffix(filepath.Base(path), ".conf")}
+		owner, err := fileOwner(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if owner != "" && owner != t.user && owner != "root" {
+			errs = append(errs, fmt.Errorf("ignoring %s, it is owned by %s", path, owner))
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if err := t.links.Set(line); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d : %s", path, n, err.Error()))
+			}
+		}
+		f.Close()
+
+		tenants = append(tenants, t)
+	}
+
+	return tenants, errs
+}
+
+//display name of the entry of a link of the user
+func (t tenant) entryName(l link) string {
+	return t.user + "-" + l.name
+}
+
+//the user whose entry or previous IP has the display name, "" for the entries of the daemon itself
+func entryOwner(tenants []tenant, displayName string) string {
+	owner := ""
+	for _, t := range tenants {
+		if strings.HasPrefix(displayName, t.user+"-") && len(t.user) > len(owner) {
+			owner = t.user
+		}
+	}
+	return owner
+}
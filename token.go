@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"gke-ip-update/updater"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/container/v1"
+)
+
+//keeps access tokens in an encrypted file so restarts don't have to fetch a new one
+type cachedTokenSource struct {
+	app  *App
+	base oauth2.TokenSource
+	path string
+	key  string
+}
+
+//how long before its expiry a cached token stops being used
+const tokenExpiryMargin = time.Minute
+
+func (c *cachedTokenSource) Token() (*oauth2.Token, error) {
+	if t, err := c.load(); err == nil && t.Expiry.After(time.Now().Add(tokenExpiryMargin)) {
+		return t, nil
+	}
+
+	t, err := c.base.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.save(t); err != nil {
+		c.app.writeLog(fmt.Sprintf("Unable to cache the access token : %s \n", err.Error()))
+	}
+	return t, nil
+}
+
+func (c *cachedTokenSource) load() (*oauth2.Token, error) {
+	sealed, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := c.cipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("token cache is truncated")
+	}
+
+	data, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &oauth2.Token{}
+	return t, json.Unmarshal(data, t)
+}
+
+func (c *cachedTokenSource) save(t *oauth2.Token) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := c.cipher()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.path, gcm.Seal(nonce, nonce, data, nil), 0600)
+}
+
+//AES-GCM with a random key created next to the state on first use
+func (c *cachedTokenSource) cipher() (cipher.AEAD, error) {
+	key, err := ioutil.ReadFile(c.key)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(c.key, key, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//token source shared by every API call of the process, trying the --credentials in order when given.
+//Cached on disk unless --token-cache=false.
+func (a *App) sharedTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	a.tokenSourceOnce.Do(func() {
+		var base oauth2.TokenSource
+		account := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		if len(a.Credentials) > 0 {
+			base, account = a.newChainTokenSource(ctx), a.Credentials.String()
+		} else {
+			var err error
+			if base, err = google.DefaultTokenSource(a.tokenContext(ctx), container.CloudPlatformScope); err != nil {
+				a.tokenSourceErr = err
+				return
+			}
+		}
+
+		if a.TokenCache && !a.NoState {
+			//one cache per credentials file so switching accounts doesn't reuse the other account's token
+			sum := sha256.Sum256([]byte(account))
+			path := a.cachePath(fmt.Sprintf("token-%x", sum[:6]))
+			base = &cachedTokenSource{app: a, base: base, path: path, key: a.statePath("token.key")}
+		}
+		a.tokenSource = oauth2.ReuseTokenSource(nil, base)
+	})
+
+	return a.tokenSource, a.tokenSourceErr
+}
+
+//GKE API client authenticated with the shared token source, calling the endpoint --api-endpoint pins the cluster to
+func (a *App) newContainerService(ctx context.Context, cluster updater.Cluster) (*container.Service, error) {
+	ts, err := a.sharedTokenSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	containerService, err := container.New(oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, a.httpClient(googleAPIs)), ts))
+	if err != nil {
+		return nil, err
+	}
+
+	containerService.UserAgent = a.userAgent()
+	if endpoint := a.containerEndpoint("", cluster); endpoint != "" {
+		containerService.BasePath = endpoint
+	}
+	return containerService, nil
+}
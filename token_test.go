@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+//a token source handing out numbered tokens
+type countingSource struct {
+	calls  int
+	expiry time.Duration
+}
+
+func (s *countingSource) Token() (*oauth2.Token, error) {
+	s.calls++
+	return &oauth2.Token{AccessToken: fmt.Sprintf("token-%d", s.calls), Expiry: time.Now().Add(s.expiry)}, nil
+}
+
+func TestCachedTokenSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry time.Duration
+		tamper func(t *testing.T, c *cachedTokenSource)
+		calls  int
+	}{
+		{name: "cached token reused", expiry: time.Hour, calls: 1},
+		{name: "token expiring refreshed", expiry: tokenExpiryMargin / 2, calls: 2},
+		{
+			name:   "tampered cache refreshed",
+			expiry: time.Hour,
+			tamper: func(t *testing.T, c *cachedTokenSource) {
+				sealed, err := ioutil.ReadFile(c.path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sealed[len(sealed)-1] ^= 1
+				writeFile(t, c.path, string(sealed))
+			},
+			calls: 2,
+		},
+		{
+			name:   "truncated cache refreshed",
+			expiry: time.Hour,
+			tamper: func(t *testing.T, c *cachedTokenSource) {
+				writeFile(t, c.path, "abc")
+			},
+			calls: 2,
+		},
+		{
+			name:   "other key refreshed",
+			expiry: time.Hour,
+			tamper: func(t *testing.T, c *cachedTokenSource) {
+				writeFile(t, c.key, string(bytes.Repeat([]byte{1}, 32)))
+			},
+			calls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newStateApp(t)
+			base := &countingSource{expiry: tt.expiry}
+			c := &cachedTokenSource{app: a, base: base, path: a.statePath("token"), key: a.statePath("token.key")}
+
+			first, err := c.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sealed, err := ioutil.ReadFile(c.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(sealed, []byte(first.AccessToken)) {
+				t.Error("token cached in clear")
+			}
+			if tt.tamper != nil {
+				tt.tamper(t, c)
+			}
+
+			second, err := c.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if base.calls != tt.calls {
+				t.Errorf("got %d tokens fetched, want %d", base.calls, tt.calls)
+			}
+			if tt.calls == 1 && second.AccessToken != first.AccessToken {
+				t.Errorf("got token %q, want the cached %q", second.AccessToken, first.AccessToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+//an event of netifd as printed by `ubus listen network.interface`
+type ubusEvent struct {
+	Interface struct {
+		Action    string `json:"action"`
+		Interface string `json:"interface"`
+	} `json:"network.interface"`
+}
+
+//trigger a check when netifd brings --ubus-interface up or updates it on an OpenWrt router, so a new WAN IP is
+//authorized right away. `ubus listen` is restarted a minute after it stops.
+func (a *App) watchUbus(ctx context.Context, trigger chan<- struct{}) {
+	for {
+		err := a.listenUbus(ctx, trigger)
+		if ctx.Err() != nil {
+			return
+		}
+		a.writeLog(fmt.Sprintf("Unable to listen to the ubus events : %s \n", err.Error()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+}
+
+func (a *App) listenUbus(ctx context.Context, trigger chan<- struct{}) error {
+	cmd := exec.CommandContext(ctx, "ubus", "listen", "network.interface")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	a.writeLog(fmt.Sprintf("Listening to the ubus events of %s \n", a.UbusInterface))
+
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var e ubusEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Interface.Interface != a.UbusInterface {
+			continue
+		}
+		switch e.Interface.Action {
+		case "ifup", "ifupdate":
+			a.writeLog(fmt.Sprintf("%s of %s, checking the IPs \n", e.Interface.Action, a.UbusInterface))
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+	return errors.New("ubus listen stopped")
+}
@@ -0,0 +1,80 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const storageAPI = "https://storage.googleapis.com"
+
+//GCSStore keeps the last authorized IP in a Cloud Storage object so stateless deployments can share it
+type GCSStore struct {
+	Client    *http.Client
+	Bucket    string
+	Object    string
+	UserAgent string
+}
+
+//GetIP reads the saved IP, returning an empty string if nothing has been saved yet
+func (s *GCSStore) GetIP(ctx context.Context) (string, error) {
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", storageAPI, url.PathEscape(s.Bucket), url.PathEscape(s.Object))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if s.UserAgent != "" {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reading gs://%s/%s : %s", s.Bucket, s.Object, resp.Status)
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+//SaveIP overwrites the saved IP
+func (s *GCSStore) SaveIP(ctx context.Context, ip string) error {
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", storageAPI, url.PathEscape(s.Bucket), url.QueryEscape(s.Object))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewBufferString(ip))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	if s.UserAgent != "" {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("writing gs://%s/%s : %s", s.Bucket, s.Object, resp.Status)
+	}
+
+	return nil
+}
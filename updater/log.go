@@ -0,0 +1,61 @@
+package updater
+
+import (
+	"context"
+	"sync"
+)
+
+//Logger receives the messages of the package about what it does to the clusters. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+//messages are discarded until SetLogger is called. Updates running in other goroutines read it while it's set.
+var (
+	loggerMu sync.RWMutex
+	logger   Logger = discard{}
+)
+
+//SetLogger sends the messages of the package to l, so applications embedding it control where they go.
+//A nil l discards them.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = discard{}
+	}
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+//the logger set by SetLogger
+func currentLogger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+type correlationKey struct{}
+
+//WithCorrelationID returns a context whose updates log their messages with id, so the ones of a reconcile
+//can be told apart from the others when several run at once.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+//CorrelationID returns the id set by WithCorrelationID, "" when there is none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+//log a message, prefixed by the correlation ID of ctx
+func logf(ctx context.Context, format string, v ...interface{}) {
+	if id := CorrelationID(ctx); id != "" {
+		format = "[" + id + "] " + format
+	}
+	currentLogger().Printf(format, v...)
+}
+
+type discard struct{}
+
+func (discard) Printf(format string, v ...interface{}) {}
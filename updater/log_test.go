@@ -0,0 +1,53 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *recorder) Printf(format string, v ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, fmt.Sprintf(format, v...))
+}
+
+//the logger is set while updates log, which go test -race checks
+func TestSetLogger(t *testing.T) {
+	defer SetLogger(nil)
+
+	ctx := WithCorrelationID(context.Background(), "abc")
+	r := &recorder{}
+	t.Run("set while updates log", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					logf(ctx, "update %d", j)
+				}
+			}()
+		}
+		for i := 0; i < 10; i++ {
+			SetLogger(r)
+			SetLogger(nil)
+		}
+		wg.Wait()
+	})
+	t.Run("prefixed by the correlation ID", func(t *testing.T) {
+		SetLogger(r)
+		logf(ctx, "cluster %s updated", "prod")
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if got := r.lines[len(r.lines)-1]; got != "[abc] cluster prod updated" {
+			t.Errorf("got %q, want the message prefixed by the correlation ID", got)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package updater
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"google.golang.org/api/container/v1"
+)
+
+type exclusionsKey struct{}
+
+//WithMaintenanceExclusions returns a context whose updates leave a cluster alone while one of its maintenance
+//exclusions is active, returning a *NotRunningError like for a cluster that isn't RUNNING. The IPs then aren't
+//authorized before the exclusion ends.
+func WithMaintenanceExclusions(ctx context.Context) context.Context {
+	return context.WithValue(ctx, exclusionsKey{}, true)
+}
+
+//check whether the updates of ctx honor the maintenance exclusions
+func honorsExclusions(ctx context.Context) bool {
+	honored, _ := ctx.Value(exclusionsKey{}).(bool)
+	return honored
+}
+
+//ActiveExclusion returns the name and the end of the maintenance exclusion of c active at now, the one ending last
+//when several overlap. name is "" when there is none. Exclusions whose times can't be parsed are ignored.
+func ActiveExclusion(c *container.Cluster, now time.Time) (name string, end time.Time) {
+	if c.MaintenancePolicy == nil || c.MaintenancePolicy.Window == nil {
+		return "", time.Time{}
+	}
+
+	names := make([]string, 0, len(c.MaintenancePolicy.Window.MaintenanceExclusions))
+	for n := range c.MaintenancePolicy.Window.MaintenanceExclusions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		w := c.MaintenancePolicy.Window.MaintenanceExclusions[n]
+		start, err := time.Parse(time.RFC3339, w.StartTime)
+		if err != nil {
+			continue
+		}
+		until, err := time.Parse(time.RFC3339, w.EndTime)
+		if err != nil {
+			continue
+		}
+		if !now.Before(start) && now.Before(until) && until.After(end) {
+			name, end = n, until
+		}
+	}
+	return name, end
+}
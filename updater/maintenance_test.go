@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/api/container/v1"
+)
+
+func TestActiveExclusion(t *testing.T) {
+	now := time.Date(2026, 12, 24, 12, 0, 0, 0, time.UTC)
+	window := func(start, end string) container.TimeWindow {
+		return container.TimeWindow{StartTime: start, EndTime: end}
+	}
+	tests := []struct {
+		name       string
+		exclusions map[string]container.TimeWindow
+		exclusion  string
+		end        string
+	}{
+		{name: "no exclusion"},
+		{
+			name:       "active",
+			exclusions: map[string]container.TimeWindow{"holidays": window("2026-12-20T00:00:00Z", "2027-01-02T00:00:00Z")},
+			exclusion:  "holidays",
+			end:        "2027-01-02T00:00:00Z",
+		},
+		{
+			name:       "ended",
+			exclusions: map[string]container.TimeWindow{"black-friday": window("2026-11-27T00:00:00Z", "2026-11-30T00:00:00Z")},
+		},
+		{
+			name:       "not started",
+			exclusions: map[string]container.TimeWindow{"new-year": window("2026-12-31T00:00:00Z", "2027-01-02T00:00:00Z")},
+		},
+		{
+			name: "overlapping, the one ending last",
+			exclusions: map[string]container.TimeWindow{
+				"holidays": window("2026-12-20T00:00:00Z", "2027-01-02T00:00:00Z"),
+				"release":  window("2026-12-23T00:00:00Z", "2026-12-26T00:00:00Z"),
+			},
+			exclusion: "holidays",
+			end:       "2027-01-02T00:00:00Z",
+		},
+		{
+			name:       "unparsable times ignored",
+			exclusions: map[string]container.TimeWindow{"broken": window("soon", "2027-01-02T00:00:00Z")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &container.Cluster{}
+			if tt.exclusions != nil {
+				c.MaintenancePolicy = &container.MaintenancePolicy{Window: &container.MaintenanceWindow{MaintenanceExclusions: tt.exclusions}}
+			}
+			name, end := ActiveExclusion(c, now)
+			if name != tt.exclusion {
+				t.Errorf("got exclusion %q, want %q", name, tt.exclusion)
+			}
+			if tt.end != "" && end.Format(time.RFC3339) != tt.end {
+				t.Errorf("got end %s, want %s", end.Format(time.RFC3339), tt.end)
+			}
+		})
+	}
+}
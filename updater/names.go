@@ -0,0 +1,69 @@
+package updater
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+//ParseCluster reads a cluster given as a plain name, a full resource name
+//(projects/p/locations/l/clusters/c or projects/p/zones/z/clusters/c),
+//a self-link (https://container.googleapis.com/v1/projects/...) or a Cloud Console URL.
+//Fields that a plain name doesn't carry are left empty.
+func ParseCluster(s string) (Cluster, error) {
+	s = strings.TrimSpace(s)
+
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		if strings.HasSuffix(u.Host, "console.cloud.google.com") {
+			return parseConsoleURL(u)
+		}
+		s = u.Path
+	}
+
+	s = strings.Trim(s, "/")
+	parts := strings.Split(s, "/")
+	for i, p := range parts {
+		if p == "projects" {
+			parts = parts[i:]
+			break
+		}
+	}
+
+	if len(parts) == 1 {
+		return Cluster{Name: parts[0]}, nil
+	}
+
+	if len(parts) == 6 && parts[0] == "projects" && (parts[2] == "locations" || parts[2] == "zones") && parts[4] == "clusters" {
+		return Cluster{Project: parts[1], Zone: parts[3], Name: parts[5]}, nil
+	}
+
+	return Cluster{}, fmt.Errorf("can't read a cluster from %q", s)
+}
+
+//console URLs look like https://console.cloud.google.com/kubernetes/clusters/details/<location>/<name>/details?project=<project>
+func parseConsoleURL(u *url.URL) (Cluster, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+3 < len(parts); i++ {
+		if parts[i] == "clusters" && parts[i+1] == "details" {
+			return Cluster{Project: u.Query().Get("project"), Zone: parts[i+2], Name: parts[i+3]}, nil
+		}
+	}
+
+	return Cluster{}, fmt.Errorf("can't read a cluster from %q", u.String())
+}
+
+//ParseProject reads a project given as an ID, a number or a resource name (projects/p)
+func ParseProject(s string) string {
+	s = strings.Trim(strings.TrimSpace(s), "/")
+	return strings.TrimPrefix(s, "projects/")
+}
+
+//ParseContext reads the cluster of a kubeconfig context created by gcloud, named gke_<project>_<location>_<cluster>
+func ParseContext(name string) (Cluster, error) {
+	parts := strings.Split(name, "_")
+	if len(parts) != 4 || parts[0] != "gke" || parts[1] == "" || parts[2] == "" || parts[3] == "" {
+		return Cluster{}, fmt.Errorf("%q isn't the context of a GKE cluster", name)
+	}
+
+	return Cluster{Project: parts[1], Zone: parts[2], Name: parts[3]}, nil
+}
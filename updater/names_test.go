@@ -0,0 +1,58 @@
+package updater
+
+import "testing"
+
+func TestParseCluster(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Cluster
+		wantErr bool
+	}{
+		{in: "prod", want: Cluster{Name: "prod"}},
+		{in: " prod ", want: Cluster{Name: "prod"}},
+		{in: "projects/p/locations/europe-west1/clusters/prod", want: Cluster{Project: "p", Zone: "europe-west1", Name: "prod"}},
+		{in: "projects/p/zones/europe-west1-b/clusters/prod", want: Cluster{Project: "p", Zone: "europe-west1-b", Name: "prod"}},
+		{in: "/projects/p/locations/europe-west1/clusters/prod/", want: Cluster{Project: "p", Zone: "europe-west1", Name: "prod"}},
+		{in: "https://container.googleapis.com/v1/projects/p/zones/europe-west1-b/clusters/prod", want: Cluster{Project: "p", Zone: "europe-west1-b", Name: "prod"}},
+		{in: "https://console.cloud.google.com/kubernetes/clusters/details/europe-west1/prod/details?project=p", want: Cluster{Project: "p", Zone: "europe-west1", Name: "prod"}},
+		{in: "projects/p/clusters/prod", wantErr: true},
+		{in: "projects/p/locations/europe-west1/nodePools/prod", wantErr: true},
+		{in: "https://console.cloud.google.com/kubernetes/list", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseCluster(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCluster(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCluster(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Cluster
+		wantErr bool
+	}{
+		{in: "gke_p_europe-west1_prod", want: Cluster{Project: "p", Zone: "europe-west1", Name: "prod"}},
+		{in: "minikube", wantErr: true},
+		{in: "gke_p__prod", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseContext(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseContext(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseContext(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/container/v1"
+)
+
+//how often a running operation is polled
+var pollInterval = 5 * time.Second
+
+//WaitOperation polls the operation until it's done, calling progress after every poll
+func WaitOperation(ctx context.Context, containerService *container.Service, cluster Cluster, op *container.Operation, progress func(op *container.Operation, elapsed time.Duration)) error {
+	start := time.Now()
+	for op.Status != "DONE" {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+
+		current, err := containerService.Projects.Locations.Operations.Get(fmt.Sprintf("projects/%s/locations/%s/operations/%s", cluster.Project, cluster.Zone, op.Name)).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		op = current
+
+		if progress != nil {
+			progress(op, time.Since(start))
+		}
+	}
+
+	if op.StatusMessage != "" {
+		logf(ctx, "Operation %s failed after %s : %s", op.Name, time.Since(start).Round(time.Second), op.StatusMessage)
+		return fmt.Errorf("operation %s failed : %s", op.Name, op.StatusMessage)
+	}
+
+	logf(ctx, "Operation %s done after %s", op.Name, time.Since(start).Round(time.Second))
+	return nil
+}
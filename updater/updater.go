@@ -0,0 +1,388 @@
+//Package updater keeps an IP address authorized in the master authorized networks of a GKE cluster.
+//
+//Every function calling an API takes a context and stops when it's cancelled or its deadline passes. Functions that
+//only compute something, like Plan or ParseCluster, don't.
+package updater
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/googleapi"
+)
+
+//Cluster identifies the GKE cluster to update
+type Cluster struct {
+	Project string
+	//zone of a zonal cluster or region of a regional one
+	Zone string
+	Name string
+}
+
+//ResourceName is the name of the cluster in the projects.locations API, projects/<project>/locations/<location>/clusters/<name>
+func (c Cluster) ResourceName() string {
+	return fmt.Sprintf("projects/%s/locations/%s/clusters/%s", c.Project, c.Zone, c.Name)
+}
+
+//NewService creates a GKE API client using the application default credentials.
+//ctx is kept to fetch access tokens, it must live as long as the client and not carry a short deadline.
+//Bound the calls made with the client with their own contexts instead.
+func NewService(ctx context.Context) (*container.Service, error) {
+	c, err := google.DefaultClient(ctx, container.CloudPlatformScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return container.New(c)
+}
+
+//NotRunningError is returned instead of updating a cluster that is provisioning, reconciling or broken,
+//or in a maintenance exclusion when they are honored
+type NotRunningError struct {
+	Cluster string
+	Status  string
+	Message string
+	//the active maintenance exclusion and its end, see WithMaintenanceExclusions
+	Exclusion string
+	Until     time.Time
+}
+
+func (e *NotRunningError) Error() string {
+	if e.Exclusion != "" {
+		return fmt.Sprintf("cluster %s is in the maintenance exclusion %s until %s", e.Cluster, e.Exclusion, e.Until.Format(time.RFC3339))
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("cluster %s is %s (%s)", e.Cluster, e.Status, e.Message)
+	}
+	return fmt.Sprintf("cluster %s is %s", e.Cluster, e.Status)
+}
+
+//Change describes what was done to the master authorized networks of a cluster
+type Change struct {
+	Added   []*container.CidrBlock
+	Removed []*container.CidrBlock
+	//networks of the cluster that are left as they are
+	Kept []*container.CidrBlock
+	//the update operation, nil when the cluster was already up to date
+	Operation *container.Operation
+	//networks the cluster takes at most, see NetworkLimit
+	Limit int
+}
+
+//MaxAuthorizedNetworks is the number of authorized networks a cluster takes, PrivateEndpointMaxAuthorizedNetworks the
+//one of a cluster whose master only has a private endpoint
+const (
+	MaxAuthorizedNetworks                = 50
+	PrivateEndpointMaxAuthorizedNetworks = 100
+)
+
+//NetworkLimit tells how many authorized networks the cluster takes
+func NetworkLimit(c *container.Cluster) int {
+	if c.PrivateClusterConfig != nil && c.PrivateClusterConfig.EnablePrivateEndpoint {
+		return PrivateEndpointMaxAuthorizedNetworks
+	}
+	return MaxAuthorizedNetworks
+}
+
+//Action tells what was done: noop when nothing changed, added when networks were only added, updated otherwise
+func (c *Change) Action() string {
+	switch {
+	case c.Operation == nil:
+		return "noop"
+	case len(c.Removed) == 0:
+		return "added"
+	default:
+		return "updated"
+	}
+}
+
+//Target is a cluster and the entry kept authorized in it
+type Target struct {
+	Service     *container.Service
+	Cluster     Cluster
+	DisplayName string
+}
+
+//Result describes what EnsureAuthorized did to the entry
+type Result struct {
+	//noop, added or updated, see Change.Action
+	Action string `json:"action"`
+	//the CIDR the entry had before, empty when it was added or left alone
+	PreviousCIDR string `json:"previousCidr,omitempty"`
+	NewCIDR      string `json:"newCidr"`
+	//name of the update operation, empty when nothing changed
+	Operation string        `json:"operation,omitempty"`
+	Duration  time.Duration `json:"duration"`
+}
+
+//Summarize describes what a change did to the entry displayName
+func Summarize(change *Change, displayName, ip string) *Result {
+	res := &Result{Action: change.Action(), NewCIDR: fmt.Sprintf("%s/32", ip)}
+	for _, b := range change.Removed {
+		if b.DisplayName == displayName {
+			res.PreviousCIDR = b.CidrBlock
+		}
+	}
+	if change.Operation != nil {
+		res.Operation = change.Operation.Name
+	}
+	return res
+}
+
+//EnsureAuthorized makes sure ip is authorized under the display name of the target, waiting for the update to finish
+func EnsureAuthorized(ctx context.Context, target Target, ip string) (*Result, error) {
+	started := time.Now()
+	change, err := SetIP(ctx, target.Service, target.Cluster, ip, target.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+
+	res := Summarize(change, target.DisplayName, ip)
+	if change.Operation != nil {
+		if err := WaitOperation(ctx, target.Service, target.Cluster, change.Operation, nil); err != nil {
+			return res, err
+		}
+	}
+	res.Duration = time.Since(started)
+	return res, nil
+}
+
+//SetIP makes sure ip is authorized under displayName
+func SetIP(ctx context.Context, containerService *container.Service, cluster Cluster, ip, displayName string) (*Change, error) {
+	cidrBlock := &container.CidrBlock{
+		CidrBlock:   fmt.Sprintf("%s/32", ip),
+		DisplayName: displayName,
+	}
+
+	return SetEntries(ctx, containerService, cluster, []*container.CidrBlock{cidrBlock}, func(name string) bool {
+		return name == displayName
+	})
+}
+
+//SetEntries replaces the networks selected by managed with entries and leaves every other network alone.
+//Entries whose CIDR is already authorized by an unmanaged network are not added again.
+//Clusters that aren't RUNNING, or are in a maintenance exclusion honored by ctx, are left alone and a *NotRunningError
+//is returned.
+func SetEntries(ctx context.Context, containerService *container.Service, cluster Cluster, entries []*container.CidrBlock, managed func(displayName string) bool) (*Change, error) {
+	c, err := GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Status != "RUNNING" {
+		logf(ctx, "Cluster %s is %s, leaving it alone", cluster.Name, c.Status)
+		return nil, &NotRunningError{Cluster: cluster.Name, Status: c.Status, Message: c.StatusMessage}
+	}
+	if name, end := ActiveExclusion(c, time.Now()); name != "" && honorsExclusions(ctx) {
+		logf(ctx, "Cluster %s is in the maintenance exclusion %s, leaving it alone", cluster.Name, name)
+		return nil, &NotRunningError{Cluster: cluster.Name, Status: c.Status, Exclusion: name, Until: end}
+	}
+
+	var existingBlocks []*container.CidrBlock
+	if c.MasterAuthorizedNetworksConfig != nil {
+		existingBlocks = c.MasterAuthorizedNetworksConfig.CidrBlocks
+	}
+
+	updatedCidrBlocks, change := Plan(existingBlocks, entries, managed)
+	change.Limit = NetworkLimit(c)
+	logf(ctx, "Authorized networks delta of %s : %d added, %d removed, %d kept", cluster.Name, len(change.Added), len(change.Removed), len(change.Kept))
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return change, nil
+	}
+
+	change.Operation, err = SetCidrBlocks(ctx, containerService, cluster, updatedCidrBlocks)
+	if err != nil {
+		return nil, err
+	}
+	logf(ctx, "Updating the authorized networks of %s with operation %s", cluster.Name, change.Operation.Name)
+
+	return change, nil
+}
+
+//Plan computes the minimal change SetEntries makes to a cluster that currently has existing, without calling the API.
+//Only the networks that differ are added or removed, so nothing has to be written when the cluster already matches.
+func Plan(existing, entries []*container.CidrBlock, managed func(displayName string) bool) ([]*container.CidrBlock, *Change) {
+	var updated []*container.CidrBlock
+	authorized := map[string]bool{}
+	for _, c := range existing {
+		if !managed(c.DisplayName) {
+			updated = append(updated, c)
+			authorized[c.CidrBlock] = true
+		}
+	}
+
+	for _, e := range entries {
+		if !authorized[e.CidrBlock] {
+			updated = append(updated, e)
+			authorized[e.CidrBlock] = true
+		}
+	}
+
+	added := missingBlocks(updated, existing)
+	return updated, &Change{
+		Added:   added,
+		Removed: missingBlocks(existing, updated),
+		Kept:    missingBlocks(updated, added),
+	}
+}
+
+//Adoptable returns the unmanaged networks of existing that authorize the CIDR of one of entries under another name,
+//so they can be taken over instead of being kept apart. Networks sharing their name with another one are left out,
+//as taking them over would remove the others too.
+func Adoptable(existing, entries []*container.CidrBlock, managed func(displayName string) bool) []*container.CidrBlock {
+	wanted := map[string]bool{}
+	for _, e := range entries {
+		wanted[e.CidrBlock] = true
+	}
+	names := map[string]int{}
+	for _, c := range existing {
+		names[c.DisplayName]++
+	}
+
+	var adoptable []*container.CidrBlock
+	for _, c := range existing {
+		if wanted[c.CidrBlock] && !managed(c.DisplayName) && names[c.DisplayName] == 1 {
+			adoptable = append(adoptable, c)
+		}
+	}
+	return adoptable
+}
+
+//Consolidate keeps a single network for every CIDR of blocks: the first one preferred when there is one, the first one otherwise.
+//Returns the networks to keep, in their order, and the duplicates.
+func Consolidate(blocks []*container.CidrBlock, preferred func(displayName string) bool) ([]*container.CidrBlock, []*container.CidrBlock) {
+	keep := map[string]*container.CidrBlock{}
+	for _, c := range blocks {
+		if k, ok := keep[c.CidrBlock]; !ok || (preferred(c.DisplayName) && !preferred(k.DisplayName)) {
+			keep[c.CidrBlock] = c
+		}
+	}
+
+	var kept, duplicates []*container.CidrBlock
+	for _, c := range blocks {
+		if keep[c.CidrBlock] == c {
+			kept = append(kept, c)
+		} else {
+			duplicates = append(duplicates, c)
+		}
+	}
+	return kept, duplicates
+}
+
+//networks of a that aren't in b
+func missingBlocks(a, b []*container.CidrBlock) []*container.CidrBlock {
+	type network struct{ cidr, name string }
+	count := map[network]int{}
+	for _, c := range b {
+		count[network{c.CidrBlock, c.DisplayName}]++
+	}
+
+	var missing []*container.CidrBlock
+	for _, c := range a {
+		key := network{c.CidrBlock, c.DisplayName}
+		if count[key] == 0 {
+			missing = append(missing, c)
+			continue
+		}
+		count[key]--
+	}
+
+	return missing
+}
+
+//https://cloud.google.com/kubernetes-engine/docs/reference/rest/v1/projects.locations.clusters/get
+//GetCluster fetches the GKE cluster, zonal or regional
+func GetCluster(ctx context.Context, containerService *container.Service, cluster Cluster) (*container.Cluster, error) {
+	return containerService.Projects.Locations.Clusters.Get(cluster.ResourceName()).Context(ctx).Do()
+}
+
+//GetCidrBlocks fetches the existing networks in the GKE cluster
+func GetCidrBlocks(ctx context.Context, containerService *container.Service, cluster Cluster) ([]*container.CidrBlock, error) {
+	resp, err := GetCluster(ctx, containerService, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.MasterAuthorizedNetworksConfig == nil {
+		return nil, nil
+	}
+
+	return resp.MasterAuthorizedNetworksConfig.CidrBlocks, nil
+}
+
+//SetCidrBlocks replaces the master authorized networks of the cluster with blocks and returns the update operation
+func SetCidrBlocks(ctx context.Context, containerService *container.Service, cluster Cluster, blocks []*container.CidrBlock) (*container.Operation, error) {
+	rb := &container.UpdateClusterRequest{
+		Update: &container.ClusterUpdate{
+			DesiredMasterAuthorizedNetworksConfig: &container.MasterAuthorizedNetworksConfig{
+				CidrBlocks: blocks,
+				Enabled:    true,
+			},
+		},
+	}
+
+	return containerService.Projects.Locations.Clusters.Update(cluster.ResourceName(), rb).Context(ctx).Do()
+}
+
+//IsNotFound reports whether err is the answer of the GKE API about a cluster that doesn't exist, deleted or renamed
+func IsNotFound(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && e.Code == http.StatusNotFound
+}
+
+//FindClustersByLabels lists the clusters of the project, in every location, carrying all the resource labels
+func FindClustersByLabels(ctx context.Context, containerService *container.Service, project string, labels map[string]string) ([]Cluster, error) {
+	resp, err := containerService.Projects.Locations.Clusters.List(fmt.Sprintf("projects/%s/locations/-", project)).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Cluster
+	for _, c := range resp.Clusters {
+		matches := true
+		for k, v := range labels {
+			if c.ResourceLabels[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, Cluster{Project: project, Zone: c.Location, Name: c.Name})
+		}
+	}
+	return found, nil
+}
+
+//FindCluster looks for a cluster by name across every location of the project, for when the zone isn't known
+func FindCluster(ctx context.Context, containerService *container.Service, project, name string) (Cluster, error) {
+	resp, err := containerService.Projects.Locations.Clusters.List(fmt.Sprintf("projects/%s/locations/-", project)).Context(ctx).Do()
+	if err != nil {
+		return Cluster{}, err
+	}
+
+	var candidates []string
+	var found Cluster
+	for _, c := range resp.Clusters {
+		if c.Name == name {
+			found = Cluster{Project: project, Zone: c.Location, Name: c.Name}
+			candidates = append(candidates, c.Location)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		if len(resp.MissingZones) > 0 {
+			return Cluster{}, fmt.Errorf("no cluster named %s in project %s, some zones could not be listed : %s", name, project, strings.Join(resp.MissingZones, ", "))
+		}
+		return Cluster{}, fmt.Errorf("no cluster named %s in project %s", name, project)
+	case 1:
+		return found, nil
+	default:
+		return Cluster{}, fmt.Errorf("%d clusters named %s in project %s, pick one with --location : %s", len(candidates), name, project, strings.Join(candidates, ", "))
+	}
+}
@@ -0,0 +1,189 @@
+package updater
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/container/v1"
+)
+
+//networks written as name=cidr
+func blocks(networks ...string) []*container.CidrBlock {
+	var b []*container.CidrBlock
+	for _, n := range networks {
+		parts := strings.SplitN(n, "=", 2)
+		b = append(b, &container.CidrBlock{DisplayName: parts[0], CidrBlock: parts[1]})
+	}
+	return b
+}
+
+func networks(b []*container.CidrBlock) []string {
+	var n []string
+	for _, c := range b {
+		n = append(n, c.DisplayName+"="+c.CidrBlock)
+	}
+	return n
+}
+
+func managedBy(names ...string) func(string) bool {
+	return func(displayName string) bool {
+		for _, n := range names {
+			if n == displayName {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		entries  []string
+		managed  []string
+		want     []string
+		added    []string
+		removed  []string
+		kept     []string
+	}{
+		{
+			name:    "empty cluster",
+			entries: []string{"home=203.0.113.1/32"},
+			want:    []string{"home=203.0.113.1/32"},
+			added:   []string{"home=203.0.113.1/32"},
+		},
+		{
+			name:     "ip changed",
+			existing: []string{"office=198.51.100.0/24", "home=203.0.113.1/32"},
+			entries:  []string{"home=203.0.113.2/32"},
+			managed:  []string{"home"},
+			want:     []string{"office=198.51.100.0/24", "home=203.0.113.2/32"},
+			added:    []string{"home=203.0.113.2/32"},
+			removed:  []string{"home=203.0.113.1/32"},
+			kept:     []string{"office=198.51.100.0/24"},
+		},
+		{
+			name:     "unchanged",
+			existing: []string{"home=203.0.113.1/32"},
+			entries:  []string{"home=203.0.113.1/32"},
+			managed:  []string{"home"},
+			want:     []string{"home=203.0.113.1/32"},
+			kept:     []string{"home=203.0.113.1/32"},
+		},
+		{
+			name:     "cidr already authorized by another network",
+			existing: []string{"office=203.0.113.1/32"},
+			entries:  []string{"home=203.0.113.1/32"},
+			managed:  []string{"home"},
+			want:     []string{"office=203.0.113.1/32"},
+			kept:     []string{"office=203.0.113.1/32"},
+		},
+		{
+			name:     "stale managed network removed",
+			existing: []string{"home=203.0.113.1/32", "old=192.0.2.1/32"},
+			entries:  []string{"home=203.0.113.1/32"},
+			managed:  []string{"home", "old"},
+			want:     []string{"home=203.0.113.1/32"},
+			removed:  []string{"old=192.0.2.1/32"},
+			kept:     []string{"home=203.0.113.1/32"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, change := Plan(blocks(tt.existing...), blocks(tt.entries...), managedBy(tt.managed...))
+			if got := networks(updated); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("networks = %v, want %v", got, tt.want)
+			}
+			if got := networks(change.Added); !reflect.DeepEqual(got, tt.added) {
+				t.Errorf("added = %v, want %v", got, tt.added)
+			}
+			if got := networks(change.Removed); !reflect.DeepEqual(got, tt.removed) {
+				t.Errorf("removed = %v, want %v", got, tt.removed)
+			}
+			if got := networks(change.Kept); !reflect.DeepEqual(got, tt.kept) {
+				t.Errorf("kept = %v, want %v", got, tt.kept)
+			}
+		})
+	}
+}
+
+func TestAdoptable(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		entries  []string
+		managed  []string
+		want     []string
+	}{
+		{
+			name:     "unmanaged network with the cidr of an entry",
+			existing: []string{"laptop=203.0.113.1/32", "office=198.51.100.0/24"},
+			entries:  []string{"home=203.0.113.1/32"},
+			want:     []string{"laptop=203.0.113.1/32"},
+		},
+		{
+			name:     "managed networks aren't adopted",
+			existing: []string{"home=203.0.113.1/32"},
+			entries:  []string{"home=203.0.113.1/32"},
+			managed:  []string{"home"},
+		},
+		{
+			name:     "ambiguous names aren't adopted",
+			existing: []string{"laptop=203.0.113.1/32", "laptop=192.0.2.1/32"},
+			entries:  []string{"home=203.0.113.1/32"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := networks(Adoptable(blocks(tt.existing...), blocks(tt.entries...), managedBy(tt.managed...)))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("adoptable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsolidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		blocks     []string
+		preferred  []string
+		kept       []string
+		duplicates []string
+	}{
+		{
+			name:   "no duplicates",
+			blocks: []string{"a=192.0.2.1/32", "b=192.0.2.2/32"},
+			kept:   []string{"a=192.0.2.1/32", "b=192.0.2.2/32"},
+		},
+		{
+			name:       "first one kept",
+			blocks:     []string{"a=192.0.2.1/32", "b=192.0.2.1/32"},
+			kept:       []string{"a=192.0.2.1/32"},
+			duplicates: []string{"b=192.0.2.1/32"},
+		},
+		{
+			name:       "preferred one kept in its place",
+			blocks:     []string{"a=192.0.2.1/32", "c=192.0.2.2/32", "b=192.0.2.1/32"},
+			preferred:  []string{"b"},
+			kept:       []string{"c=192.0.2.2/32", "b=192.0.2.1/32"},
+			duplicates: []string{"a=192.0.2.1/32"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, duplicates := Consolidate(blocks(tt.blocks...), managedBy(tt.preferred...))
+			if got := networks(kept); !reflect.DeepEqual(got, tt.kept) {
+				t.Errorf("kept = %v, want %v", got, tt.kept)
+			}
+			if got := networks(duplicates); !reflect.DeepEqual(got, tt.duplicates) {
+				t.Errorf("duplicates = %v, want %v", got, tt.duplicates)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+//set at build time with -ldflags, see the Makefile
+var (
+	commit    = ""
+	buildDate = ""
+)
+
+//what the binary was built from
+type buildInfo struct {
+	Version   string      `json:"version"`
+	Commit    string      `json:"commit,omitempty"`
+	BuildDate string      `json:"buildDate,omitempty"`
+	GoVersion string      `json:"goVersion"`
+	Platform  string      `json:"platform"`
+	Module    string      `json:"module,omitempty"`
+	Deps      []moduleRef `json:"deps,omitempty"`
+}
+
+//a module compiled into the binary
+type moduleRef struct {
+	Path    string     `json:"path"`
+	Version string     `json:"version"`
+	Sum     string     `json:"sum,omitempty"`
+	Replace *moduleRef `json:"replace,omitempty"`
+}
+
+func newModuleRef(m *debug.Module) *moduleRef {
+	ref := &moduleRef{Path: m.Path, Version: m.Version, Sum: m.Sum}
+	if m.Replace != nil {
+		ref.Replace = newModuleRef(m.Replace)
+	}
+	return ref
+}
+
+func readBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = bi.Main.Path
+	for _, m := range bi.Deps {
+		info.Deps = append(info.Deps, *newModuleRef(m))
+	}
+	return info
+}
+
+//print the version, along with what the binary was built from with --verbose
+func (a *App) printVersion() {
+	if !a.Verbose {
+		fmt.Println(version)
+		return
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(readBuildInfo())
+}
+
+//serve the build information on the admin endpoint
+func serveVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readBuildInfo())
+}